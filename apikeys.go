@@ -0,0 +1,239 @@
+package cservice
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// HeaderAPIKey carries the API key authenticating a request.
+const HeaderAPIKey = "X-API-Key"
+
+// APIKeyAdminScope allows issuing and revoking keys through APIKeys.Handler.
+const APIKeyAdminScope = "keys:admin"
+
+// ErrInvalidAPIKey is returned for unknown or revoked API keys.
+var ErrInvalidAPIKey = errors.New("cservice: invalid API key")
+
+// APIKey is an issued API key. Only a SHA-256 hash of the key is stored. Add
+// it to DatabaseConfig.Models to create its table.
+type APIKey struct {
+	ID   uint   `gorm:"primaryKey" json:"id"`
+	Name string `gorm:"size:191" json:"name"`
+
+	// Prefix is the start of the key, shown to identify it.
+	Prefix string `gorm:"size:16" json:"prefix"`
+
+	// Hash is the hex SHA-256 of the key.
+	Hash string `gorm:"size:64;uniqueIndex" json:"-"`
+
+	// Scopes is a space separated list of the scopes granted to the key.
+	Scopes string `gorm:"size:1024" json:"scopes"`
+
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// HasScope reports whether the key was granted scope.
+func (k *APIKey) HasScope(scope string) bool {
+	for _, granted := range strings.Fields(k.Scopes) {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKeys issues, revokes and authenticates API keys.
+type APIKeys struct {
+	db    *gorm.DB
+	clock Clock
+}
+
+// NewAPIKeys creates an APIKeys storing keys in db.
+func NewAPIKeys(db *gorm.DB) *APIKeys {
+	return &APIKeys{db: db, clock: SystemClock}
+}
+
+// Issue creates a key with the given name and scopes. The returned key is
+// not stored and cannot be retrieved again.
+func (k *APIKeys) Issue(ctx context.Context, name string, scopes ...string) (string, *APIKey, error) {
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, err
+	}
+
+	key := "ck_" + hex.EncodeToString(secret)
+	record := &APIKey{
+		Name:   name,
+		Prefix: key[:11],
+		Hash:   hashAPIKey(key),
+		Scopes: strings.Join(scopes, " "),
+	}
+
+	if err := k.db.WithContext(ctx).Create(record).Error; err != nil {
+		return "", nil, err
+	}
+
+	return key, record, nil
+}
+
+// Revoke revokes the key with the given ID.
+func (k *APIKeys) Revoke(ctx context.Context, id uint) error {
+	result := k.db.WithContext(ctx).Model(&APIKey{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", k.clock.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// List returns every key, including revoked keys.
+func (k *APIKeys) List(ctx context.Context) ([]APIKey, error) {
+	var keys []APIKey
+	err := k.db.WithContext(ctx).Order("id").Find(&keys).Error
+	return keys, err
+}
+
+// Authenticate returns the record of key, or ErrInvalidAPIKey if it is
+// unknown or revoked.
+func (k *APIKeys) Authenticate(ctx context.Context, key string) (*APIKey, error) {
+	if key == "" {
+		return nil, ErrInvalidAPIKey
+	}
+
+	var record APIKey
+	err := k.db.WithContext(ctx).Where("hash = ? AND revoked_at IS NULL", hashAPIKey(key)).Take(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &record, nil
+}
+
+type apiKeyKey struct{}
+
+// APIKeyFromContext returns the key which authenticated the request ctx
+// belongs to, or nil.
+func APIKeyFromContext(ctx context.Context) *APIKey {
+	key, _ := ctx.Value(apiKeyKey{}).(*APIKey)
+	return key
+}
+
+// Middleware returns middleware which responds 401 Unauthorized to requests
+// without a valid X-API-Key header, and 403 Forbidden to keys missing any of
+// scopes.
+func (k *APIKeys) Middleware(scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			key, err := k.Authenticate(r.Context(), r.Header.Get(HeaderAPIKey))
+			switch {
+			case errors.Is(err, ErrInvalidAPIKey):
+				http.Error(rw, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			case err != nil:
+				http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+
+			for _, scope := range scopes {
+				if !key.HasScope(scope) {
+					http.Error(rw, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+					return
+				}
+			}
+
+			next.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), apiKeyKey{}, key)))
+		})
+	}
+}
+
+// Handler serves key management to keys with APIKeyAdminScope: GET / lists
+// the keys, POST / issues a key from a JSON body {"name": ..., "scopes":
+// [...]} and returns it once, and DELETE /{id} revokes a key. Issue the
+// first admin key from code or a task.
+func (k *APIKeys) Handler() http.Handler {
+	handler := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		path := strings.Trim(r.URL.Path, "/")
+
+		switch {
+		case r.Method == http.MethodGet && path == "":
+			keys, err := k.List(r.Context())
+			if err != nil {
+				http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+
+			writeJSON(rw, http.StatusOK, keys)
+		case r.Method == http.MethodPost && path == "":
+			var body struct {
+				Name   string   `json:"name"`
+				Scopes []string `json:"scopes"`
+			}
+			if err := json.NewDecoder(http.MaxBytesReader(rw, r.Body, 1<<16)).Decode(&body); err != nil || body.Name == "" {
+				http.Error(rw, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+				return
+			}
+
+			key, record, err := k.Issue(r.Context(), body.Name, body.Scopes...)
+			if err != nil {
+				http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+
+			writeJSON(rw, http.StatusCreated, struct {
+				*APIKey
+				Key string `json:"key"`
+			}{record, key})
+		case r.Method == http.MethodDelete && path != "":
+			id, err := strconv.ParseUint(path, 10, 0)
+			if err != nil {
+				http.NotFound(rw, r)
+				return
+			}
+
+			err = k.Revoke(r.Context(), uint(id))
+			switch {
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				http.NotFound(rw, r)
+			case err != nil:
+				http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			default:
+				rw.WriteHeader(http.StatusNoContent)
+			}
+		default:
+			http.Error(rw, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		}
+	})
+
+	return k.Middleware(APIKeyAdminScope)(handler)
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func writeJSON(rw http.ResponseWriter, status int, v interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	json.NewEncoder(rw).Encode(v)
+}
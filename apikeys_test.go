@@ -0,0 +1,92 @@
+package cservice
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/crockerio/cservice/cservicetest"
+)
+
+func TestAPIKeysMiddleware(t *testing.T) {
+	keys := NewAPIKeys(cservicetest.OpenDB(t, &APIKey{}))
+	ctx := context.Background()
+
+	key, record, err := keys.Issue(ctx, "reports", "reports:read")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Hash == "" || strings.Contains(record.Hash, key) {
+		t.Fatalf("key stored as %q, want hash", record.Hash)
+	}
+
+	var seen *APIKey
+	handler := keys.Middleware("reports:read")(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		seen = APIKeyFromContext(r.Context())
+	}))
+
+	serve := func(h http.Handler, key string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if key != "" {
+			req.Header.Set(HeaderAPIKey, key)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := serve(handler, ""); code != http.StatusUnauthorized {
+		t.Errorf("missing key: got %d", code)
+	}
+	if code := serve(handler, key+"x"); code != http.StatusUnauthorized {
+		t.Errorf("wrong key: got %d", code)
+	}
+	if code := serve(handler, key); code != http.StatusOK || seen == nil || seen.ID != record.ID {
+		t.Errorf("valid key: got %d, key %v", code, seen)
+	}
+
+	writer := keys.Middleware("reports:write")(handler)
+	if code := serve(writer, key); code != http.StatusForbidden {
+		t.Errorf("missing scope: got %d", code)
+	}
+
+	if err := keys.Revoke(ctx, record.ID); err != nil {
+		t.Fatal(err)
+	}
+	if code := serve(handler, key); code != http.StatusUnauthorized {
+		t.Errorf("revoked key: got %d", code)
+	}
+}
+
+func TestAPIKeysHandler(t *testing.T) {
+	keys := NewAPIKeys(cservicetest.OpenDB(t, &APIKey{}))
+	admin, _, err := keys.Issue(context.Background(), "admin", APIKeyAdminScope)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name":"ci","scopes":["deploy"]}`))
+	rec := httptest.NewRecorder()
+	keys.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unauthenticated issue: got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name":"ci","scopes":["deploy"]}`))
+	req.Header.Set(HeaderAPIKey, admin)
+	rec = httptest.NewRecorder()
+	keys.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated || !strings.Contains(rec.Body.String(), `"key":"ck_`) {
+		t.Fatalf("issue: got %d %s", rec.Code, rec.Body)
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/2", nil)
+	req.Header.Set(HeaderAPIKey, admin)
+	rec = httptest.NewRecorder()
+	keys.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("revoke: got %d", rec.Code)
+	}
+}
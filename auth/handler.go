@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// ErrInvalidToken is returned by a TokenIssuer for refresh tokens which are
+// unknown, expired or revoked.
+var ErrInvalidToken = errors.New("auth: invalid token")
+
+// Tokens are returned by the login and refresh endpoints.
+type Tokens struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+
+	// ExpiresIn is the lifetime of AccessToken in seconds.
+	ExpiresIn int `json:"expires_in,omitempty"`
+}
+
+// TokenIssuer mints the tokens returned to users who sign in, such as JWTs
+// accepted by the service's token middleware.
+type TokenIssuer interface {
+	// Issue returns tokens for user after a successful login.
+	Issue(ctx context.Context, user *User) (*Tokens, error)
+
+	// Refresh exchanges a refresh token for new tokens, returning
+	// ErrInvalidToken if it is not valid.
+	Refresh(ctx context.Context, refreshToken string) (*Tokens, error)
+}
+
+// Handler serves POST /login, taking a JSON body {"email": ...,
+// "password": ...}, and POST /refresh, taking {"refresh_token": ...}. Both
+// respond with Tokens from issuer, or 401 Unauthorized.
+func (u *Users) Handler(issuer TokenIssuer) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			rw.Header().Set("Allow", http.MethodPost)
+			http.Error(rw, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		var tokens *Tokens
+		var err error
+
+		switch strings.Trim(r.URL.Path, "/") {
+		case "login":
+			var body struct {
+				Email    string `json:"email"`
+				Password string `json:"password"`
+			}
+			if !decode(rw, r, &body) {
+				return
+			}
+
+			var user *User
+			user, err = u.Authenticate(r.Context(), body.Email, body.Password)
+			if err == nil {
+				tokens, err = issuer.Issue(r.Context(), user)
+			}
+		case "refresh":
+			var body struct {
+				RefreshToken string `json:"refresh_token"`
+			}
+			if !decode(rw, r, &body) {
+				return
+			}
+
+			tokens, err = issuer.Refresh(r.Context(), body.RefreshToken)
+		default:
+			http.NotFound(rw, r)
+			return
+		}
+
+		switch {
+		case errors.Is(err, ErrInvalidCredentials), errors.Is(err, ErrInvalidToken):
+			http.Error(rw, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		case err != nil:
+			http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(rw).Encode(tokens)
+	})
+}
+
+func decode(rw http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(http.MaxBytesReader(rw, r.Body, 1<<16)).Decode(v); err != nil {
+		http.Error(rw, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPasswordHashers(t *testing.T) {
+	hashers := map[string]Hasher{
+		"bcrypt":   Bcrypt{Cost: 4},
+		"argon2id": Argon2id{Time: 1, Memory: 1024, Threads: 1},
+	}
+
+	for name, hasher := range hashers {
+		t.Run(name, func(t *testing.T) {
+			hash, err := hasher.Hash("correct horse")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(hash, "correct horse") {
+				t.Fatalf("hash %q contains the password", hash)
+			}
+
+			if err := CheckPassword(hash, "correct horse"); err != nil {
+				t.Errorf("matching password: %v", err)
+			}
+			if err := CheckPassword(hash, "battery staple"); !errors.Is(err, ErrPasswordMismatch) {
+				t.Errorf("wrong password: got %v, want ErrPasswordMismatch", err)
+			}
+
+			again, err := hasher.Hash("correct horse")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again == hash {
+				t.Error("hashes of the same password are not salted")
+			}
+		})
+	}
+}
+
+func TestCheckPasswordUnknownHash(t *testing.T) {
+	for _, hash := range []string{"", "plaintext", "$argon2id$v=19$broken", "$argon2i$v=19$m=1024,t=1,p=1$c2FsdA$a2V5"} {
+		if err := CheckPassword(hash, "password"); !errors.Is(err, ErrUnknownHash) {
+			t.Errorf("CheckPassword(%q): got %v, want ErrUnknownHash", hash, err)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidCredentials is returned when an email and password do not
+// identify a user.
+var ErrInvalidCredentials = errors.New("auth: invalid credentials")
+
+// ErrEmailTaken is returned by Register when a user already has the email.
+var ErrEmailTaken = errors.New("auth: email already registered")
+
+// MinPasswordLength is the shortest password Register accepts.
+const MinPasswordLength = 8
+
+// User is a user who signs in with an email and password. Add it to
+// DatabaseConfig.Models to create its table.
+type User struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	Email        string    `gorm:"size:191;uniqueIndex" json:"email"`
+	PasswordHash string    `gorm:"size:255" json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// Users registers and authenticates users.
+type Users struct {
+	db     *gorm.DB
+	hasher Hasher
+
+	// dummyHash is checked when no user has the email, so unknown emails
+	// take as long to reject as wrong passwords.
+	dummyHash string
+}
+
+// NewUsers creates a Users storing users in db and hashing passwords with
+// hasher, or bcrypt if hasher is nil.
+func NewUsers(db *gorm.DB, hasher Hasher) (*Users, error) {
+	if hasher == nil {
+		hasher = Bcrypt{}
+	}
+
+	dummyHash, err := hasher.Hash("cservice-auth-dummy")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Users{db: db, hasher: hasher, dummyHash: dummyHash}, nil
+}
+
+// Register creates a user with email and password.
+func (u *Users) Register(ctx context.Context, email, password string) (*User, error) {
+	email = normalizeEmail(email)
+	if email == "" {
+		return nil, errors.New("auth: email is required")
+	}
+	if len(password) < MinPasswordLength {
+		return nil, errors.New("auth: password is too short")
+	}
+
+	var count int64
+	if err := u.db.WithContext(ctx).Model(&User{}).Where("email = ?", email).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrEmailTaken
+	}
+
+	hash, err := u.hasher.Hash(password)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &User{Email: email, PasswordHash: hash}
+	if err := u.db.WithContext(ctx).Create(user).Error; err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// Authenticate returns the user with email if password matches, or
+// ErrInvalidCredentials.
+func (u *Users) Authenticate(ctx context.Context, email, password string) (*User, error) {
+	var user User
+	err := u.db.WithContext(ctx).Where("email = ?", normalizeEmail(email)).Take(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		CheckPassword(u.dummyHash, password)
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = CheckPassword(user.PasswordHash, password)
+	if errors.Is(err, ErrPasswordMismatch) {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// SetPassword replaces the password of the user with id.
+func (u *Users) SetPassword(ctx context.Context, id uint, password string) error {
+	if len(password) < MinPasswordLength {
+		return errors.New("auth: password is too short")
+	}
+
+	hash, err := u.hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+
+	result := u.db.WithContext(ctx).Model(&User{}).Where("id = ?", id).Update("password_hash", hash)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
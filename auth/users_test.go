@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/crockerio/cservice/cservicetest"
+)
+
+func openTestUsers(t *testing.T) *Users {
+	t.Helper()
+
+	users, err := NewUsers(cservicetest.OpenDB(t, &User{}), Bcrypt{Cost: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return users
+}
+
+func TestUsersRegisterAndAuthenticate(t *testing.T) {
+	users := openTestUsers(t)
+	ctx := context.Background()
+
+	user, err := users.Register(ctx, " Ann@Example.com ", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Email != "ann@example.com" {
+		t.Errorf("stored email %q", user.Email)
+	}
+
+	if _, err := users.Register(ctx, "ann@example.com", "another password"); !errors.Is(err, ErrEmailTaken) {
+		t.Errorf("duplicate email: got %v, want ErrEmailTaken", err)
+	}
+	if _, err := users.Register(ctx, "bob@example.com", "short"); err == nil {
+		t.Error("short password was accepted")
+	}
+
+	if got, err := users.Authenticate(ctx, "ANN@example.com", "correct horse"); err != nil || got.ID != user.ID {
+		t.Errorf("valid credentials: got %v, %v", got, err)
+	}
+	if _, err := users.Authenticate(ctx, "ann@example.com", "wrong password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("wrong password: got %v", err)
+	}
+	if _, err := users.Authenticate(ctx, "nobody@example.com", "correct horse"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("unknown email: got %v", err)
+	}
+
+	if err := users.SetPassword(ctx, user.ID, "battery staple"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := users.Authenticate(ctx, "ann@example.com", "battery staple"); err != nil {
+		t.Errorf("new password: %v", err)
+	}
+}
+
+type fakeIssuer struct{}
+
+func (fakeIssuer) Issue(ctx context.Context, user *User) (*Tokens, error) {
+	return &Tokens{AccessToken: fmt.Sprintf("access-%d", user.ID), RefreshToken: "refresh", ExpiresIn: 60}, nil
+}
+
+func (fakeIssuer) Refresh(ctx context.Context, refreshToken string) (*Tokens, error) {
+	if refreshToken != "refresh" {
+		return nil, ErrInvalidToken
+	}
+	return &Tokens{AccessToken: "renewed"}, nil
+}
+
+func TestUsersHandler(t *testing.T) {
+	users := openTestUsers(t)
+	user, err := users.Register(context.Background(), "ann@example.com", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := users.Handler(fakeIssuer{})
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	rec := serve(http.MethodPost, "/login", `{"email":"ann@example.com","password":"correct horse"}`)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), fmt.Sprintf(`"access_token":"access-%d"`, user.ID)) {
+		t.Errorf("login: got %d %s", rec.Code, rec.Body)
+	}
+	if rec.Header().Get("Cache-Control") != "no-store" {
+		t.Error("tokens may be cached")
+	}
+
+	if rec := serve(http.MethodPost, "/login", `{"email":"ann@example.com","password":"nope"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("wrong password: got %d", rec.Code)
+	}
+	if rec := serve(http.MethodPost, "/login", `not json`); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad body: got %d", rec.Code)
+	}
+
+	if rec := serve(http.MethodPost, "/refresh", `{"refresh_token":"refresh"}`); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "renewed") {
+		t.Errorf("refresh: got %d %s", rec.Code, rec.Body)
+	}
+	if rec := serve(http.MethodPost, "/refresh", `{"refresh_token":"stolen"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("invalid refresh token: got %d", rec.Code)
+	}
+
+	if rec := serve(http.MethodGet, "/login", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET login: got %d", rec.Code)
+	}
+	if rec := serve(http.MethodPost, "/logout", "{}"); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown path: got %d", rec.Code)
+	}
+}
@@ -0,0 +1,95 @@
+package cservice
+
+import (
+	"context"
+	"reflect"
+
+	"gorm.io/gorm"
+)
+
+type actorKey struct{}
+
+// WithActor returns a copy of ctx identifying the user making changes. Models
+// saved with this context (db.WithContext(ctx)) are blamed on the actor by
+// BlamePlugin.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// Actor returns the actor stored in ctx, or an empty string.
+func Actor(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// Blame records who created and last updated a model. Embed it in models to
+// add the columns maintained by BlamePlugin.
+type Blame struct {
+	CreatedBy string `gorm:"size:40"`
+	UpdatedBy string `gorm:"size:40"`
+}
+
+// BlamePlugin is a GORM plugin which sets the CreatedBy and UpdatedBy fields
+// of models from the actor in the statement's context.
+type BlamePlugin struct{}
+
+// Name returns the name of the plugin.
+func (BlamePlugin) Name() string {
+	return "cservice:blame"
+}
+
+// Initialize registers the plugin's create and update callbacks.
+func (p BlamePlugin) Initialize(db *gorm.DB) error {
+	if err := db.Callback().Create().Before("gorm:create").Register(p.Name()+":create", p.blameCreate); err != nil {
+		return err
+	}
+
+	return db.Callback().Update().Before("gorm:update").Register(p.Name()+":update", p.blameUpdate)
+}
+
+func (BlamePlugin) blameCreate(db *gorm.DB) {
+	actor := Actor(db.Statement.Context)
+	if db.Error != nil || db.Statement.Schema == nil || actor == "" {
+		return
+	}
+
+	createdBy := db.Statement.Schema.LookUpField("CreatedBy")
+	updatedBy := db.Statement.Schema.LookUpField("UpdatedBy")
+
+	assign := func(rv reflect.Value) {
+		if createdBy != nil {
+			if _, zero := createdBy.ValueOf(rv); zero {
+				db.AddError(createdBy.Set(rv, actor))
+			}
+		}
+
+		if updatedBy != nil {
+			db.AddError(updatedBy.Set(rv, actor))
+		}
+	}
+
+	rv := db.Statement.ReflectValue
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			assign(reflect.Indirect(rv.Index(i)))
+		}
+	case reflect.Struct:
+		assign(rv)
+	}
+}
+
+func (BlamePlugin) blameUpdate(db *gorm.DB) {
+	actor := Actor(db.Statement.Context)
+	if db.Error != nil || db.Statement.Schema == nil || actor == "" {
+		return
+	}
+
+	if db.Statement.Schema.LookUpField("UpdatedBy") != nil {
+		db.Statement.SetColumn("UpdatedBy", actor, true)
+	}
+}
@@ -0,0 +1,73 @@
+package cservice
+
+import (
+	"context"
+	"testing"
+
+	"github.com/crockerio/cservice/cservicetest"
+)
+
+type blamedWidget struct {
+	ID   uint
+	Name string
+	Blame
+}
+
+func TestActor(t *testing.T) {
+	if actor := Actor(context.Background()); actor != "" {
+		t.Errorf("empty context: got %q", actor)
+	}
+	if actor := Actor(WithActor(context.Background(), "alice")); actor != "alice" {
+		t.Errorf("got %q, want alice", actor)
+	}
+}
+
+func TestBlamePlugin(t *testing.T) {
+	conn := cservicetest.OpenDB(t, &blamedWidget{})
+	if err := conn.Use(BlamePlugin{}); err != nil {
+		t.Fatal(err)
+	}
+
+	alice := WithActor(context.Background(), "alice")
+	bob := WithActor(context.Background(), "bob")
+
+	widget := &blamedWidget{Name: "sprocket"}
+	if err := conn.WithContext(alice).Create(widget).Error; err != nil {
+		t.Fatal(err)
+	}
+	if widget.CreatedBy != "alice" || widget.UpdatedBy != "alice" {
+		t.Errorf("after create: got %+v", widget.Blame)
+	}
+
+	if err := conn.WithContext(bob).Model(widget).Update("name", "cog").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var stored blamedWidget
+	if err := conn.First(&stored, widget.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.CreatedBy != "alice" || stored.UpdatedBy != "bob" {
+		t.Errorf("after update: got %+v", stored.Blame)
+	}
+
+	// Changes without an actor leave the blame columns alone.
+	if err := conn.Model(widget).Update("name", "gear").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.First(&stored, widget.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.Name != "gear" || stored.UpdatedBy != "bob" {
+		t.Errorf("after anonymous update: got %+v", stored)
+	}
+
+	// An explicit creator is kept.
+	imported := []blamedWidget{{Name: "imported", Blame: Blame{CreatedBy: "importer"}}}
+	if err := conn.WithContext(alice).Create(&imported).Error; err != nil {
+		t.Fatal(err)
+	}
+	if imported[0].CreatedBy != "importer" || imported[0].UpdatedBy != "alice" {
+		t.Errorf("batch create: got %+v", imported[0].Blame)
+	}
+}
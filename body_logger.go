@@ -0,0 +1,259 @@
+package cservice
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"gorm.io/gorm/logger"
+)
+
+// BodyLoggerConfig defines how request and response bodies are captured.
+type BodyLoggerConfig struct {
+	// Writer receives the log lines. Defaults to stdout.
+	Writer logger.Writer
+
+	// MaxBodySize is the number of bytes of each body captured. Defaults to
+	// 4096.
+	MaxBodySize int
+
+	// RedactFields lists field names whose values are never logged, in JSON
+	// bodies at any depth, URL-encoded and multipart form bodies, and the
+	// query string. Matching is case-insensitive.
+	RedactFields []string
+
+	// Enabled sets whether bodies are logged initially.
+	Enabled bool
+}
+
+// BodyLogger is debug middleware logging request and response bodies. It can
+// be switched on and off at runtime.
+type BodyLogger struct {
+	writer  logger.Writer
+	maxSize int
+	redact  map[string]bool
+	pattern *regexp.Regexp
+
+	// multipart matches the value of a redacted multipart form field.
+	multipart *regexp.Regexp
+	enabled   int32
+}
+
+// NewBodyLogger creates a BodyLogger from config.
+func NewBodyLogger(config BodyLoggerConfig) *BodyLogger {
+	b := &BodyLogger{
+		writer:  config.Writer,
+		maxSize: config.MaxBodySize,
+		redact:  map[string]bool{},
+	}
+
+	if b.writer == nil {
+		b.writer = log.New(os.Stdout, "", log.LstdFlags)
+	}
+
+	if b.maxSize <= 0 {
+		b.maxSize = 4096
+	}
+
+	fields := make([]string, 0, len(config.RedactFields))
+	for _, field := range config.RedactFields {
+		b.redact[strings.ToLower(field)] = true
+		fields = append(fields, regexp.QuoteMeta(field))
+	}
+
+	if len(fields) > 0 {
+		b.pattern = regexp.MustCompile(`(?i)("(?:` + strings.Join(fields, "|") + `)"\s*:\s*)("(?:[^"\\]|\\.)*"?|[^,}\]]*)`)
+		b.multipart = regexp.MustCompile(`(?is)(content-disposition:[^\r\n]*\bname="(?:` + strings.Join(fields, "|") + `)"[^\r\n]*\r\n(?:[^\r\n]+\r\n)*\r\n)(.*?)(\r\n--|$)`)
+	}
+
+	b.SetEnabled(config.Enabled)
+
+	return b
+}
+
+// SetEnabled switches body logging on or off.
+func (b *BodyLogger) SetEnabled(enabled bool) {
+	var value int32
+	if enabled {
+		value = 1
+	}
+	atomic.StoreInt32(&b.enabled, value)
+}
+
+// Enabled reports whether body logging is on.
+func (b *BodyLogger) Enabled() bool {
+	return atomic.LoadInt32(&b.enabled) == 1
+}
+
+// Middleware logs the bodies of requests passing through next while enabled.
+func (b *BodyLogger) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if !b.Enabled() {
+			next.ServeHTTP(rw, r)
+			return
+		}
+
+		request := &capturingReader{ReadCloser: r.Body, limit: b.maxSize}
+		if r.Body != nil {
+			r.Body = request
+		}
+
+		response := &capturingResponseWriter{ResponseWriter: rw, limit: b.maxSize, status: http.StatusOK}
+
+		next.ServeHTTP(response, r)
+
+		uri := r.URL.EscapedPath()
+		if r.URL.RawQuery != "" {
+			uri += "?" + b.redactForm(r.URL.RawQuery)
+		}
+
+		b.writer.Printf("%s %s status=%d request=%s response=%s",
+			r.Method, uri, response.status,
+			b.format(request.buf.Bytes(), request.truncated, r.Header.Get("Content-Type")),
+			b.format(response.buf.Bytes(), response.truncated, rw.Header().Get("Content-Type")))
+	})
+}
+
+// format redacts body according to its content type and marks it when
+// truncated.
+func (b *BodyLogger) format(body []byte, truncated bool, contentType string) string {
+	if len(body) == 0 {
+		return "-"
+	}
+
+	out := b.redactBody(body, contentType)
+	if truncated {
+		out += "...(truncated)"
+	}
+
+	return out
+}
+
+func (b *BodyLogger) redactBody(body []byte, contentType string) string {
+	if len(b.redact) == 0 {
+		return string(body)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/x-www-form-urlencoded":
+		return b.redactForm(string(body))
+	case strings.HasPrefix(mediaType, "multipart/"):
+		return b.multipart.ReplaceAllString(string(body), "${1}[REDACTED]${3}")
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err == nil {
+		if out, err := json.Marshal(b.redactValue(value)); err == nil {
+			return string(out)
+		}
+	}
+
+	// Not valid JSON, possibly because it was truncated; fall back to
+	// pattern matching.
+	return b.pattern.ReplaceAllString(string(body), `$1"[REDACTED]"`)
+}
+
+// redactForm redacts the values of URL-encoded pairs, keeping their order.
+// A truncated final pair is still redacted.
+func (b *BodyLogger) redactForm(form string) string {
+	if len(b.redact) == 0 {
+		return form
+	}
+
+	pairs := strings.Split(form, "&")
+	for i, pair := range pairs {
+		key := pair
+		if eq := strings.IndexByte(pair, '='); eq >= 0 {
+			key = pair[:eq]
+		}
+
+		name, err := url.QueryUnescape(key)
+		if err != nil {
+			name = key
+		}
+
+		if b.redact[strings.ToLower(name)] {
+			pairs[i] = key + "=[REDACTED]"
+		}
+	}
+
+	return strings.Join(pairs, "&")
+}
+
+func (b *BodyLogger) redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if b.redact[strings.ToLower(key)] {
+				v[key] = "[REDACTED]"
+			} else {
+				v[key] = b.redactValue(field)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = b.redactValue(item)
+		}
+	}
+	return value
+}
+
+// capturingReader records the first limit bytes read through it.
+type capturingReader struct {
+	io.ReadCloser
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (c *capturingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.truncated = capture(&c.buf, p[:n], c.limit) || c.truncated
+	return n, err
+}
+
+// capturingResponseWriter records the status and the first limit bytes
+// written through it.
+type capturingResponseWriter struct {
+	http.ResponseWriter
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+	status    int
+}
+
+func (c *capturingResponseWriter) WriteHeader(status int) {
+	c.status = status
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *capturingResponseWriter) Write(p []byte) (int, error) {
+	c.truncated = capture(&c.buf, p, c.limit) || c.truncated
+	return c.ResponseWriter.Write(p)
+}
+
+// capture appends p to buf up to limit bytes, reporting whether anything was
+// dropped.
+func capture(buf *bytes.Buffer, p []byte, limit int) bool {
+	room := limit - buf.Len()
+	if room <= 0 {
+		return len(p) > 0
+	}
+
+	if len(p) > room {
+		buf.Write(p[:room])
+		return true
+	}
+
+	buf.Write(p)
+	return false
+}
@@ -0,0 +1,63 @@
+package cservice
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type bufferWriter struct {
+	bytes.Buffer
+}
+
+func (w *bufferWriter) Printf(format string, args ...interface{}) {
+	fmt.Fprintf(&w.Buffer, format+"\n", args...)
+}
+
+func TestBodyLoggerRedacts(t *testing.T) {
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	mw.WriteField("user", "alice")
+	mw.WriteField("Password", "hunter2")
+	mw.Close()
+
+	tests := []struct {
+		name        string
+		target      string
+		contentType string
+		body        string
+	}{
+		{"json", "/login", "application/json", `{"user":"alice","auth":{"password":"hunter2"}}`},
+		{"form", "/login", "application/x-www-form-urlencoded", "user=alice&password=hunter2"},
+		{"multipart", "/login", mw.FormDataContentType(), form.String()},
+		{"query", "/login?user=alice&token=hunter2", "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out := &bufferWriter{}
+			logger := NewBodyLogger(BodyLoggerConfig{Writer: out, RedactFields: []string{"password", "token"}, Enabled: true})
+
+			handler := logger.Middleware(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				ioutil.ReadAll(r.Body)
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, test.target, strings.NewReader(test.body))
+			req.Header.Set("Content-Type", test.contentType)
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			line := out.String()
+			if strings.Contains(line, "hunter2") {
+				t.Errorf("secret logged: %s", line)
+			}
+			if !strings.Contains(line, "alice") || !strings.Contains(line, "[REDACTED]") {
+				t.Errorf("unexpected log line: %s", line)
+			}
+		})
+	}
+}
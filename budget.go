@@ -0,0 +1,52 @@
+package cservice
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// BudgetReporter is called when a request exceeds its latency budget.
+type BudgetReporter func(r *http.Request, elapsed, budget time.Duration)
+
+var budgetReporter atomic.Value
+
+// SetBudgetReporter sets the function told about requests exceeding their
+// latency budget, e.g. to record a metric. By default a warning is logged to
+// stdout.
+func SetBudgetReporter(reporter BudgetReporter) {
+	budgetReporter.Store(reporter)
+}
+
+// Budget returns middleware which reports requests taking longer than
+// budget to handle. Apply it per route to declare each route's latency
+// objective. Requests are not interrupted.
+func Budget(budget time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			next.ServeHTTP(rw, r)
+
+			if elapsed := time.Since(start); elapsed > budget {
+				reporter, _ := budgetReporter.Load().(BudgetReporter)
+				if reporter == nil {
+					reporter = logBudgetExceeded
+				}
+				reporter(r, elapsed, budget)
+			}
+		})
+	}
+}
+
+var budgetLogger = log.New(os.Stdout, "", log.LstdFlags)
+
+func logBudgetExceeded(r *http.Request, elapsed, budget time.Duration) {
+	prefix := ""
+	if id := RequestID(r.Context()); id != "" {
+		prefix = "[request_id:" + id + "] "
+	}
+
+	budgetLogger.Printf("%s[budget] %s %s took %s, over its %s budget", prefix, r.Method, r.URL.Path, elapsed, budget)
+}
@@ -0,0 +1,65 @@
+package cservice
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBudget(t *testing.T) {
+	t.Cleanup(func() { SetBudgetReporter(nil) })
+
+	type report struct {
+		path            string
+		elapsed, budget time.Duration
+	}
+	var reports []report
+	SetBudgetReporter(func(r *http.Request, elapsed, budget time.Duration) {
+		reports = append(reports, report{r.URL.Path, elapsed, budget})
+	})
+
+	slow := Budget(5 * time.Millisecond)(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		rw.WriteHeader(http.StatusAccepted)
+	}))
+	fast := Budget(time.Minute)(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+
+	fast.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/fast", nil))
+	if len(reports) != 0 {
+		t.Errorf("request within its budget was reported: %+v", reports)
+	}
+
+	rec := httptest.NewRecorder()
+	slow.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	if rec.Code != http.StatusAccepted {
+		t.Errorf("got %d, want the handler's response", rec.Code)
+	}
+	if len(reports) != 1 || reports[0].path != "/slow" || reports[0].budget != 5*time.Millisecond || reports[0].elapsed < 20*time.Millisecond {
+		t.Errorf("got reports %+v", reports)
+	}
+}
+
+func TestBudgetLogsByDefault(t *testing.T) {
+	var buf bytes.Buffer
+	saved := budgetLogger
+	budgetLogger = log.New(&buf, "", 0)
+	t.Cleanup(func() { budgetLogger = saved })
+	SetBudgetReporter(nil)
+
+	handler := Budget(time.Nanosecond)(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond)
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/orders", nil)
+	req = req.WithContext(WithRequestID(req.Context(), "req-1"))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	line := buf.String()
+	if !strings.HasPrefix(line, "[request_id:req-1] [budget] POST /orders took ") || !strings.Contains(line, "over its 1ns budget") {
+		t.Errorf("got log %q", line)
+	}
+}
@@ -0,0 +1,61 @@
+package cservice
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DefaultBulkBatchSize is the number of rows written per statement by Upsert,
+// and by BulkInsert when batchSize is not positive.
+const DefaultBulkBatchSize = 500
+
+// BulkInsert inserts rows in multi-row INSERT statements of batchSize rows,
+// or DefaultBulkBatchSize if batchSize is not positive, all in one
+// transaction unless the session skips default transactions. Primary keys
+// generated by the database are written back to rows.
+func BulkInsert[T any](db *gorm.DB, rows []T, batchSize int) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	if batchSize <= 0 {
+		batchSize = DefaultBulkBatchSize
+	}
+
+	return db.CreateInBatches(&rows, batchSize).Error
+}
+
+// Upsert inserts rows, updating updateColumns of rows which conflict on
+// conflictColumns. An empty updateColumns updates every column but the
+// primary key. The dialect produces the statement: ON DUPLICATE KEY UPDATE
+// on MySQL, which ignores conflictColumns in favour of the table's unique
+// keys, and ON CONFLICT elsewhere. Rows are written in batches of
+// DefaultBulkBatchSize.
+func Upsert[T any](db *gorm.DB, rows []T, conflictColumns, updateColumns []string) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	onConflict := clause.OnConflict{}
+
+	for _, column := range conflictColumns {
+		if err := validateIdentifier("column", column); err != nil {
+			return err
+		}
+		onConflict.Columns = append(onConflict.Columns, clause.Column{Name: column})
+	}
+
+	for _, column := range updateColumns {
+		if err := validateIdentifier("column", column); err != nil {
+			return err
+		}
+	}
+
+	if len(updateColumns) == 0 {
+		onConflict.UpdateAll = true
+	} else {
+		onConflict.DoUpdates = clause.AssignmentColumns(updateColumns)
+	}
+
+	return db.Clauses(onConflict).CreateInBatches(&rows, DefaultBulkBatchSize).Error
+}
@@ -0,0 +1,69 @@
+package cservice
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/crockerio/cservice/cservicetest"
+)
+
+type bulkProduct struct {
+	ID    uint
+	SKU   string `gorm:"size:32;uniqueIndex"`
+	Name  string
+	Stock int
+}
+
+func TestBulkInsertDefaultsBatchSize(t *testing.T) {
+	db := cservicetest.OpenDB(t, &bulkProduct{})
+
+	rows := make([]bulkProduct, 1200)
+	for i := range rows {
+		rows[i].SKU = fmt.Sprintf("sku-%d", i)
+	}
+
+	if err := BulkInsert(db, rows, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	var count int64
+	db.Model(&bulkProduct{}).Count(&count)
+	if count != int64(len(rows)) {
+		t.Errorf("inserted %d rows, want %d", count, len(rows))
+	}
+}
+
+func TestUpsert(t *testing.T) {
+	db := cservicetest.OpenDB(t, &bulkProduct{})
+
+	if err := BulkInsert(db, []bulkProduct{{SKU: "a", Name: "Apple", Stock: 1}}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	rows := []bulkProduct{{SKU: "a", Name: "Apricot", Stock: 5}, {SKU: "b", Name: "Banana", Stock: 2}}
+	if err := Upsert(db, rows, []string{"sku"}, []string{"stock"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var products []bulkProduct
+	db.Order("sku").Find(&products)
+	if len(products) != 2 {
+		t.Fatalf("got %d products, want 2", len(products))
+	}
+
+	if products[0].Name != "Apple" || products[0].Stock != 5 {
+		t.Errorf("conflicting row got %+v, want only stock updated", products[0])
+	}
+	if products[1].Name != "Banana" || products[1].Stock != 2 {
+		t.Errorf("new row got %+v", products[1])
+	}
+}
+
+func TestUpsertRejectsInvalidColumns(t *testing.T) {
+	db := cservicetest.OpenDB(t, &bulkProduct{})
+
+	err := Upsert(db, []bulkProduct{{SKU: "a"}}, []string{"sku"}, []string{"stock; DROP TABLE bulk_products"})
+	if err == nil {
+		t.Error("expected an error for an invalid column")
+	}
+}
@@ -0,0 +1,151 @@
+package cservice
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// BusHandler handles a command or query dispatched on a Bus. Commands return
+// a nil result.
+type BusHandler func(ctx context.Context, message interface{}) (interface{}, error)
+
+// BusMiddleware wraps every handler on a Bus, e.g. to validate messages or
+// run handlers in a transaction.
+type BusMiddleware func(next BusHandler) BusHandler
+
+// Bus dispatches commands and queries to the handler registered for their
+// type.
+type Bus struct {
+	middleware []BusMiddleware
+
+	mu       sync.RWMutex
+	handlers map[reflect.Type]BusHandler
+}
+
+// NewBus creates a Bus which wraps handlers in middleware, the first being
+// outermost.
+func NewBus(middleware ...BusMiddleware) *Bus {
+	return &Bus{middleware: middleware, handlers: map[reflect.Type]BusHandler{}}
+}
+
+// HandleCommand registers handler for commands of type C, replacing any
+// existing handler.
+func HandleCommand[C any](bus *Bus, handler func(ctx context.Context, command C) error) {
+	bus.register(reflect.TypeOf((*C)(nil)).Elem(), func(ctx context.Context, message interface{}) (interface{}, error) {
+		return nil, handler(ctx, message.(C))
+	})
+}
+
+// HandleQuery registers handler for queries of type Q, replacing any existing
+// handler.
+func HandleQuery[Q, R any](bus *Bus, handler func(ctx context.Context, query Q) (R, error)) {
+	bus.register(reflect.TypeOf((*Q)(nil)).Elem(), func(ctx context.Context, message interface{}) (interface{}, error) {
+		return handler(ctx, message.(Q))
+	})
+}
+
+// Send dispatches command to its handler.
+func (b *Bus) Send(ctx context.Context, command interface{}) error {
+	_, err := b.dispatch(ctx, command)
+	return err
+}
+
+// Ask dispatches query on bus and returns its handler's result.
+func Ask[R any](ctx context.Context, bus *Bus, query interface{}) (R, error) {
+	var zero R
+
+	result, err := bus.dispatch(ctx, query)
+	if err != nil {
+		return zero, err
+	}
+
+	r, ok := result.(R)
+	if !ok && result != nil {
+		return zero, fmt.Errorf("cservice: query %T returned %T, not %T", query, result, zero)
+	}
+
+	return r, nil
+}
+
+func (b *Bus) register(t reflect.Type, handler BusHandler) {
+	for i := len(b.middleware) - 1; i >= 0; i-- {
+		handler = b.middleware[i](handler)
+	}
+
+	b.mu.Lock()
+	b.handlers[t] = handler
+	b.mu.Unlock()
+}
+
+func (b *Bus) dispatch(ctx context.Context, message interface{}) (interface{}, error) {
+	b.mu.RLock()
+	handler, ok := b.handlers[reflect.TypeOf(message)]
+	b.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("cservice: no handler registered for %T", message)
+	}
+
+	return handler(ctx, message)
+}
+
+// ValidateMessages is BusMiddleware which rejects messages with a
+// Validate() error method that returns an error.
+func ValidateMessages(next BusHandler) BusHandler {
+	return func(ctx context.Context, message interface{}) (interface{}, error) {
+		if validator, ok := message.(interface{ Validate() error }); ok {
+			if err := validator.Validate(); err != nil {
+				return nil, err
+			}
+		}
+		return next(ctx, message)
+	}
+}
+
+// TransactionalMessages returns BusMiddleware which runs each handler in a
+// transaction on db, committed if the handler succeeds. Handlers reach the
+// transaction with DB(ctx).
+func TransactionalMessages(db *gorm.DB) BusMiddleware {
+	return func(next BusHandler) BusHandler {
+		return func(ctx context.Context, message interface{}) (interface{}, error) {
+			var result interface{}
+			err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+				var err error
+				result, err = next(WithDB(ctx, tx), message)
+				return err
+			})
+			return result, err
+		}
+	}
+}
+
+// LogMessages returns BusMiddleware which logs each message's type, duration
+// and error to writer, which defaults to stdout.
+func LogMessages(writer logger.Writer) BusMiddleware {
+	if writer == nil {
+		writer = log.New(os.Stdout, "", log.LstdFlags)
+	}
+
+	return func(next BusHandler) BusHandler {
+		return func(ctx context.Context, message interface{}) (interface{}, error) {
+			start := time.Now()
+			result, err := next(ctx, message)
+
+			prefix := ""
+			if id := RequestID(ctx); id != "" {
+				prefix = "[request_id:" + id + "] "
+			}
+			writer.Printf("%s[bus] %T took %s err=%v", prefix, message, time.Since(start), err)
+
+			return result, err
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package cservice
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/crockerio/cservice/cservicetest"
+)
+
+type createOrder struct {
+	Item string
+}
+
+func (c createOrder) Validate() error {
+	if c.Item == "" {
+		return errors.New("item is required")
+	}
+	return nil
+}
+
+type countOrders struct{}
+
+type busOrder struct {
+	ID   uint
+	Item string
+}
+
+func TestBusDispatch(t *testing.T) {
+	ctx := context.Background()
+
+	var trace []string
+	tracing := func(name string) BusMiddleware {
+		return func(next BusHandler) BusHandler {
+			return func(ctx context.Context, message interface{}) (interface{}, error) {
+				trace = append(trace, name)
+				return next(ctx, message)
+			}
+		}
+	}
+
+	bus := NewBus(tracing("outer"), tracing("inner"), ValidateMessages)
+
+	var orders []string
+	HandleCommand(bus, func(ctx context.Context, command createOrder) error {
+		orders = append(orders, command.Item)
+		return nil
+	})
+	HandleQuery(bus, func(ctx context.Context, query countOrders) (int, error) {
+		return len(orders), nil
+	})
+
+	if err := bus.Send(ctx, createOrder{Item: "book"}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(trace, ",") != "outer,inner" {
+		t.Errorf("middleware ran in order %v", trace)
+	}
+
+	if err := bus.Send(ctx, createOrder{}); err == nil || err.Error() != "item is required" {
+		t.Errorf("invalid command: got %v", err)
+	}
+	if len(orders) != 1 {
+		t.Errorf("invalid command reached its handler: %v", orders)
+	}
+
+	count, err := Ask[int](ctx, bus, countOrders{})
+	if err != nil || count != 1 {
+		t.Errorf("Ask: got %d, %v", count, err)
+	}
+
+	if _, err := Ask[string](ctx, bus, countOrders{}); err == nil {
+		t.Error("Ask with the wrong result type: no error")
+	}
+
+	if err := bus.Send(ctx, &createOrder{Item: "pen"}); err == nil {
+		t.Error("message of an unregistered type: no error")
+	}
+}
+
+func TestTransactionalMessages(t *testing.T) {
+	conn := cservicetest.OpenDB(t, &busOrder{})
+	bus := NewBus(TransactionalMessages(conn))
+
+	failure := errors.New("payment declined")
+	HandleCommand(bus, func(ctx context.Context, command createOrder) error {
+		if err := DB(ctx).Create(&busOrder{Item: command.Item}).Error; err != nil {
+			return err
+		}
+		if command.Item == "declined" {
+			return failure
+		}
+		return nil
+	})
+
+	if err := bus.Send(context.Background(), createOrder{Item: "book"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Send(context.Background(), createOrder{Item: "declined"}); !errors.Is(err, failure) {
+		t.Errorf("got %v, want the handler's error", err)
+	}
+
+	var items []string
+	if err := conn.Model(&busOrder{}).Pluck("item", &items).Error; err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(items, ",") != "book" {
+		t.Errorf("got orders %v, want the failed command rolled back", items)
+	}
+}
+
+func TestLogMessages(t *testing.T) {
+	var w bufferWriter
+	bus := NewBus(LogMessages(&w))
+	HandleCommand(bus, func(ctx context.Context, command createOrder) error {
+		return errors.New("out of stock")
+	})
+
+	ctx := WithRequestID(context.Background(), "req-1")
+	bus.Send(ctx, createOrder{Item: "book"})
+
+	line := w.String()
+	for _, want := range []string{"[request_id:req-1] ", "[bus] cservice.createOrder took ", "err=out of stock"} {
+		if !strings.Contains(line, want) {
+			t.Errorf("log %q does not contain %q", line, want)
+		}
+	}
+}
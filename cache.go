@@ -0,0 +1,127 @@
+package cservice
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// Cache stores values by key for a limited time.
+type Cache interface {
+	// Get returns the value stored under key, if present and not expired.
+	Get(ctx context.Context, key string) (interface{}, bool)
+
+	// Set stores value under key for ttl.
+	Set(ctx context.Context, key string, value interface{}, ttl time.Duration)
+
+	// Delete removes the value stored under key.
+	Delete(ctx context.Context, key string)
+}
+
+// MemoryCacheConfig defines the limits of a MemoryCache.
+type MemoryCacheConfig struct {
+	// MaxEntries caps the number of values stored. Once it is reached, the
+	// least recently used value is evicted. Defaults to 10000.
+	MaxEntries int
+
+	// Clock provides the current time. Defaults to SystemClock.
+	Clock Clock
+}
+
+type memoryCacheEntry struct {
+	key       string
+	value     interface{}
+	expiresAt time.Time
+}
+
+// MemoryCache is an in-process Cache evicting the least recently used values
+// once full.
+type MemoryCache struct {
+	mu         sync.Mutex
+	entries    map[string]*list.Element
+	order      *list.List
+	maxEntries int
+	clock      Clock
+}
+
+// NewMemoryCache creates an empty MemoryCache from config.
+func NewMemoryCache(config MemoryCacheConfig) *MemoryCache {
+	if config.MaxEntries <= 0 {
+		config.MaxEntries = 10000
+	}
+
+	return &MemoryCache{
+		entries:    map[string]*list.Element{},
+		order:      list.New(),
+		maxEntries: config.MaxEntries,
+		clock:      clockOrSystem(config.Clock),
+	}
+}
+
+// Get returns the value stored under key.
+func (c *MemoryCache) Get(ctx context.Context, key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := element.Value.(*memoryCacheEntry)
+	if c.clock.Now().After(entry.expiresAt) {
+		c.remove(element)
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+
+	return entry.value, true
+}
+
+// Set stores value under key for ttl.
+func (c *MemoryCache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiresAt := c.clock.Now().Add(ttl)
+
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*memoryCacheEntry)
+		entry.value = value
+		entry.expiresAt = expiresAt
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&memoryCacheEntry{key: key, value: value, expiresAt: expiresAt})
+
+	for c.order.Len() > c.maxEntries {
+		c.remove(c.order.Back())
+	}
+}
+
+// Delete removes the value stored under key.
+func (c *MemoryCache) Delete(ctx context.Context, key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+}
+
+// Len returns the number of values stored, including expired values not yet
+// evicted.
+func (c *MemoryCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+func (c *MemoryCache) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*memoryCacheEntry).key)
+}
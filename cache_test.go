@@ -0,0 +1,80 @@
+package cservice
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/crockerio/cservice/cservicetest"
+	"gorm.io/gorm"
+)
+
+func TestMemoryCache(t *testing.T) {
+	ctx := context.Background()
+	clock := NewFakeClock(time.Unix(0, 0))
+	cache := NewMemoryCache(MemoryCacheConfig{MaxEntries: 2, Clock: clock})
+
+	cache.Set(ctx, "a", 1, time.Minute)
+	cache.Set(ctx, "b", 2, time.Minute)
+	cache.Get(ctx, "a")
+	cache.Set(ctx, "c", 3, time.Minute)
+
+	if _, ok := cache.Get(ctx, "b"); ok {
+		t.Error("least recently used value was not evicted")
+	}
+	if value, ok := cache.Get(ctx, "a"); !ok || value != 1 {
+		t.Errorf("a: got %v, %v", value, ok)
+	}
+	if cache.Len() != 2 {
+		t.Errorf("got %d entries, want 2", cache.Len())
+	}
+
+	clock.Advance(2 * time.Minute)
+	if _, ok := cache.Get(ctx, "c"); ok {
+		t.Error("expired value was returned")
+	}
+	if cache.Len() != 1 {
+		t.Errorf("expired value was not removed, %d entries", cache.Len())
+	}
+}
+
+type cachedWidget struct {
+	ID   uint
+	Name string
+}
+
+func TestRepositoryCache(t *testing.T) {
+	ctx := context.Background()
+	conn := cservicetest.OpenDB(t, &cachedWidget{})
+	repo := NewRepository[cachedWidget](conn).WithCache(NewMemoryCache(MemoryCacheConfig{}), time.Minute)
+
+	widget := &cachedWidget{Name: "sprocket"}
+	if err := repo.Create(ctx, widget); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.FindByID(ctx, widget.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Writes bypassing the repository are not seen until the entry expires.
+	conn.Model(widget).Update("name", "gear")
+	if found, _ := repo.FindByID(ctx, widget.ID); found.Name != "sprocket" {
+		t.Errorf("got %q, want the cached record", found.Name)
+	}
+
+	widget.Name = "cog"
+	if err := repo.Update(ctx, widget); err != nil {
+		t.Fatal(err)
+	}
+	if found, _ := repo.FindByID(ctx, widget.ID); found.Name != "cog" {
+		t.Errorf("got %q after update", found.Name)
+	}
+
+	if err := repo.Delete(ctx, widget.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.FindByID(ctx, widget.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("got %v after delete", err)
+	}
+}
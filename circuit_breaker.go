@@ -0,0 +1,118 @@
+package cservice
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned when a call is rejected by an open
+// CircuitBreaker.
+var ErrCircuitOpen = errors.New("cservice: circuit breaker is open")
+
+// CircuitBreaker stops calls to a failing dependency after a number of
+// consecutive failures. Once the cooldown has elapsed the breaker is half
+// open: a single probe call is allowed, closing the breaker if it succeeds
+// and reopening it if it fails.
+type CircuitBreaker struct {
+	// Threshold is the number of consecutive failures which opens the
+	// breaker.
+	Threshold int
+
+	// Cooldown is how long the breaker stays open before allowing a probe
+	// call.
+	Cooldown time.Duration
+
+	// Clock provides the current time. Defaults to SystemClock.
+	Clock Clock
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+
+	// probing is set while the half open breaker's probe call is in flight.
+	probing   bool
+	probeSent time.Time
+}
+
+// NewCircuitBreaker creates a CircuitBreaker which opens after threshold
+// consecutive failures and stays open for cooldown.
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{Threshold: threshold, Cooldown: cooldown}
+}
+
+// Allow returns ErrCircuitOpen if the breaker is open, or nil if a call may be
+// made. Every allowed call must be followed by Success or Failure. A probe
+// which never reports back is replaced by another after a further cooldown.
+func (cb *CircuitBreaker) Allow() error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if !cb.isOpen() {
+		return nil
+	}
+
+	now := clockOrSystem(cb.Clock).Now()
+	if now.Sub(cb.openedAt) < cb.Cooldown {
+		return ErrCircuitOpen
+	}
+
+	if cb.probing && now.Sub(cb.probeSent) < cb.Cooldown {
+		return ErrCircuitOpen
+	}
+
+	cb.probing = true
+	cb.probeSent = now
+
+	return nil
+}
+
+// Success records a successful call, closing the breaker.
+func (cb *CircuitBreaker) Success() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.failures = 0
+	cb.openedAt = time.Time{}
+	cb.probing = false
+}
+
+// Failure records a failed call, opening the breaker once the threshold is
+// reached. A failed probe reopens the breaker for another cooldown.
+func (cb *CircuitBreaker) Failure() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.failures++
+	cb.probing = false
+	if cb.isOpen() {
+		cb.openedAt = clockOrSystem(cb.Clock).Now()
+	}
+}
+
+// retryIn returns how long until the breaker next allows a call.
+func (cb *CircuitBreaker) retryIn() time.Duration {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if !cb.isOpen() {
+		return 0
+	}
+
+	now := clockOrSystem(cb.Clock).Now()
+	wait := cb.Cooldown - now.Sub(cb.openedAt)
+	if cb.probing {
+		if probeWait := cb.Cooldown - now.Sub(cb.probeSent); probeWait > wait {
+			wait = probeWait
+		}
+	}
+
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+func (cb *CircuitBreaker) isOpen() bool {
+	return cb.Threshold > 0 && cb.failures >= cb.Threshold
+}
@@ -0,0 +1,62 @@
+package cservice
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	cb := &CircuitBreaker{Threshold: 2, Cooldown: time.Minute, Clock: clock}
+
+	cb.Failure()
+	if err := cb.Allow(); err != nil {
+		t.Fatalf("below threshold: %v", err)
+	}
+	cb.Failure()
+	if err := cb.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("open: got %v", err)
+	}
+
+	clock.Advance(time.Minute)
+	if err := cb.Allow(); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if err := cb.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("second call while probing: got %v", err)
+	}
+
+	cb.Failure()
+	if err := cb.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("after failed probe: got %v", err)
+	}
+
+	clock.Advance(time.Minute)
+	if err := cb.Allow(); err != nil {
+		t.Fatalf("second probe: %v", err)
+	}
+	cb.Success()
+	for i := 0; i < 3; i++ {
+		if err := cb.Allow(); err != nil {
+			t.Fatalf("closed: %v", err)
+		}
+	}
+}
+
+func TestCircuitBreakerLostProbe(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	cb := &CircuitBreaker{Threshold: 1, Cooldown: time.Minute, Clock: clock}
+
+	cb.Failure()
+	clock.Advance(time.Minute)
+	if err := cb.Allow(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The probe never reports back.
+	clock.Advance(time.Minute)
+	if err := cb.Allow(); err != nil {
+		t.Fatalf("replacement probe: %v", err)
+	}
+}
@@ -0,0 +1,225 @@
+package cservice
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RequestIDHeader carries the request ID between services.
+const RequestIDHeader = "X-Request-ID"
+
+// ClientConfig defines how a Client calls another service.
+type ClientConfig struct {
+	// BaseURL is prefixed to request paths, e.g. "http://users.internal".
+	BaseURL string
+
+	// Timeout limits each attempt, including reading the response body.
+	// Defaults to 10 seconds.
+	Timeout time.Duration
+
+	// Retries is the number of times a failed idempotent request is
+	// retried. Requests are retried after connection errors and 429, 502,
+	// 503 and 504 responses.
+	Retries int
+
+	// RetryDelay is the delay before the first retry, doubling for each
+	// subsequent retry. Defaults to 100 milliseconds.
+	RetryDelay time.Duration
+
+	// CircuitBreaker, if set, stops calls after repeated connection errors
+	// or 5xx responses.
+	CircuitBreaker *CircuitBreaker
+
+	// Transport makes the requests. Defaults to http.DefaultTransport.
+	Transport http.RoundTripper
+
+	// BeforeRequest is called on every attempt before it is sent, e.g. to
+	// add tracing or authentication headers.
+	BeforeRequest func(req *http.Request)
+}
+
+// HTTPError is returned by Client.JSON for non-2xx responses.
+type HTTPError struct {
+	StatusCode int
+	Status     string
+
+	// Body is the start of the response body.
+	Body []byte
+}
+
+// Error describes the response.
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("cservice: service responded %s: %s", e.Status, e.Body)
+}
+
+// Client calls another service with retries, a circuit breaker and request
+// ID propagation.
+type Client struct {
+	config ClientConfig
+	client *http.Client
+}
+
+// NewClient creates a Client from config.
+func NewClient(config ClientConfig) *Client {
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+
+	if config.RetryDelay <= 0 {
+		config.RetryDelay = 100 * time.Millisecond
+	}
+
+	config.BaseURL = strings.TrimRight(config.BaseURL, "/")
+
+	return &Client{
+		config: config,
+		client: &http.Client{Timeout: config.Timeout, Transport: config.Transport},
+	}
+}
+
+// NewRequest creates a request for path relative to the base URL. The
+// request ID stored in ctx is sent in the X-Request-ID header.
+func (c *Client) NewRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.config.BaseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if id := RequestID(ctx); id != "" {
+		req.Header.Set(RequestIDHeader, id)
+	}
+
+	return req, nil
+}
+
+// Do sends req, retrying idempotent requests as configured. Bodies of
+// retried requests are replayed with req.GetBody, which http.NewRequest sets
+// for in-memory bodies.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	retries := c.config.Retries
+	if !isIdempotent(req.Method) || (req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) {
+		retries = 0
+	}
+
+	delay := c.config.RetryDelay
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(delay):
+			case <-req.Context().Done():
+				return nil, req.Context().Err()
+			}
+			delay *= 2
+
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				req.Body = body
+			}
+		}
+
+		resp, err := c.attempt(req)
+		if attempt >= retries || !shouldRetry(resp, err) || req.Context().Err() != nil {
+			return resp, err
+		}
+
+		if resp != nil {
+			io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+		}
+	}
+}
+
+func (c *Client) attempt(req *http.Request) (*http.Response, error) {
+	if breaker := c.config.CircuitBreaker; breaker != nil {
+		if err := breaker.Allow(); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.config.BeforeRequest != nil {
+		c.config.BeforeRequest(req)
+	}
+
+	resp, err := c.client.Do(req)
+
+	if breaker := c.config.CircuitBreaker; breaker != nil {
+		if err != nil || resp.StatusCode >= 500 {
+			breaker.Failure()
+		} else {
+			breaker.Success()
+		}
+	}
+
+	return resp, err
+}
+
+// JSON sends in, if not nil, as a JSON request body and decodes the response
+// into out, if not nil. Non-2xx responses are returned as an *HTTPError.
+func (c *Client) JSON(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		encoded, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(encoded)
+	}
+
+	req, err := c.NewRequest(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		snippet, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &HTTPError{StatusCode: resp.StatusCode, Status: resp.Status, Body: snippet}
+	}
+
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, ErrCircuitOpen)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,184 @@
+package cservice
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// scriptedServer answers with each status in turn, repeating the last, and
+// records the bodies it receives.
+type scriptedServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	bodies   []string
+	headers  []http.Header
+}
+
+func newScriptedServer(t *testing.T, statuses ...int) *scriptedServer {
+	s := &scriptedServer{statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		s.mu.Lock()
+		status := s.statuses[0]
+		if len(s.statuses) > 1 {
+			s.statuses = s.statuses[1:]
+		}
+		s.bodies = append(s.bodies, string(body))
+		s.headers = append(s.headers, r.Header.Clone())
+		s.mu.Unlock()
+
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(status)
+		rw.Write([]byte(`{"name":"alice"}`))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *scriptedServer) attempts() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.bodies)
+}
+
+func TestClientRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		in       interface{}
+		statuses []int
+		attempts int
+		status   int
+	}{
+		{"GET retried until success", http.MethodGet, nil, []int{503, 502, 200}, 3, 200},
+		{"GET gives up after Retries", http.MethodGet, nil, []int{503}, 3, 503},
+		{"PUT retried with its body", http.MethodPut, map[string]string{"name": "alice"}, []int{429, 200}, 2, 200},
+		{"POST is not retried", http.MethodPost, map[string]string{"name": "alice"}, []int{503, 200}, 1, 503},
+		{"500 is not retried", http.MethodGet, nil, []int{500, 200}, 1, 500},
+		{"client errors are not retried", http.MethodDelete, nil, []int{404, 200}, 1, 404},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newScriptedServer(t, tt.statuses...)
+			client := NewClient(ClientConfig{BaseURL: server.URL + "/", Retries: 2, RetryDelay: time.Millisecond})
+
+			var out struct{ Name string }
+			err := client.JSON(context.Background(), tt.method, "/users/1", tt.in, &out)
+
+			var httpErr *HTTPError
+			switch {
+			case tt.status == 200 && (err != nil || out.Name != "alice"):
+				t.Errorf("got %+v, %v", out, err)
+			case tt.status != 200 && (!errors.As(err, &httpErr) || httpErr.StatusCode != tt.status):
+				t.Errorf("got %v, want HTTP %d", err, tt.status)
+			}
+
+			if server.attempts() != tt.attempts {
+				t.Errorf("got %d attempts, want %d", server.attempts(), tt.attempts)
+			}
+			if tt.in != nil {
+				for i, body := range server.bodies {
+					if body != `{"name":"alice"}` {
+						t.Errorf("attempt %d sent body %q", i+1, body)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestClientRequestHeaders(t *testing.T) {
+	server := newScriptedServer(t, 503, 204)
+
+	calls := 0
+	client := NewClient(ClientConfig{
+		BaseURL:    server.URL,
+		Retries:    1,
+		RetryDelay: time.Millisecond,
+		BeforeRequest: func(req *http.Request) {
+			calls++
+			req.Header.Set("Authorization", "Bearer token")
+		},
+	})
+
+	ctx := WithRequestID(context.Background(), "req-1")
+	if err := client.JSON(ctx, http.MethodGet, "/ping", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if calls != 2 {
+		t.Errorf("BeforeRequest called %d times, want once per attempt", calls)
+	}
+	for i, header := range server.headers {
+		if header.Get(RequestIDHeader) != "req-1" || header.Get("Authorization") != "Bearer token" || header.Get("Accept") != "application/json" {
+			t.Errorf("attempt %d sent headers %v", i+1, header)
+		}
+	}
+}
+
+func TestClientCircuitBreaker(t *testing.T) {
+	server := newScriptedServer(t, 503)
+	clock := NewFakeClock(time.Unix(0, 0))
+	breaker := &CircuitBreaker{Threshold: 2, Cooldown: time.Minute, Clock: clock}
+	client := NewClient(ClientConfig{BaseURL: server.URL, Retries: 5, RetryDelay: time.Millisecond, CircuitBreaker: breaker})
+
+	// The breaker opens part way through the retries, which then stop.
+	if err := client.JSON(context.Background(), http.MethodGet, "/", nil, nil); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("got %v, want ErrCircuitOpen", err)
+	}
+	if server.attempts() != 2 {
+		t.Errorf("got %d attempts, want 2", server.attempts())
+	}
+
+	if err := client.JSON(context.Background(), http.MethodGet, "/", nil, nil); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("while open: got %v", err)
+	}
+	if server.attempts() != 2 {
+		t.Error("a request was sent while the breaker was open")
+	}
+
+	// After the cooldown a single probe is sent, and its success closes the
+	// breaker.
+	server.mu.Lock()
+	server.statuses = []int{200}
+	server.mu.Unlock()
+	clock.Advance(time.Minute)
+
+	if err := client.JSON(context.Background(), http.MethodGet, "/", nil, nil); err != nil {
+		t.Errorf("probe: got %v", err)
+	}
+	if err := breaker.Allow(); err != nil {
+		t.Errorf("after a successful probe: got %v", err)
+	}
+	breaker.Success()
+}
+
+func TestClientRetryHonoursContext(t *testing.T) {
+	server := newScriptedServer(t, 503)
+	client := NewClient(ClientConfig{BaseURL: server.URL, Retries: 3, RetryDelay: time.Hour})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err := client.JSON(ctx, http.MethodGet, "/", nil, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("retry waited %s after the context ended", elapsed)
+	}
+	if server.attempts() != 1 {
+		t.Errorf("got %d attempts", server.attempts())
+	}
+}
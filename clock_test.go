@@ -0,0 +1,115 @@
+package cservice
+
+import (
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+
+	if !clock.Now().Equal(start) {
+		t.Errorf("got %s, want %s", clock.Now(), start)
+	}
+
+	clock.Advance(90 * time.Minute)
+	if want := start.Add(90 * time.Minute); !clock.Now().Equal(want) {
+		t.Errorf("after Advance got %s, want %s", clock.Now(), want)
+	}
+
+	clock.Set(start)
+	if !clock.Now().Equal(start) {
+		t.Errorf("after Set got %s, want %s", clock.Now(), start)
+	}
+
+	if clockOrSystem(nil) != SystemClock || clockOrSystem(clock) != clock {
+		t.Error("clockOrSystem did not default to SystemClock")
+	}
+}
+
+func TestFakeClockAfter(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+
+	soon, later := clock.After(time.Second), clock.After(time.Minute)
+	if clock.Waiters() != 2 {
+		t.Errorf("got %d waiters, want 2", clock.Waiters())
+	}
+
+	clock.Advance(time.Second)
+	select {
+	case now := <-soon:
+		if !now.Equal(time.Unix(1, 0)) {
+			t.Errorf("got %s", now)
+		}
+	default:
+		t.Error("waiter due after a second did not fire")
+	}
+	select {
+	case <-later:
+		t.Error("waiter due after a minute fired early")
+	default:
+	}
+
+	clock.Set(time.Unix(60, 0))
+	select {
+	case <-later:
+	default:
+		t.Error("waiter did not fire when the clock was set past its deadline")
+	}
+
+	select {
+	case <-clock.After(0):
+	default:
+		t.Error("zero wait did not fire immediately")
+	}
+	if clock.Waiters() != 0 {
+		t.Errorf("got %d waiters after firing", clock.Waiters())
+	}
+}
+
+func TestDatabaseClockStampsTimestamps(t *testing.T) {
+	type stamped struct {
+		ID        uint
+		CreatedAt time.Time
+		UpdatedAt time.Time
+	}
+
+	open, saved := openDatabase, db
+	t.Cleanup(func() { openDatabase, db = open, saved })
+	openDatabase = func(dsn string, config *gorm.Config) (*gorm.DB, error) {
+		config.Logger = logger.Discard
+		return gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), config)
+	}
+
+	clock := NewFakeClock(time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC))
+	if err := InitDatabase(&DatabaseConfig{Clock: clock, Location: time.UTC, Migrate: MigrateOff}); err != nil {
+		t.Fatal(err)
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		t.Cleanup(func() { sqlDB.Close() })
+	}
+	if err := db.AutoMigrate(&stamped{}); err != nil {
+		t.Fatal(err)
+	}
+
+	row := stamped{}
+	if err := db.Create(&row).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !row.CreatedAt.Equal(clock.Now()) {
+		t.Errorf("CreatedAt %s, want the clock's %s", row.CreatedAt, clock.Now())
+	}
+
+	clock.Advance(time.Hour)
+	if err := db.Model(&row).Update("id", row.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !row.UpdatedAt.Equal(clock.Now()) {
+		t.Errorf("UpdatedAt %s, want the clock's %s", row.UpdatedAt, clock.Now())
+	}
+}
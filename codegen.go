@@ -0,0 +1,211 @@
+package cservice
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/jinzhu/inflection"
+	"gorm.io/gorm"
+)
+
+// introspectedColumn is a row of information_schema.columns.
+type introspectedColumn struct {
+	TableName  string
+	ColumnName string
+	DataType   string
+	ColumnType string
+	IsNullable string
+	ColumnKey  string
+	Extra      string
+}
+
+// GenerateModels reads the schema of the current database and writes Go
+// struct definitions with GORM tags for each table to w, as a source file of
+// package packageName. It returns an error naming both sources if two tables,
+// or two columns of a table, map to the same Go identifier.
+func GenerateModels(db *gorm.DB, packageName string, w io.Writer) error {
+	var columns []introspectedColumn
+	err := db.Raw(`SELECT c.table_name AS table_name, c.column_name AS column_name, c.data_type AS data_type,
+			c.column_type AS column_type, c.is_nullable AS is_nullable, c.column_key AS column_key, c.extra AS extra
+		FROM information_schema.columns c
+		JOIN information_schema.tables t ON t.table_schema = c.table_schema AND t.table_name = c.table_name
+		WHERE c.table_schema = DATABASE() AND t.table_type = 'BASE TABLE'
+		ORDER BY c.table_name, c.ordinal_position`).Scan(&columns).Error
+	if err != nil {
+		return err
+	}
+
+	return generateModels(columns, packageName, w)
+}
+
+// generateModels writes the struct definitions for columns to w.
+func generateModels(columns []introspectedColumn, packageName string, w io.Writer) error {
+	tables := map[string][]introspectedColumn{}
+	var names []string
+	for _, column := range columns {
+		if _, ok := tables[column.TableName]; !ok {
+			names = append(names, column.TableName)
+		}
+		tables[column.TableName] = append(tables[column.TableName], column)
+	}
+	sort.Strings(names)
+
+	var body bytes.Buffer
+	usesTime := false
+	structs := map[string]string{}
+
+	for _, table := range names {
+		structName := goIdentifier(inflection.Singular(table))
+		if other, ok := structs[structName]; ok {
+			return fmt.Errorf("cservice: tables %s and %s both generate type %s", other, table, structName)
+		}
+		structs[structName] = table
+
+		// TableName is taken by the generated method.
+		fields := map[string]string{"TableName": "the TableName method"}
+
+		fmt.Fprintf(&body, "// %s is a row of the %s table.\n", structName, table)
+		fmt.Fprintf(&body, "type %s struct {\n", structName)
+
+		for _, column := range tables[table] {
+			fieldName := goIdentifier(column.ColumnName)
+			if other, ok := fields[fieldName]; ok {
+				return fmt.Errorf("cservice: %s.%s and %s both generate field %s.%s", table, column.ColumnName, other, structName, fieldName)
+			}
+			fields[fieldName] = table + "." + column.ColumnName
+
+			goType := goTypeOf(column)
+			if strings.HasSuffix(goType, "time.Time") {
+				usesTime = true
+			}
+
+			fmt.Fprintf(&body, "\t%s %s `gorm:\"%s\"`\n", fieldName, goType, gormTag(column))
+		}
+
+		fmt.Fprintf(&body, "}\n\n")
+		fmt.Fprintf(&body, "// TableName returns the name of the %s table.\n", table)
+		fmt.Fprintf(&body, "func (%s) TableName() string {\n\treturn %q\n}\n\n", structName, table)
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by cservice.GenerateModels. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&out, "package %s\n\n", packageName)
+	if usesTime {
+		fmt.Fprintf(&out, "import \"time\"\n\n")
+	}
+	out.Write(body.Bytes())
+
+	source, err := format.Source(out.Bytes())
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(source)
+	return err
+}
+
+// goTypeOf maps a column to the Go type of its struct field. Nullable columns
+// become pointers.
+func goTypeOf(column introspectedColumn) string {
+	columnType := strings.ToLower(column.ColumnType)
+	unsigned := strings.Contains(columnType, "unsigned")
+
+	var goType string
+	switch strings.ToLower(column.DataType) {
+	case "tinyint":
+		switch {
+		case strings.HasPrefix(columnType, "tinyint(1)"):
+			goType = "bool"
+		case unsigned:
+			goType = "uint8"
+		default:
+			goType = "int8"
+		}
+	case "smallint":
+		goType = "int16"
+		if unsigned {
+			goType = "uint16"
+		}
+	case "mediumint", "int", "integer":
+		goType = "int32"
+		if unsigned {
+			goType = "uint32"
+		}
+	case "bigint":
+		goType = "int64"
+		if unsigned {
+			goType = "uint64"
+		}
+	case "bit":
+		goType = "uint64"
+	case "float":
+		goType = "float32"
+	case "double", "real", "decimal", "numeric":
+		goType = "float64"
+	case "date", "datetime", "timestamp":
+		goType = "time.Time"
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob":
+		return "[]byte"
+	default:
+		goType = "string"
+	}
+
+	if column.IsNullable == "YES" {
+		return "*" + goType
+	}
+
+	return goType
+}
+
+// gormTag builds the gorm struct tag for a column.
+func gormTag(column introspectedColumn) string {
+	parts := []string{"column:" + column.ColumnName, "type:" + column.ColumnType}
+
+	if column.ColumnKey == "PRI" {
+		parts = append(parts, "primaryKey")
+	}
+
+	if strings.Contains(strings.ToLower(column.Extra), "auto_increment") {
+		parts = append(parts, "autoIncrement")
+	}
+
+	if column.IsNullable != "YES" && column.ColumnKey != "PRI" {
+		parts = append(parts, "not null")
+	}
+
+	return strings.Join(parts, ";")
+}
+
+// commonInitialisms are written in upper case in Go identifiers.
+var commonInitialisms = map[string]bool{
+	"API": true, "HTML": true, "HTTP": true, "ID": true, "IP": true,
+	"JSON": true, "SQL": true, "URL": true, "UUID": true, "XML": true,
+}
+
+// goIdentifier converts a snake_case name to an exported CamelCase
+// identifier.
+func goIdentifier(name string) string {
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	})
+
+	var sb strings.Builder
+	for _, word := range words {
+		if upper := strings.ToUpper(word); commonInitialisms[upper] {
+			sb.WriteString(upper)
+			continue
+		}
+		sb.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+
+	identifier := sb.String()
+	if identifier == "" || identifier[0] >= '0' && identifier[0] <= '9' {
+		identifier = "X" + identifier
+	}
+
+	return identifier
+}
@@ -0,0 +1,69 @@
+package cservice
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestGenerateModels(t *testing.T) {
+	columns := []introspectedColumn{
+		{TableName: "users", ColumnName: "id", DataType: "bigint", ColumnType: "bigint unsigned", IsNullable: "NO", ColumnKey: "PRI", Extra: "auto_increment"},
+		{TableName: "users", ColumnName: "email", DataType: "varchar", ColumnType: "varchar(191)", IsNullable: "NO"},
+		{TableName: "users", ColumnName: "created_at", DataType: "datetime", ColumnType: "datetime(3)", IsNullable: "YES"},
+	}
+
+	var out bytes.Buffer
+	if err := generateModels(columns, "models", &out); err != nil {
+		t.Fatal(err)
+	}
+
+	// Collapse gofmt's field alignment.
+	source := strings.Join(strings.Fields(out.String()), " ")
+	for _, want := range []string{"type User struct", "ID uint64", "Email string", "CreatedAt *time.Time", `return "users"`} {
+		if !strings.Contains(source, want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestGenerateModelsCollisions(t *testing.T) {
+	tests := []struct {
+		name    string
+		columns []introspectedColumn
+		want    string
+	}{
+		{
+			"types",
+			[]introspectedColumn{
+				{TableName: "user", ColumnName: "id", DataType: "int"},
+				{TableName: "users", ColumnName: "id", DataType: "int"},
+			},
+			"tables user and users both generate type User",
+		},
+		{
+			"fields",
+			[]introspectedColumn{
+				{TableName: "users", ColumnName: "user_id", DataType: "int"},
+				{TableName: "users", ColumnName: "UserID", DataType: "int"},
+			},
+			"users.UserID and users.user_id both generate field User.UserID",
+		},
+		{
+			"method",
+			[]introspectedColumn{
+				{TableName: "users", ColumnName: "table_name", DataType: "varchar"},
+			},
+			"users.table_name and the TableName method",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := generateModels(test.columns, "models", &bytes.Buffer{})
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got %v, want %q", err, test.want)
+			}
+		})
+	}
+}
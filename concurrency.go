@@ -0,0 +1,45 @@
+package cservice
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ConcurrencyLimit returns middleware allowing at most limit requests to be
+// handled at once. Further requests wait up to queueTimeout for a slot and
+// are then rejected with 503 Service Unavailable. Apply it to the whole
+// handler for a global limit, or per route so one slow endpoint cannot tie up
+// every goroutine and database connection. It panics if limit is not
+// positive.
+func ConcurrencyLimit(limit int, queueTimeout time.Duration) func(http.Handler) http.Handler {
+	if limit <= 0 {
+		panic(fmt.Sprintf("cservice: ConcurrencyLimit limit must be positive, got %d", limit))
+	}
+
+	slots := make(chan struct{}, limit)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			select {
+			case slots <- struct{}{}:
+			default:
+				timer := time.NewTimer(queueTimeout)
+				defer timer.Stop()
+
+				select {
+				case slots <- struct{}{}:
+				case <-timer.C:
+					rw.Header().Set("Retry-After", "1")
+					http.Error(rw, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+					return
+				case <-r.Context().Done():
+					return
+				}
+			}
+			defer func() { <-slots }()
+
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package cservice
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyLimitRejectsWhenFull(t *testing.T) {
+	release := make(chan struct{})
+	entered := make(chan struct{})
+	h := ConcurrencyLimit(1, time.Millisecond)(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+	}))
+
+	go h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	<-entered
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	close(release)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestConcurrencyLimitPanicsOnNonPositiveLimit(t *testing.T) {
+	for _, limit := range []int{0, -1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("limit %d did not panic", limit)
+				}
+			}()
+			ConcurrencyLimit(limit, time.Second)
+		}()
+	}
+}
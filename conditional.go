@@ -0,0 +1,59 @@
+package cservice
+
+import (
+	"net/http"
+	"reflect"
+	"time"
+)
+
+// LastModified returns the UpdatedAt field of model, which may be a struct
+// or a pointer to one. It reports false if there is no such time.Time field
+// or it is zero.
+func LastModified(model interface{}) (time.Time, bool) {
+	value := reflect.Indirect(reflect.ValueOf(model))
+	if value.Kind() != reflect.Struct {
+		return time.Time{}, false
+	}
+
+	field := value.FieldByName("UpdatedAt")
+	if !field.IsValid() {
+		return time.Time{}, false
+	}
+
+	updatedAt, ok := field.Interface().(time.Time)
+	if !ok || updatedAt.IsZero() {
+		return time.Time{}, false
+	}
+
+	return updatedAt, true
+}
+
+// CheckNotModified sets the Last-Modified header of a GET or HEAD response
+// to modified and compares it with the request's If-Modified-Since header.
+// If the client's copy is current it writes 304 Not Modified and returns
+// true, and the caller should write nothing further.
+func CheckNotModified(rw http.ResponseWriter, r *http.Request, modified time.Time) bool {
+	if modified.IsZero() || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		return false
+	}
+
+	// HTTP dates have second precision.
+	modified = modified.UTC().Truncate(time.Second)
+	rw.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+
+	// If-None-Match takes precedence over If-Modified-Since.
+	if r.Header.Get("If-None-Match") != "" {
+		return false
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || modified.After(since) {
+		return false
+	}
+
+	header := rw.Header()
+	header.Del("Content-Type")
+	header.Del("Content-Length")
+	rw.WriteHeader(http.StatusNotModified)
+	return true
+}
@@ -0,0 +1,92 @@
+package cservice
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLastModified(t *testing.T) {
+	updated := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+
+	type timestamped struct{ UpdatedAt time.Time }
+	type mistyped struct{ UpdatedAt string }
+
+	tests := []struct {
+		name   string
+		model  interface{}
+		want   time.Time
+		wantOK bool
+	}{
+		{"struct", timestamped{UpdatedAt: updated}, updated, true},
+		{"pointer", &timestamped{UpdatedAt: updated}, updated, true},
+		{"zero time", timestamped{}, time.Time{}, false},
+		{"not a time", mistyped{UpdatedAt: "yesterday"}, time.Time{}, false},
+		{"no field", struct{ ID uint }{}, time.Time{}, false},
+		{"not a struct", "model", time.Time{}, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := LastModified(tt.model)
+		if ok != tt.wantOK || !got.Equal(tt.want) {
+			t.Errorf("%s: got %s, %v, want %s, %v", tt.name, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestCheckNotModified(t *testing.T) {
+	modified := time.Date(2024, 3, 1, 9, 0, 0, 500, time.UTC)
+	current := modified.Format(http.TimeFormat)
+	stale := modified.Add(-time.Minute).Format(http.TimeFormat)
+
+	tests := []struct {
+		name     string
+		method   string
+		modified time.Time
+		headers  map[string]string
+		want     bool
+	}{
+		{"current copy", http.MethodGet, modified, map[string]string{"If-Modified-Since": current}, true},
+		{"HEAD", http.MethodHead, modified, map[string]string{"If-Modified-Since": current}, true},
+		{"newer copy", http.MethodGet, modified, map[string]string{"If-Modified-Since": modified.Add(time.Hour).Format(http.TimeFormat)}, true},
+		{"stale copy", http.MethodGet, modified, map[string]string{"If-Modified-Since": stale}, false},
+		{"no condition", http.MethodGet, modified, nil, false},
+		{"invalid date", http.MethodGet, modified, map[string]string{"If-Modified-Since": "yesterday"}, false},
+		{"If-None-Match takes precedence", http.MethodGet, modified, map[string]string{"If-Modified-Since": current, "If-None-Match": `"v1"`}, false},
+		{"unsafe method", http.MethodPut, modified, map[string]string{"If-Modified-Since": current}, false},
+		{"unknown modification time", http.MethodGet, time.Time{}, map[string]string{"If-Modified-Since": current}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			rec.Header().Set("Content-Type", "application/json")
+
+			req := httptest.NewRequest(tt.method, "/", nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+
+			if got := CheckNotModified(rec, req, tt.modified); got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+
+			if tt.want {
+				if rec.Code != http.StatusNotModified || rec.Header().Get("Content-Type") != "" {
+					t.Errorf("got %d with Content-Type %q", rec.Code, rec.Header().Get("Content-Type"))
+				}
+			}
+
+			lastModified := rec.Header().Get("Last-Modified")
+			switch {
+			case tt.modified.IsZero() || tt.method == http.MethodPut:
+				if lastModified != "" {
+					t.Errorf("Last-Modified set to %q", lastModified)
+				}
+			case lastModified != current:
+				t.Errorf("got Last-Modified %q, want %q", lastModified, current)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package cservicetest
+
+import (
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// WithCleanDB begins a transaction on db and rolls it back when the test
+// finishes, so nothing the test writes leaks into later tests sharing the
+// database. Run the test's queries on the returned handle; with OpenDB's
+// single connection, queries on db itself wait until the rollback.
+func WithCleanDB(t testing.TB, db *gorm.DB) *gorm.DB {
+	t.Helper()
+
+	tx := db.Begin()
+	if tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+
+	t.Cleanup(func() { tx.Rollback() })
+
+	return tx
+}
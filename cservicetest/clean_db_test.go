@@ -0,0 +1,31 @@
+package cservicetest
+
+import "testing"
+
+func TestWithCleanDB(t *testing.T) {
+	db := OpenDB(t, &user{})
+
+	for _, email := range []string{"a@example.com", "b@example.com"} {
+		t.Run(email, func(t *testing.T) {
+			tx := WithCleanDB(t, db)
+
+			if err := tx.Create(&user{Email: email}).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			var count int64
+			tx.Model(&user{}).Count(&count)
+			if count != 1 {
+				t.Errorf("saw %d users, want only this test's", count)
+			}
+		})
+	}
+
+	var count int64
+	if err := db.Model(&user{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("%d users leaked out of the tests", count)
+	}
+}
@@ -0,0 +1,41 @@
+package cservicetest
+
+import (
+	"fmt"
+	"testing"
+)
+
+type user struct {
+	ID    uint
+	Email string `gorm:"uniqueIndex"`
+	Admin bool
+}
+
+func TestFactory(t *testing.T) {
+	db := OpenDB(t, &user{})
+	users := NewFactory(func(seq int) user {
+		return user{Email: fmt.Sprintf("user%d@example.com", seq)}
+	})
+
+	admin, err := users.Create(db, func(u *user) { u.Admin = true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !admin.Admin || admin.ID == 0 || admin.Email != "user1@example.com" {
+		t.Errorf("got %+v", admin)
+	}
+
+	batch, err := users.CreateBatch(db, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(batch) != 50 || batch[49].Email != "user51@example.com" {
+		t.Errorf("got %d users, last %+v", len(batch), batch[len(batch)-1])
+	}
+
+	var count int64
+	db.Model(&user{}).Count(&count)
+	if count != 51 {
+		t.Errorf("got %d rows, want 51", count)
+	}
+}
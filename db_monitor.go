@@ -0,0 +1,185 @@
+package cservice
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DBMonitorConfig defines how the database connection is monitored.
+type DBMonitorConfig struct {
+	// Interval between pings while the database is healthy. Defaults to 10
+	// seconds.
+	Interval time.Duration
+
+	// Timeout for each ping. Defaults to 2 seconds.
+	Timeout time.Duration
+
+	// MaxBackoff caps the delay between pings while the database is down.
+	// Defaults to 30 seconds.
+	MaxBackoff time.Duration
+
+	// OnStateChange is called when the database becomes unreachable (ready
+	// is false and err is the ping error) or reachable again.
+	OnStateChange func(ready bool, err error)
+
+	// Clock schedules pings. Defaults to SystemClock.
+	Clock Clock
+}
+
+// DBMonitor pings the database in the background, tracking whether it is
+// reachable so readiness checks do not wait for a query to fail.
+type DBMonitor struct {
+	conn     *gorm.DB
+	config   DBMonitorConfig
+	ready    int32
+	failures int64
+	backoff  time.Duration
+
+	mu      sync.Mutex
+	lastErr error
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// StartDBMonitor starts monitoring the database opened by InitDatabase.
+func StartDBMonitor(config DBMonitorConfig) (*DBMonitor, error) {
+	if db == nil {
+		return nil, ErrDatabaseNotInitialised
+	}
+
+	return NewDBMonitor(db, config), nil
+}
+
+// NewDBMonitor pings conn and starts monitoring it, so Ready reflects the
+// database from the start.
+func NewDBMonitor(conn *gorm.DB, config DBMonitorConfig) *DBMonitor {
+	if config.Interval <= 0 {
+		config.Interval = 10 * time.Second
+	}
+
+	if config.Timeout <= 0 {
+		config.Timeout = 2 * time.Second
+	}
+
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = 30 * time.Second
+	}
+
+	config.Clock = clockOrSystem(config.Clock)
+
+	m := &DBMonitor{
+		conn:   conn,
+		config: config,
+		ready:  1,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	m.backoff = m.initialBackoff()
+
+	delay := m.check()
+	go m.run(delay)
+
+	return m
+}
+
+// Ready reports whether the last ping succeeded.
+func (m *DBMonitor) Ready() bool {
+	return atomic.LoadInt32(&m.ready) == 1
+}
+
+// Err returns the error of the last failed ping while the database is down.
+func (m *DBMonitor) Err() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.lastErr
+}
+
+// Failures returns the total number of failed pings.
+func (m *DBMonitor) Failures() int64 {
+	return atomic.LoadInt64(&m.failures)
+}
+
+// Stop stops monitoring. It is safe to call more than once.
+func (m *DBMonitor) Stop() {
+	m.stopOnce.Do(func() { close(m.stop) })
+	<-m.done
+}
+
+func (m *DBMonitor) run(delay time.Duration) {
+	defer close(m.done)
+
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-clockAfter(m.config.Clock, delay):
+		}
+
+		delay = m.check()
+	}
+}
+
+// check pings the database and records the result, returning how long to
+// wait before the next ping.
+func (m *DBMonitor) check() time.Duration {
+	if err := m.ping(); err != nil {
+		atomic.AddInt64(&m.failures, 1)
+		m.setState(false, err)
+
+		delay := m.backoff
+		m.backoff *= 2
+		if m.backoff > m.config.MaxBackoff {
+			m.backoff = m.config.MaxBackoff
+		}
+		return delay
+	}
+
+	m.setState(true, nil)
+	m.backoff = m.initialBackoff()
+	return m.config.Interval
+}
+
+// initialBackoff is the delay before the first retry after a failed ping.
+func (m *DBMonitor) initialBackoff() time.Duration {
+	if m.config.MaxBackoff < time.Second {
+		return m.config.MaxBackoff
+	}
+	return time.Second
+}
+
+// ping checks the database. database/sql discards broken connections and
+// dials new ones, so a successful ping after a failure means the service has
+// reconnected.
+func (m *DBMonitor) ping() error {
+	sqlDB, err := m.conn.DB()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.config.Timeout)
+	defer cancel()
+
+	return sqlDB.PingContext(ctx)
+}
+
+func (m *DBMonitor) setState(ready bool, err error) {
+	m.mu.Lock()
+	m.lastErr = err
+	m.mu.Unlock()
+
+	var value int32
+	if ready {
+		value = 1
+	}
+
+	if previous := atomic.SwapInt32(&m.ready, value); previous != value && m.config.OnStateChange != nil {
+		m.config.OnStateChange(ready, err)
+	}
+}
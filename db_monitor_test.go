@@ -0,0 +1,182 @@
+package cservice
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// pingDriver is a database/sql driver whose connections only answer pings,
+// failing them with pingErr.
+type pingDriver struct{}
+
+var (
+	registerPingDriver sync.Once
+	pingMu             sync.Mutex
+	pingErr            error
+)
+
+func setPingErr(err error) {
+	pingMu.Lock()
+	defer pingMu.Unlock()
+
+	pingErr = err
+}
+
+func (pingDriver) Open(name string) (driver.Conn, error) {
+	return pingConn{}, nil
+}
+
+type pingConn struct{}
+
+func (pingConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("pingConn: queries are not supported")
+}
+
+func (pingConn) Close() error {
+	return nil
+}
+
+func (pingConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("pingConn: transactions are not supported")
+}
+
+func (pingConn) Ping(ctx context.Context) error {
+	pingMu.Lock()
+	defer pingMu.Unlock()
+
+	return pingErr
+}
+
+func openPingDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	registerPingDriver.Do(func() { sql.Register("cservice_ping", pingDriver{}) })
+	setPingErr(nil)
+
+	sqlDB, err := sql.Open("cservice_ping", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	conn, err := gorm.Open(mysql.New(mysql.Config{Conn: sqlDB, SkipInitializeWithVersion: true}), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+type stateChange struct {
+	ready bool
+	err   error
+}
+
+// advanceWhenWaiting moves clock forward by d once the monitor is waiting on
+// it.
+func advanceWhenWaiting(t *testing.T, clock *FakeClock, d time.Duration) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for clock.Waiters() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("monitor is not waiting on the clock")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(d)
+}
+
+func waitForFailures(t *testing.T, m *DBMonitor, failures int64) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for m.Failures() < failures {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d failures, want %d", m.Failures(), failures)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDBMonitor(t *testing.T) {
+	conn := openPingDB(t)
+	clock := NewFakeClock(time.Unix(0, 0))
+	changes := make(chan stateChange, 10)
+
+	m := NewDBMonitor(conn, DBMonitorConfig{
+		Interval:   10 * time.Second,
+		MaxBackoff: 500 * time.Millisecond,
+		Clock:      clock,
+		OnStateChange: func(ready bool, err error) {
+			changes <- stateChange{ready, err}
+		},
+	})
+	defer m.Stop()
+
+	if !m.Ready() || m.Failures() != 0 || m.Err() != nil {
+		t.Errorf("at start: ready %v, failures %d, err %v", m.Ready(), m.Failures(), m.Err())
+	}
+
+	down := errors.New("connection refused")
+	setPingErr(down)
+	advanceWhenWaiting(t, clock, 10*time.Second)
+
+	if change := <-changes; change.ready || change.err != down {
+		t.Errorf("going down: got %+v", change)
+	}
+	if m.Ready() || m.Err() != down || m.Failures() != 1 {
+		t.Errorf("while down: ready %v, failures %d, err %v", m.Ready(), m.Failures(), m.Err())
+	}
+
+	// The first retry is clamped to MaxBackoff rather than waiting a second.
+	advanceWhenWaiting(t, clock, 500*time.Millisecond)
+	waitForFailures(t, m, 2)
+
+	setPingErr(nil)
+	advanceWhenWaiting(t, clock, 500*time.Millisecond)
+
+	if change := <-changes; !change.ready || change.err != nil {
+		t.Errorf("recovering: got %+v", change)
+	}
+	if !m.Ready() || m.Err() != nil || m.Failures() != 2 {
+		t.Errorf("after recovery: ready %v, failures %d, err %v", m.Ready(), m.Failures(), m.Err())
+	}
+
+	select {
+	case change := <-changes:
+		t.Errorf("unexpected state change %+v", change)
+	default:
+	}
+
+	m.Stop()
+	m.Stop()
+}
+
+func TestDBMonitorStartsDown(t *testing.T) {
+	conn := openPingDB(t)
+	down := errors.New("connection refused")
+	setPingErr(down)
+
+	var changes []stateChange
+	m := NewDBMonitor(conn, DBMonitorConfig{
+		Clock: NewFakeClock(time.Unix(0, 0)),
+		OnStateChange: func(ready bool, err error) {
+			changes = append(changes, stateChange{ready, err})
+		},
+	})
+	defer m.Stop()
+
+	if m.Ready() || m.Err() != down || m.Failures() != 1 {
+		t.Errorf("ready %v, failures %d, err %v", m.Ready(), m.Failures(), m.Err())
+	}
+	if len(changes) != 1 || changes[0].ready {
+		t.Errorf("got state changes %+v", changes)
+	}
+}
@@ -0,0 +1,56 @@
+package cservice
+
+import (
+	"context"
+	"net/http"
+
+	"gorm.io/gorm"
+)
+
+type dbKey struct{}
+
+// WithDB returns a copy of ctx carrying tx as the request's database session.
+// Conditions already chained on tx apply to every query made with the
+// session, but each query starts its own statement, so conditions added by
+// one query do not leak into the next.
+func WithDB(ctx context.Context, tx *gorm.DB) context.Context {
+	return context.WithValue(ctx, dbKey{}, tx.Session(&gorm.Session{}))
+}
+
+// DB returns the database session stored in ctx by DBSessionMiddleware or
+// WithDB. Without one, it returns the database opened by InitDatabase bound
+// to ctx, or nil if the database is not initialised.
+func DB(ctx context.Context) *gorm.DB {
+	if tx, ok := ctx.Value(dbKey{}).(*gorm.DB); ok && tx != nil {
+		return tx
+	}
+
+	if db == nil {
+		return nil
+	}
+
+	return db.WithContext(ctx)
+}
+
+// DBSessionMiddleware returns middleware which stores a database session
+// bound to the request context, so queries are cancelled with the request.
+// Each scope is applied to the session, for request-scoped settings such as
+// restricting queries to the caller's tenant. Requests are rejected with 503
+// Service Unavailable before InitDatabase.
+func DBSessionMiddleware(scopes ...func(r *http.Request, tx *gorm.DB) *gorm.DB) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if db == nil {
+				http.Error(rw, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+				return
+			}
+
+			tx := db.WithContext(r.Context())
+			for _, scope := range scopes {
+				tx = scope(r, tx)
+			}
+
+			next.ServeHTTP(rw, r.WithContext(WithDB(r.Context(), tx)))
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package cservice
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/crockerio/cservice/cservicetest"
+	"gorm.io/gorm"
+)
+
+type sessionWidget struct {
+	ID     uint
+	Tenant string
+}
+
+func TestDBSessionQueriesDoNotShareConditions(t *testing.T) {
+	conn := cservicetest.OpenDB(t, &sessionWidget{})
+	conn.Create(&[]sessionWidget{{Tenant: "acme"}, {Tenant: "acme"}, {Tenant: "other"}})
+
+	previous := db
+	db = conn
+	t.Cleanup(func() { db = previous })
+
+	tenant := func(r *http.Request, tx *gorm.DB) *gorm.DB {
+		return tx.Where("tenant = ?", r.Header.Get("X-Tenant"))
+	}
+
+	handler := DBSessionMiddleware(tenant)(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var first sessionWidget
+		if err := DB(r.Context()).Where("id = ?", 1).First(&first).Error; err != nil {
+			t.Fatal(err)
+		}
+
+		var all []sessionWidget
+		if err := DB(r.Context()).Find(&all).Error; err != nil {
+			t.Fatal(err)
+		}
+		if len(all) != 2 {
+			t.Errorf("second query returned %d rows, want the tenant's 2", len(all))
+		}
+
+		var count int64
+		if err := DB(r.Context()).Model(&sessionWidget{}).Where("id = ?", 3).Count(&count).Error; err != nil {
+			t.Fatal(err)
+		}
+		if count != 0 {
+			t.Error("query escaped the tenant scope")
+		}
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Tenant", "acme")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+}
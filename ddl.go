@@ -0,0 +1,22 @@
+package cservice
+
+import (
+	"fmt"
+	"regexp"
+)
+
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$]{0,63}$`)
+
+// validateIdentifier checks name is a plain MySQL identifier which is safe to
+// interpolate into DDL.
+func validateIdentifier(kind, name string) error {
+	if !identifierPattern.MatchString(name) {
+		return fmt.Errorf("cservice: invalid %s name %q", kind, name)
+	}
+	return nil
+}
+
+// quoteIdentifier quotes a validated identifier for MySQL.
+func quoteIdentifier(name string) string {
+	return "`" + name + "`"
+}
@@ -0,0 +1,29 @@
+// Package debug serves runtime profiles and variables for diagnosing a
+// running service. It is separate from cservice because net/http/pprof and
+// expvar register their handlers on http.DefaultServeMux when imported; only
+// services which import this package get them, so do not serve
+// DefaultServeMux publicly from those.
+package debug
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+)
+
+// Handler serves net/http/pprof profiles under /debug/pprof/ and expvar
+// variables at /debug/vars. Mount it at the root of a mux so the paths match,
+// and behind authentication or an IPFilter, as profiles expose internals and
+// are expensive to collect.
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	return mux
+}
@@ -0,0 +1,18 @@
+package cservice
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Importing cservice must not register handlers on http.DefaultServeMux,
+// which services may serve publicly. Debug handlers live in the debug
+// package for this reason.
+func TestDefaultServeMuxUntouched(t *testing.T) {
+	for _, path := range []string{"/debug/pprof/", "/debug/vars"} {
+		if _, pattern := http.DefaultServeMux.Handler(httptest.NewRequest(http.MethodGet, path, nil)); pattern != "" {
+			t.Errorf("%s is served by http.DefaultServeMux as %q", path, pattern)
+		}
+	}
+}
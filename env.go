@@ -0,0 +1,48 @@
+package cservice
+
+import (
+	"os"
+	"strings"
+)
+
+// Environment is the deployment environment the service runs in, read from
+// the APP_ENV variable.
+type Environment string
+
+// Supported environments.
+const (
+	Development Environment = "dev"
+	Staging     Environment = "staging"
+	Production  Environment = "prod"
+)
+
+// Env returns the current environment. APP_ENV accepts dev, staging and prod
+// as well as development and production. Anything else, including an unset
+// variable, is treated as Production, so a deployment which never set
+// APP_ENV keeps production safeguards such as quieter query logs and
+// migrations off at start up.
+func Env() Environment {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("APP_ENV"))) {
+	case "dev", "development":
+		return Development
+	case "staging", "stage":
+		return Staging
+	default:
+		return Production
+	}
+}
+
+// IsDevelopment reports whether the service runs in Development.
+func IsDevelopment() bool {
+	return Env() == Development
+}
+
+// IsStaging reports whether the service runs in Staging.
+func IsStaging() bool {
+	return Env() == Staging
+}
+
+// IsProduction reports whether the service runs in Production.
+func IsProduction() bool {
+	return Env() == Production
+}
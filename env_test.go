@@ -0,0 +1,57 @@
+package cservice
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gorm.io/gorm/logger"
+
+	"github.com/crockerio/cservice/cservicetest"
+)
+
+func TestEnv(t *testing.T) {
+	tests := []struct {
+		value string
+		want  Environment
+	}{
+		{"", Production},
+		{"prod", Production},
+		{"production", Production},
+		{" PRODUCTION ", Production},
+		{"dev", Development},
+		{"development", Development},
+		{"Dev", Development},
+		{"staging", Staging},
+		{"stage", Staging},
+		{"test", Production},
+		{"devel", Production},
+	}
+
+	for _, test := range tests {
+		t.Setenv("APP_ENV", test.value)
+
+		if got := Env(); got != test.want {
+			t.Errorf("APP_ENV=%q: got %s, want %s", test.value, got, test.want)
+		}
+		if IsProduction() != (test.want == Production) || IsStaging() != (test.want == Staging) || IsDevelopment() != (test.want == Development) {
+			t.Errorf("APP_ENV=%q: Is* helpers disagree with Env", test.value)
+		}
+	}
+}
+
+func TestUnsetEnvironmentKeepsProductionGuards(t *testing.T) {
+	t.Setenv("APP_ENV", "")
+
+	if err := Scrub(context.Background(), cservicetest.OpenDB(t), 100); !errors.Is(err, ErrScrubInProduction) {
+		t.Errorf("Scrub: got %v, want ErrScrubInProduction", err)
+	}
+
+	out := &bufferWriter{}
+	saved := QueryLogLevel()
+	t.Cleanup(func() { SetQueryLogLevel(saved) })
+	newQueryLogger(&DatabaseConfig{LogWriter: out})
+	if QueryLogLevel() != logger.Warn {
+		t.Errorf("query log level %d, want Warn", QueryLogLevel())
+	}
+}
@@ -0,0 +1,366 @@
+package cservice
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FeatureFlag is a feature flag stored in the database. Add it and
+// FeatureFlagOverride to DatabaseConfig.Models to create their tables.
+type FeatureFlag struct {
+	// Name identifies the flag.
+	Name string `gorm:"primaryKey;size:191"`
+
+	// Percentage of subjects the flag is enabled for, from 0 (off) to 100
+	// (on for everyone).
+	Percentage int
+}
+
+// FeatureFlagOverride forces a flag on or off for a single tenant.
+type FeatureFlagOverride struct {
+	// Flag is the name of the overridden flag.
+	Flag string `gorm:"primaryKey;size:191"`
+
+	// Tenant the override applies to.
+	Tenant string `gorm:"primaryKey;size:191"`
+
+	// Enabled is the value of the flag for the tenant.
+	Enabled bool
+}
+
+// Flags evaluates feature flags. Environment variables take precedence over
+// tenant overrides, which take precedence over the rollout percentage stored
+// in the database.
+type Flags struct {
+	db        *gorm.DB
+	envPrefix string
+
+	mu        sync.RWMutex
+	flags     map[string]int
+	overrides map[string]map[string]bool
+}
+
+// NewFlags creates a Flags reading from db and from environment variables
+// named envPrefix followed by the upper-cased flag name, e.g. FEATURE_NEW_UI.
+// The variable holds true, false or a rollout percentage. Unlike
+// strconv.ParseBool, only true and false, in any case, are booleans, so 1 is
+// a 1% rollout rather than on. db may be nil to use environment variables
+// only. Call Refresh or StartRefresh to load the database flags.
+func NewFlags(db *gorm.DB, envPrefix string) *Flags {
+	return &Flags{
+		db:        db,
+		envPrefix: envPrefix,
+		flags:     map[string]int{},
+		overrides: map[string]map[string]bool{},
+	}
+}
+
+// Refresh reloads the flags and overrides from the database.
+func (f *Flags) Refresh(ctx context.Context) error {
+	if f.db == nil {
+		return nil
+	}
+
+	var flags []FeatureFlag
+	if err := f.db.WithContext(ctx).Find(&flags).Error; err != nil {
+		return err
+	}
+
+	var overrides []FeatureFlagOverride
+	if err := f.db.WithContext(ctx).Find(&overrides).Error; err != nil {
+		return err
+	}
+
+	flagMap := make(map[string]int, len(flags))
+	for _, flag := range flags {
+		flagMap[flag.Name] = flag.Percentage
+	}
+
+	overrideMap := map[string]map[string]bool{}
+	for _, override := range overrides {
+		if overrideMap[override.Flag] == nil {
+			overrideMap[override.Flag] = map[string]bool{}
+		}
+		overrideMap[override.Flag][override.Tenant] = override.Enabled
+	}
+
+	f.mu.Lock()
+	f.flags = flagMap
+	f.overrides = overrideMap
+	f.mu.Unlock()
+
+	return nil
+}
+
+// Enabled reports whether the named flag is on for subject within tenant.
+// Either may be empty.
+func (f *Flags) Enabled(name, tenant, subject string) bool {
+	if value, ok := os.LookupEnv(f.envName(name)); ok {
+		switch strings.ToLower(value) {
+		case "true":
+			return true
+		case "false":
+			return false
+		}
+		if percentage, err := strconv.Atoi(value); err == nil {
+			return inRollout(name, subject, percentage)
+		}
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if enabled, ok := f.overrides[name][tenant]; ok && tenant != "" {
+		return enabled
+	}
+
+	return inRollout(name, subject, f.flags[name])
+}
+
+// SetFlag stores the rollout percentage of the named flag.
+func (f *Flags) SetFlag(ctx context.Context, name string, percentage int) error {
+	if f.db == nil {
+		return ErrDatabaseNotInitialised
+	}
+
+	flag := FeatureFlag{Name: name, Percentage: percentage}
+	err := f.db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(&flag).Error
+	if err != nil {
+		return err
+	}
+
+	return f.Refresh(ctx)
+}
+
+// SetOverride forces the named flag on or off for tenant.
+func (f *Flags) SetOverride(ctx context.Context, name, tenant string, enabled bool) error {
+	if f.db == nil {
+		return ErrDatabaseNotInitialised
+	}
+
+	override := FeatureFlagOverride{Flag: name, Tenant: tenant, Enabled: enabled}
+	err := f.db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(&override).Error
+	if err != nil {
+		return err
+	}
+
+	return f.Refresh(ctx)
+}
+
+// DeleteFlag removes the named flag and its overrides.
+func (f *Flags) DeleteFlag(ctx context.Context, name string) error {
+	if f.db == nil {
+		return ErrDatabaseNotInitialised
+	}
+
+	err := f.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("flag = ?", name).Delete(&FeatureFlagOverride{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&FeatureFlag{Name: name}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	return f.Refresh(ctx)
+}
+
+// DefaultFlagRefreshInterval is how often StartRefresh reloads flags when
+// given no interval.
+const DefaultFlagRefreshInterval = 30 * time.Second
+
+// StartRefresh reloads the flags from the database every interval, so
+// changes made by other instances are picked up, until the returned function
+// is called. An interval which is not positive defaults to
+// DefaultFlagRefreshInterval. Failed reloads keep the previous flags and are
+// passed to onError, if not nil.
+func (f *Flags) StartRefresh(interval time.Duration, onError func(error)) (stop func()) {
+	if interval <= 0 {
+		interval = DefaultFlagRefreshInterval
+	}
+
+	stopCh := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			err := f.Refresh(ctx)
+			cancel()
+
+			if err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(stopCh) })
+		<-done
+	}
+}
+
+// Handler serves flag management to requests allowed by authorize:
+//
+//	GET    /                          lists flags and overrides
+//	PUT    /{flag}                    sets the rollout, {"percentage": 50}
+//	PUT    /{flag}/overrides/{tenant} sets an override, {"enabled": true}
+//	DELETE /{flag}                    deletes a flag and its overrides
+//
+// Requests are rejected with 403 Forbidden if authorize is nil or returns
+// false. Changes reach other instances on their next refresh.
+func (f *Flags) Handler(authorize func(r *http.Request) bool) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if authorize == nil || !authorize(r) {
+			http.Error(rw, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if parts[0] == "" {
+			parts = nil
+		}
+
+		var err error
+		switch {
+		case r.Method == http.MethodGet && len(parts) == 0:
+			type flagInfo struct {
+				Percentage int             `json:"percentage"`
+				Overrides  map[string]bool `json:"overrides,omitempty"`
+			}
+
+			f.mu.RLock()
+			infos := map[string]*flagInfo{}
+			for name, percentage := range f.flags {
+				infos[name] = &flagInfo{Percentage: percentage}
+			}
+			for name, overrides := range f.overrides {
+				if infos[name] == nil {
+					infos[name] = &flagInfo{}
+				}
+				infos[name].Overrides = overrides
+			}
+			f.mu.RUnlock()
+
+			writeJSON(rw, http.StatusOK, infos)
+			return
+		case r.Method == http.MethodPut && len(parts) == 1:
+			var body struct {
+				Percentage *int `json:"percentage"`
+			}
+			if json.NewDecoder(http.MaxBytesReader(rw, r.Body, 1<<16)).Decode(&body) != nil || body.Percentage == nil || *body.Percentage < 0 || *body.Percentage > 100 {
+				http.Error(rw, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+				return
+			}
+			err = f.SetFlag(r.Context(), parts[0], *body.Percentage)
+		case r.Method == http.MethodPut && len(parts) == 3 && parts[1] == "overrides":
+			var body struct {
+				Enabled *bool `json:"enabled"`
+			}
+			if json.NewDecoder(http.MaxBytesReader(rw, r.Body, 1<<16)).Decode(&body) != nil || body.Enabled == nil {
+				http.Error(rw, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+				return
+			}
+			err = f.SetOverride(r.Context(), parts[0], parts[2], *body.Enabled)
+		case r.Method == http.MethodDelete && len(parts) == 1:
+			err = f.DeleteFlag(r.Context(), parts[0])
+		default:
+			http.Error(rw, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err != nil {
+			http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		rw.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func (f *Flags) envName(name string) string {
+	return f.envPrefix + strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
+
+// inRollout deterministically places subject in one of 100 buckets for the
+// named flag and reports whether the bucket is within percentage.
+func inRollout(name, subject string, percentage int) bool {
+	if percentage <= 0 {
+		return false
+	}
+	if percentage >= 100 {
+		return true
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(name + ":" + subject))
+
+	return int(h.Sum32()%100) < percentage
+}
+
+type flagsKey struct{}
+
+type flagsContext struct {
+	flags   *Flags
+	tenant  string
+	subject string
+}
+
+// FlagsMiddleware returns middleware which makes flags available to
+// FlagEnabled through the request context. identify returns the tenant and
+// subject flags are evaluated for.
+func FlagsMiddleware(flags *Flags, identify func(r *http.Request) (tenant, subject string)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			fc := &flagsContext{flags: flags}
+			if identify != nil {
+				fc.tenant, fc.subject = identify(r)
+			}
+
+			next.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), flagsKey{}, fc)))
+		})
+	}
+}
+
+// FlagEnabled reports whether the named flag is on for the request ctx
+// belongs to. It returns false if FlagsMiddleware has not run.
+func FlagEnabled(ctx context.Context, name string) bool {
+	fc, ok := ctx.Value(flagsKey{}).(*flagsContext)
+	if !ok {
+		return false
+	}
+
+	return fc.flags.Enabled(name, fc.tenant, fc.subject)
+}
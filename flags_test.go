@@ -0,0 +1,110 @@
+package cservice
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crockerio/cservice/cservicetest"
+)
+
+func TestFlagsEnvStrictBool(t *testing.T) {
+	flags := NewFlags(nil, "TEST_FLAG_")
+
+	t.Setenv("TEST_FLAG_ON", "TRUE")
+	t.Setenv("TEST_FLAG_OFF", "false")
+	t.Setenv("TEST_FLAG_ONE", "1")
+
+	if !flags.Enabled("on", "", "subject") {
+		t.Error("TRUE should enable the flag")
+	}
+	if flags.Enabled("off", "", "subject") {
+		t.Error("false should disable the flag")
+	}
+
+	enabled := 0
+	for i := 0; i < 1000; i++ {
+		if flags.Enabled("one", "", strings.Repeat("s", i)) {
+			enabled++
+		}
+	}
+	if enabled == 0 || enabled > 100 {
+		t.Errorf("1 should be a 1%% rollout, enabled for %d of 1000", enabled)
+	}
+}
+
+func TestFlagsRefreshAcrossInstances(t *testing.T) {
+	conn := cservicetest.OpenDB(t, &FeatureFlag{}, &FeatureFlagOverride{})
+	writer := NewFlags(conn, "")
+	reader := NewFlags(conn, "")
+
+	stop := reader.StartRefresh(5*time.Millisecond, func(err error) { t.Error(err) })
+	defer stop()
+
+	if err := writer.SetFlag(context.Background(), "beta", 100); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for !reader.Enabled("beta", "", "subject") {
+		if time.Now().After(deadline) {
+			t.Fatal("reader never saw the flag")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	stop()
+}
+
+func TestFlagsHandler(t *testing.T) {
+	flags := NewFlags(cservicetest.OpenDB(t, &FeatureFlag{}, &FeatureFlagOverride{}), "")
+	handler := flags.Handler(func(r *http.Request) bool { return r.Header.Get("X-Admin") == "yes" })
+
+	serve := func(method, path, body string, admin bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if admin {
+			req.Header.Set("X-Admin", "yes")
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := serve(http.MethodPut, "/beta", `{"percentage":100}`, false); rec.Code != http.StatusForbidden {
+		t.Fatalf("unauthorized: got %d", rec.Code)
+	}
+	if rec := serve(http.MethodPut, "/beta", `{"percentage":100}`, true); rec.Code != http.StatusNoContent {
+		t.Fatalf("set flag: got %d", rec.Code)
+	}
+	if rec := serve(http.MethodPut, "/beta/overrides/acme", `{"enabled":false}`, true); rec.Code != http.StatusNoContent {
+		t.Fatalf("set override: got %d", rec.Code)
+	}
+
+	if !flags.Enabled("beta", "other", "subject") || flags.Enabled("beta", "acme", "subject") {
+		t.Error("flag and override were not applied")
+	}
+
+	rec := serve(http.MethodGet, "/", "", true)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"acme":false`) {
+		t.Errorf("list: got %d %s", rec.Code, rec.Body)
+	}
+
+	if rec := serve(http.MethodDelete, "/beta", "", true); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete: got %d", rec.Code)
+	}
+	if flags.Enabled("beta", "other", "subject") {
+		t.Error("deleted flag is still enabled")
+	}
+}
+
+func TestFlagsStartRefreshDefaultsInterval(t *testing.T) {
+	flags := NewFlags(cservicetest.OpenDB(t, &FeatureFlag{}, &FeatureFlagOverride{}), "")
+
+	for _, interval := range []time.Duration{0, -time.Second} {
+		stop := flags.StartRefresh(interval, nil)
+		stop()
+	}
+}
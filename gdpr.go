@@ -0,0 +1,137 @@
+package cservice
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PersonalData registers a model holding personal data about a subject,
+// usually a user.
+type PersonalData struct {
+	// Model is a pointer to the model, e.g. &Order{}.
+	Model interface{}
+
+	// SubjectColumn links rows to the subject, e.g. "user_id", or "id" for
+	// the subject's own table.
+	SubjectColumn string
+
+	// Anonymize erases rows by rewriting their columns tagged scrub:"kind"
+	// (see Scrub) instead of deleting them, for records which must be kept
+	// such as invoices.
+	Anonymize bool
+}
+
+// DataSubjectRequest records an export or erasure of a subject's data. Add
+// it to DatabaseConfig.Models to create its table.
+type DataSubjectRequest struct {
+	ID        uint   `gorm:"primaryKey"`
+	SubjectID string `gorm:"size:191;index"`
+	Kind      string `gorm:"size:16"`
+
+	// Actor is the actor stored in the context by WithActor.
+	Actor     string `gorm:"size:191"`
+	CreatedAt time.Time
+}
+
+var (
+	personalDataMu sync.RWMutex
+	personalData   []PersonalData
+)
+
+// RegisterPersonalData adds models to those searched by ExportUserData and
+// EraseUserData.
+func RegisterPersonalData(models ...PersonalData) {
+	personalDataMu.Lock()
+	defer personalDataMu.Unlock()
+
+	personalData = append(personalData, models...)
+}
+
+// ExportUserData returns every row linked to subjectID in the registered
+// models, including soft-deleted rows, keyed by table name, ready to encode
+// as JSON. The export is recorded as a DataSubjectRequest. The database is
+// taken from DB(ctx).
+func ExportUserData(ctx context.Context, subjectID interface{}) (map[string]interface{}, error) {
+	conn := DB(ctx)
+	if conn == nil {
+		return nil, ErrDatabaseNotInitialised
+	}
+
+	export := map[string]interface{}{}
+	for _, data := range registeredPersonalData() {
+		stmt := &gorm.Statement{DB: conn}
+		if err := stmt.Parse(data.Model); err != nil {
+			return nil, err
+		}
+
+		rows := reflect.New(reflect.SliceOf(stmt.Schema.ModelType))
+		if err := conn.Unscoped().Model(data.Model).Where(subjectCondition(data, subjectID)).Find(rows.Interface()).Error; err != nil {
+			return nil, err
+		}
+
+		export[stmt.Schema.Table] = rows.Elem().Interface()
+	}
+
+	if err := recordDataSubjectRequest(ctx, conn, subjectID, "export"); err != nil {
+		return nil, err
+	}
+
+	return export, nil
+}
+
+// EraseUserData permanently deletes or anonymizes every row linked to
+// subjectID in the registered models, including soft-deleted rows, in one
+// transaction, recording the erasure as a DataSubjectRequest. Models are
+// processed in reverse registration order, so register parent tables before
+// the tables referencing them. The database is taken from DB(ctx).
+func EraseUserData(ctx context.Context, subjectID interface{}) error {
+	conn := DB(ctx)
+	if conn == nil {
+		return ErrDatabaseNotInitialised
+	}
+
+	models := registeredPersonalData()
+
+	return conn.Transaction(func(tx *gorm.DB) error {
+		for i := len(models) - 1; i >= 0; i-- {
+			data := models[i]
+			condition := subjectCondition(data, subjectID)
+
+			if data.Anonymize {
+				scope := func(db *gorm.DB) *gorm.DB { return db.Unscoped().Where(condition) }
+				if err := scrubModel(ctx, tx, 500, data.Model, scope); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if err := tx.Unscoped().Where(condition).Delete(data.Model).Error; err != nil {
+				return err
+			}
+		}
+
+		return recordDataSubjectRequest(ctx, tx, subjectID, "erase")
+	})
+}
+
+func registeredPersonalData() []PersonalData {
+	personalDataMu.RLock()
+	defer personalDataMu.RUnlock()
+
+	return append([]PersonalData(nil), personalData...)
+}
+
+func subjectCondition(data PersonalData, subjectID interface{}) clause.Expression {
+	return clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: data.SubjectColumn}, Value: subjectID}
+}
+
+func recordDataSubjectRequest(ctx context.Context, conn *gorm.DB, subjectID interface{}, kind string) error {
+	request := DataSubjectRequest{SubjectID: fmt.Sprint(subjectID), Kind: kind, Actor: Actor(ctx)}
+	return conn.WithContext(ctx).Create(&request).Error
+}
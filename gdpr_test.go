@@ -0,0 +1,111 @@
+package cservice
+
+import (
+	"context"
+	"testing"
+
+	"gorm.io/gorm"
+
+	"github.com/crockerio/cservice/cservicetest"
+)
+
+type gdprOrder struct {
+	ID     uint
+	UserID uint
+	Item   string
+}
+
+type gdprInvoice struct {
+	ID     uint
+	UserID uint
+	Name   string `scrub:"name"`
+	Total  int
+}
+
+func registerTestPersonalData(t *testing.T, models ...PersonalData) {
+	personalDataMu.Lock()
+	saved := personalData
+	personalData = nil
+	personalDataMu.Unlock()
+
+	t.Cleanup(func() {
+		personalDataMu.Lock()
+		personalData = saved
+		personalDataMu.Unlock()
+	})
+
+	RegisterPersonalData(models...)
+}
+
+func seedPersonalData(t *testing.T) (context.Context, *gorm.DB) {
+	db := cservicetest.OpenDB(t, &gdprOrder{}, &gdprInvoice{}, &DataSubjectRequest{})
+	registerTestPersonalData(t,
+		PersonalData{Model: &gdprOrder{}, SubjectColumn: "user_id"},
+		PersonalData{Model: &gdprInvoice{}, SubjectColumn: "user_id", Anonymize: true},
+	)
+
+	orders := []gdprOrder{{UserID: 1, Item: "book"}, {UserID: 1, Item: "pen"}, {UserID: 2, Item: "mug"}}
+	invoices := []gdprInvoice{{UserID: 1, Name: "Ann", Total: 12}, {UserID: 2, Name: "Bob", Total: 5}}
+	if err := db.Create(&orders).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&invoices).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	return WithDB(context.Background(), db), db
+}
+
+func TestExportUserData(t *testing.T) {
+	ctx, db := seedPersonalData(t)
+
+	export, err := ExportUserData(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if orders := export["gdpr_orders"].([]gdprOrder); len(orders) != 2 {
+		t.Errorf("exported %d orders, want 2", len(orders))
+	}
+	if invoices := export["gdpr_invoices"].([]gdprInvoice); len(invoices) != 1 || invoices[0].Name != "Ann" {
+		t.Errorf("exported invoices %+v", invoices)
+	}
+
+	var requests int64
+	db.Model(&DataSubjectRequest{}).Where("subject_id = ? AND kind = ?", "1", "export").Count(&requests)
+	if requests != 1 {
+		t.Errorf("recorded %d export requests, want 1", requests)
+	}
+}
+
+func TestEraseUserData(t *testing.T) {
+	ctx, db := seedPersonalData(t)
+
+	if err := EraseUserData(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	var orders []gdprOrder
+	db.Order("id").Find(&orders)
+	if len(orders) != 1 || orders[0].UserID != 2 {
+		t.Errorf("orders left %+v, want only user 2's", orders)
+	}
+
+	var invoices []gdprInvoice
+	db.Order("id").Find(&invoices)
+	if len(invoices) != 2 {
+		t.Fatalf("got %d invoices, want 2 kept", len(invoices))
+	}
+	if invoices[0].Name == "Ann" || invoices[0].Total != 12 {
+		t.Errorf("user 1's invoice not anonymized: %+v", invoices[0])
+	}
+	if invoices[1].Name != "Bob" {
+		t.Errorf("user 2's invoice changed: %+v", invoices[1])
+	}
+
+	var requests int64
+	db.Model(&DataSubjectRequest{}).Where("subject_id = ? AND kind = ?", "1", "erase").Count(&requests)
+	if requests != 1 {
+		t.Errorf("recorded %d erase requests, want 1", requests)
+	}
+}
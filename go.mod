@@ -1,8 +1,18 @@
 module github.com/crockerio/cservice
 
-go 1.16
+go 1.18
 
 require (
+	github.com/go-sql-driver/mysql v1.6.0
+	github.com/jinzhu/inflection v1.0.0
+	golang.org/x/crypto v0.0.0-20210616213533-5ff15b29337e
 	gorm.io/driver/mysql v1.1.1
+	gorm.io/driver/sqlite v1.1.4
 	gorm.io/gorm v1.21.11
 )
+
+require (
+	github.com/jinzhu/now v1.1.2 // indirect
+	github.com/mattn/go-sqlite3 v1.14.5 // indirect
+	golang.org/x/sys v0.0.0-20210615035016-665e8c7367d1 // indirect
+)
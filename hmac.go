@@ -0,0 +1,238 @@
+package cservice
+
+import (
+	"bytes"
+	"container/heap"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Headers carrying an HMAC request signature.
+const (
+	HeaderClientID  = "X-Client-ID"
+	HeaderTimestamp = "X-Timestamp"
+	HeaderSignature = "X-Signature"
+)
+
+// HMACConfig defines how signed requests are verified.
+type HMACConfig struct {
+	// Secret returns the shared secret of the given client. Returning an
+	// error rejects the request.
+	Secret func(ctx context.Context, clientID string) ([]byte, error)
+
+	// Window is how far a request's timestamp may be from the current time.
+	// Signatures are remembered for this long to reject replays. Defaults to
+	// 5 minutes.
+	Window time.Duration
+
+	// MaxBodySize is the largest body which will be read to verify the
+	// signature. Defaults to 1MB.
+	MaxBodySize int64
+
+	// MaxReplayEntries caps the number of signatures remembered. Once it is
+	// reached, new signatures are rejected with 503 Service Unavailable until
+	// old ones expire, rather than risk accepting replays. Defaults to
+	// 100000.
+	MaxReplayEntries int
+
+	// Clock provides the current time. Defaults to SystemClock.
+	Clock Clock
+}
+
+// SignRequest signs r for clientID with secret, setting the signature
+// headers. The body is read and replaced so r can still be sent.
+func SignRequest(r *http.Request, clientID string, secret []byte, now time.Time) error {
+	var body []byte
+	if r.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(r.Body)
+		if err != nil {
+			return err
+		}
+		r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	r.Header.Set(HeaderClientID, clientID)
+	r.Header.Set(HeaderTimestamp, timestamp)
+	r.Header.Set(HeaderSignature, hex.EncodeToString(signature(secret, timestamp, r.Method, r.URL.RequestURI(), body)))
+
+	return nil
+}
+
+type hmacClientKey struct{}
+
+// HMACClientID returns the ID of the client which signed the request ctx
+// belongs to, or an empty string.
+func HMACClientID(ctx context.Context) string {
+	id, _ := ctx.Value(hmacClientKey{}).(string)
+	return id
+}
+
+// VerifyHMAC returns middleware which responds 401 Unauthorized to requests
+// without a valid, fresh signature.
+func VerifyHMAC(config HMACConfig) func(http.Handler) http.Handler {
+	window := config.Window
+	if window <= 0 {
+		window = 5 * time.Minute
+	}
+
+	maxBody := config.MaxBodySize
+	if maxBody <= 0 {
+		maxBody = 1 << 20
+	}
+
+	maxEntries := config.MaxReplayEntries
+	if maxEntries <= 0 {
+		maxEntries = 100000
+	}
+
+	clock := clockOrSystem(config.Clock)
+	seen := &replayCache{entries: map[string]time.Time{}, max: maxEntries}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			unauthorized := func() {
+				http.Error(rw, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			}
+
+			clientID := r.Header.Get(HeaderClientID)
+			timestamp := r.Header.Get(HeaderTimestamp)
+			given, err := hex.DecodeString(r.Header.Get(HeaderSignature))
+			if clientID == "" || timestamp == "" || err != nil || len(given) == 0 {
+				unauthorized()
+				return
+			}
+
+			seconds, err := strconv.ParseInt(timestamp, 10, 64)
+			if err != nil {
+				unauthorized()
+				return
+			}
+
+			now := clock.Now()
+			if age := now.Sub(time.Unix(seconds, 0)); age > window || age < -window {
+				unauthorized()
+				return
+			}
+
+			secret, err := config.Secret(r.Context(), clientID)
+			if err != nil || len(secret) == 0 {
+				unauthorized()
+				return
+			}
+
+			var body []byte
+			if r.Body != nil {
+				body, err = ioutil.ReadAll(io.LimitReader(r.Body, maxBody+1))
+				if err != nil {
+					unauthorized()
+					return
+				}
+				if int64(len(body)) > maxBody {
+					http.Error(rw, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+					return
+				}
+				r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			}
+
+			expected := signature(secret, timestamp, r.Method, r.URL.RequestURI(), body)
+			if !hmac.Equal(given, expected) {
+				unauthorized()
+				return
+			}
+
+			switch seen.add(clientID+":"+hex.EncodeToString(given), now, 2*window) {
+			case replaySeen:
+				unauthorized()
+				return
+			case replayFull:
+				http.Error(rw, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+				return
+			}
+
+			next.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), hmacClientKey{}, clientID)))
+		})
+	}
+}
+
+// signature computes the HMAC-SHA256 of the signed request parts.
+func signature(secret []byte, timestamp, method, uri string, body []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "\n" + method + "\n" + uri + "\n"))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// replayCache remembers signatures seen within the replay window. Expiries
+// are kept in a heap so each request only evicts expired entries.
+type replayCache struct {
+	mu      sync.Mutex
+	entries map[string]time.Time
+	expiry  replayHeap
+	max     int
+}
+
+type replayResult int
+
+const (
+	replayAdded replayResult = iota
+	replaySeen
+	replayFull
+)
+
+// add records key until now+ttl, reporting whether it was already seen or
+// the cache is full.
+func (c *replayCache) add(key string, now time.Time, ttl time.Duration) replayResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for len(c.expiry) > 0 && !c.expiry[0].expires.After(now) {
+		entry := heap.Pop(&c.expiry).(replayEntry)
+		delete(c.entries, entry.key)
+	}
+
+	if _, ok := c.entries[key]; ok {
+		return replaySeen
+	}
+
+	if len(c.entries) >= c.max {
+		return replayFull
+	}
+
+	expires := now.Add(ttl)
+	c.entries[key] = expires
+	heap.Push(&c.expiry, replayEntry{key: key, expires: expires})
+
+	return replayAdded
+}
+
+type replayEntry struct {
+	key     string
+	expires time.Time
+}
+
+// replayHeap orders entries by expiry, implementing heap.Interface.
+type replayHeap []replayEntry
+
+func (h replayHeap) Len() int            { return len(h) }
+func (h replayHeap) Less(i, j int) bool  { return h[i].expires.Before(h[j].expires) }
+func (h replayHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *replayHeap) Push(x interface{}) { *h = append(*h, x.(replayEntry)) }
+
+func (h *replayHeap) Pop() interface{} {
+	old := *h
+	entry := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return entry
+}
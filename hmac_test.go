@@ -0,0 +1,64 @@
+package cservice
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyHMAC(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	secret := []byte("secret")
+
+	handler := VerifyHMAC(HMACConfig{
+		Secret:           func(ctx context.Context, clientID string) ([]byte, error) { return secret, nil },
+		Window:           time.Minute,
+		MaxReplayEntries: 2,
+		Clock:            clock,
+	})(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+
+	signed := func(body string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader(body))
+		if err := SignRequest(req, "client", secret, clock.Now()); err != nil {
+			t.Fatal(err)
+		}
+		return req
+	}
+
+	serve := func(req *http.Request) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := serve(signed("a")); code != http.StatusOK {
+		t.Fatalf("signed request: got %d", code)
+	}
+
+	// Signing the same body at the same time repeats the signature.
+	if code := serve(signed("a")); code != http.StatusUnauthorized {
+		t.Errorf("replay: got %d", code)
+	}
+
+	tampered := signed("b")
+	tampered.Header.Set(HeaderTimestamp, "1700000001")
+	if code := serve(tampered); code != http.StatusUnauthorized {
+		t.Errorf("tampered: got %d", code)
+	}
+
+	if code := serve(signed("c")); code != http.StatusOK {
+		t.Fatalf("second request: got %d", code)
+	}
+	if code := serve(signed("d")); code != http.StatusServiceUnavailable {
+		t.Errorf("full replay cache: got %d", code)
+	}
+
+	// Remembered signatures expire after twice the window.
+	clock.Advance(2 * time.Minute)
+	if code := serve(signed("d")); code != http.StatusOK {
+		t.Errorf("after expiry: got %d", code)
+	}
+}
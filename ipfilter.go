@@ -0,0 +1,139 @@
+package cservice
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// IPFilterConfig defines the client addresses an IPFilter admits.
+type IPFilterConfig struct {
+	// Allow lists the IPs or CIDR ranges which may make requests. An empty
+	// list allows every address not denied.
+	Allow []string
+
+	// Deny lists the IPs or CIDR ranges which are rejected. Deny takes
+	// precedence over Allow.
+	Deny []string
+
+	// TrustedProxies lists the IPs or CIDR ranges of proxies whose
+	// X-Forwarded-For header is trusted.
+	TrustedProxies []string
+
+	// TrustedHops is the number of proxies in front of the service. The
+	// client address is taken this many entries from the end of
+	// X-Forwarded-For. Defaults to 1.
+	TrustedHops int
+}
+
+// IPFilter returns middleware which responds 403 Forbidden to clients not
+// admitted by config.
+func IPFilter(config IPFilterConfig) (func(http.Handler) http.Handler, error) {
+	allow, err := parseNetworks(config.Allow)
+	if err != nil {
+		return nil, err
+	}
+
+	deny, err := parseNetworks(config.Deny)
+	if err != nil {
+		return nil, err
+	}
+
+	proxies, err := parseNetworks(config.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	hops := config.TrustedHops
+	if hops <= 0 {
+		hops = 1
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			ip := ClientIP(r, proxies, hops)
+			if ip == nil || containsIP(deny, ip) || (len(allow) > 0 && !containsIP(allow, ip)) {
+				http.Error(rw, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(rw, r)
+		})
+	}, nil
+}
+
+// ClientIP returns the address of the client which made r. X-Forwarded-For is
+// only consulted when the connecting peer is one of the trusted proxies, in
+// which case the entry hops from the end of the header is used.
+func ClientIP(r *http.Request, trustedProxies []*net.IPNet, hops int) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	peer := net.ParseIP(host)
+	if peer == nil || !containsIP(trustedProxies, peer) {
+		return peer
+	}
+
+	var forwarded []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, entry := range strings.Split(header, ",") {
+			if entry = strings.TrimSpace(entry); entry != "" {
+				forwarded = append(forwarded, entry)
+			}
+		}
+	}
+
+	if len(forwarded) == 0 {
+		return peer
+	}
+
+	index := len(forwarded) - hops
+	if index < 0 {
+		index = 0
+	}
+
+	return net.ParseIP(forwarded[index])
+}
+
+func parseNetworks(values []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(values))
+
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("cservice: invalid IP address %q", value)
+			}
+
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("cservice: invalid CIDR %q: %w", value, err)
+		}
+
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package cservice
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIPFilter(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     IPFilterConfig
+		remoteAddr string
+		forwarded  string
+		want       int
+	}{
+		{"allowed range", IPFilterConfig{Allow: []string{"10.0.0.0/8"}}, "10.1.2.3:5000", "", http.StatusOK},
+		{"outside allowed range", IPFilterConfig{Allow: []string{"10.0.0.0/8"}}, "192.168.1.1:5000", "", http.StatusForbidden},
+		{"no allow list", IPFilterConfig{Deny: []string{"10.0.0.1"}}, "192.168.1.1:5000", "", http.StatusOK},
+		{"deny beats allow", IPFilterConfig{Allow: []string{"10.0.0.0/8"}, Deny: []string{"10.0.0.0/24"}}, "10.0.0.9:5000", "", http.StatusForbidden},
+		{"allowed next to denied", IPFilterConfig{Allow: []string{"10.0.0.0/8"}, Deny: []string{"10.0.0.0/24"}}, "10.0.1.9:5000", "", http.StatusOK},
+		{"IPv6 range", IPFilterConfig{Allow: []string{"2001:db8::/32"}}, "[2001:db8::1]:5000", "", http.StatusOK},
+		{"IPv6 outside range", IPFilterConfig{Allow: []string{"2001:db8::/32"}}, "[2001:db9::1]:5000", "", http.StatusForbidden},
+		{"IPv6 single address", IPFilterConfig{Deny: []string{"2001:db8::1"}}, "[2001:db8::1]:5000", "", http.StatusForbidden},
+		{"IPv4-mapped peer", IPFilterConfig{Allow: []string{"10.0.0.0/8"}}, "[::ffff:10.0.0.1]:5000", "", http.StatusOK},
+		{"IPv4-mapped peer denied", IPFilterConfig{Deny: []string{"10.0.0.1"}}, "[::ffff:10.0.0.1]:5000", "", http.StatusForbidden},
+		{"unparseable peer", IPFilterConfig{}, "not-an-ip", "", http.StatusForbidden},
+		{
+			"spoofed header from untrusted peer",
+			IPFilterConfig{Allow: []string{"10.0.0.0/8"}, TrustedProxies: []string{"172.16.0.1"}},
+			"203.0.113.5:5000", "10.0.0.1", http.StatusForbidden,
+		},
+		{
+			"header from trusted proxy",
+			IPFilterConfig{Allow: []string{"10.0.0.0/8"}, TrustedProxies: []string{"172.16.0.1"}},
+			"172.16.0.1:5000", "10.0.0.1", http.StatusOK,
+		},
+		{
+			"client prepending a spoofed entry",
+			IPFilterConfig{Allow: []string{"10.0.0.0/8"}, TrustedProxies: []string{"172.16.0.0/12"}},
+			"172.16.0.1:5000", "10.0.0.1, 203.0.113.5", http.StatusForbidden,
+		},
+		{
+			"two trusted hops",
+			IPFilterConfig{Allow: []string{"10.0.0.0/8"}, TrustedProxies: []string{"172.16.0.0/12"}, TrustedHops: 2},
+			"172.16.0.1:5000", "203.0.113.9, 10.0.0.1, 172.16.0.2", http.StatusOK,
+		},
+		{
+			"garbage forwarded entry",
+			IPFilterConfig{TrustedProxies: []string{"172.16.0.1"}},
+			"172.16.0.1:5000", "unknown", http.StatusForbidden,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filter, err := IPFilter(test.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = test.remoteAddr
+			if test.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", test.forwarded)
+			}
+
+			rec := httptest.NewRecorder()
+			filter(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {})).ServeHTTP(rec, req)
+
+			if rec.Code != test.want {
+				t.Errorf("got %d, want %d", rec.Code, test.want)
+			}
+		})
+	}
+}
+
+func TestIPFilterInvalidConfig(t *testing.T) {
+	configs := []IPFilterConfig{
+		{Allow: []string{"10.0.0.300"}},
+		{Deny: []string{"10.0.0.0/33"}},
+		{TrustedProxies: []string{"proxy.internal"}},
+		{Allow: []string{""}},
+	}
+
+	for _, config := range configs {
+		if _, err := IPFilter(config); err == nil {
+			t.Errorf("IPFilter(%+v) accepted invalid config", config)
+		}
+	}
+}
@@ -0,0 +1,574 @@
+package cservice
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+)
+
+// ErrMailQueueFull is returned by Mailer.Queue when the send queue is full.
+var ErrMailQueueFull = errors.New("cservice: mail queue is full")
+
+// ErrMailerClosed is returned by Mailer.Queue after Close.
+var ErrMailerClosed = errors.New("cservice: mailer is closed")
+
+// Message is an email.
+type Message struct {
+	From    string
+	To      []string
+	Cc      []string
+	Bcc     []string
+	ReplyTo string
+	Subject string
+
+	// Text is the plain text body.
+	Text string
+
+	// HTML is the HTML body.
+	HTML string
+
+	// Headers are extra headers to send.
+	Headers map[string]string
+
+	// Date is sent as the Date header. Defaults to the current time.
+	Date time.Time
+}
+
+// Recipients returns every address the message is delivered to.
+func (m *Message) Recipients() []string {
+	recipients := make([]string, 0, len(m.To)+len(m.Cc)+len(m.Bcc))
+	recipients = append(recipients, m.To...)
+	recipients = append(recipients, m.Cc...)
+	return append(recipients, m.Bcc...)
+}
+
+// Bytes renders the message in RFC 5322 format. Bcc recipients are omitted.
+func (m *Message) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+
+	header := textproto.MIMEHeader{}
+	header.Set("From", m.From)
+	header.Set("To", strings.Join(m.To, ", "))
+	if len(m.Cc) > 0 {
+		header.Set("Cc", strings.Join(m.Cc, ", "))
+	}
+	if m.ReplyTo != "" {
+		header.Set("Reply-To", m.ReplyTo)
+	}
+	header.Set("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	date := m.Date
+	if date.IsZero() {
+		date = SystemClock.Now()
+	}
+	header.Set("Date", date.Format(time.RFC1123Z))
+	header.Set("MIME-Version", "1.0")
+	for name, value := range m.Headers {
+		header.Set(name, value)
+	}
+
+	for name, values := range header {
+		for _, value := range values {
+			if strings.ContainsAny(name+value, "\r\n") {
+				return nil, fmt.Errorf("cservice: invalid mail header %s", name)
+			}
+		}
+	}
+
+	switch {
+	case m.Text != "" && m.HTML != "":
+		writer := multipart.NewWriter(&buf)
+		header.Set("Content-Type", "multipart/alternative; boundary="+writer.Boundary())
+		writeHeader(&buf, header)
+
+		for _, part := range []struct{ contentType, body string }{
+			{"text/plain; charset=utf-8", m.Text},
+			{"text/html; charset=utf-8", m.HTML},
+		} {
+			w, err := writer.CreatePart(textproto.MIMEHeader{
+				"Content-Type":              {part.contentType},
+				"Content-Transfer-Encoding": {"quoted-printable"},
+			})
+			if err != nil {
+				return nil, err
+			}
+			if err := writeQuotedPrintable(w, part.body); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+	default:
+		contentType, body := "text/plain; charset=utf-8", m.Text
+		if m.HTML != "" {
+			contentType, body = "text/html; charset=utf-8", m.HTML
+		}
+
+		header.Set("Content-Type", contentType)
+		header.Set("Content-Transfer-Encoding", "quoted-printable")
+		writeHeader(&buf, header)
+
+		if err := writeQuotedPrintable(&buf, body); err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+func writeHeader(buf *bytes.Buffer, header textproto.MIMEHeader) {
+	for name, values := range header {
+		for _, value := range values {
+			buf.WriteString(name + ": " + value + "\r\n")
+		}
+	}
+	buf.WriteString("\r\n")
+}
+
+func writeQuotedPrintable(w interface{ Write([]byte) (int, error) }, body string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// MailTransport delivers messages.
+type MailTransport interface {
+	Send(ctx context.Context, message *Message) error
+}
+
+// SMTPTransport delivers messages through an SMTP server.
+type SMTPTransport struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+
+	// Timeout limits each delivery, including connecting, within any
+	// deadline of the context passed to Send. Defaults to 30 seconds.
+	Timeout time.Duration
+
+	// RequireTLS fails deliveries to servers which do not offer STARTTLS
+	// instead of sending them in plain text.
+	RequireTLS bool
+
+	// ImplicitTLS connects with TLS from the start rather than upgrading
+	// with STARTTLS, as servers on port 465 expect. Port 465 implies it.
+	ImplicitTLS bool
+
+	// TLSConfig configures TLS connections. Defaults to verifying the server
+	// certificate against Host.
+	TLSConfig *tls.Config
+}
+
+// Send delivers message, upgrading to TLS when the server supports STARTTLS.
+// Cancelling ctx aborts the delivery.
+func (t *SMTPTransport) Send(ctx context.Context, message *Message) error {
+	body, err := message.Bytes()
+	if err != nil {
+		return err
+	}
+
+	timeout := t.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err = t.send(ctx, message, body)
+	if err == nil {
+		return nil
+	}
+
+	// The connection shares ctx's deadline, so an I/O timeout can surface a
+	// moment before ctx itself reports it.
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		<-ctx.Done()
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+
+	return err
+}
+
+func (t *SMTPTransport) send(ctx context.Context, message *Message, body []byte) error {
+	addr := net.JoinHostPort(t.Host, strconv.Itoa(t.Port))
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	implicitTLS := t.ImplicitTLS || t.Port == 465
+	if implicitTLS {
+		conn = tls.Client(conn, t.tlsConfig())
+	}
+
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return err
+	}
+
+	// Unblock any pending I/O if ctx is cancelled before the deadline.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Unix(1, 0))
+		case <-done:
+		}
+	}()
+
+	client, err := smtp.NewClient(conn, t.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if !implicitTLS {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(t.tlsConfig()); err != nil {
+				return err
+			}
+		} else if t.RequireTLS {
+			return errors.New("cservice: SMTP server does not support STARTTLS")
+		}
+	}
+
+	if t.Username != "" {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return errors.New("cservice: SMTP server does not support authentication")
+		}
+		if err := client.Auth(smtp.PlainAuth("", t.Username, t.Password, t.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(message.From); err != nil {
+		return err
+	}
+
+	for _, recipient := range message.Recipients() {
+		if err := client.Rcpt(recipient); err != nil {
+			return err
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+func (t *SMTPTransport) tlsConfig() *tls.Config {
+	if t.TLSConfig == nil {
+		return &tls.Config{ServerName: t.Host}
+	}
+
+	config := t.TLSConfig.Clone()
+	if config.ServerName == "" {
+		config.ServerName = t.Host
+	}
+	return config
+}
+
+// APITransport delivers messages through an HTTP email provider. NewRequest
+// builds the provider-specific request for a message; any 2xx response is
+// treated as success.
+type APITransport struct {
+	// Client sends the requests. Defaults to a client with a 30 second
+	// timeout.
+	Client *http.Client
+
+	NewRequest func(ctx context.Context, message *Message) (*http.Request, error)
+}
+
+// Send delivers message.
+func (t *APITransport) Send(ctx context.Context, message *Message) error {
+	req, err := t.NewRequest(ctx, message)
+	if err != nil {
+		return err
+	}
+
+	client := t.Client
+	if client == nil {
+		client = notifyHTTPClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("cservice: mail provider responded %s", resp.Status)
+	}
+
+	return nil
+}
+
+// CaptureTransport records messages instead of delivering them, for tests
+// and local development.
+type CaptureTransport struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+// Send records message.
+func (t *CaptureTransport) Send(ctx context.Context, message *Message) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.messages = append(t.messages, *message)
+	return nil
+}
+
+// Messages returns the recorded messages.
+func (t *CaptureTransport) Messages() []Message {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]Message(nil), t.messages...)
+}
+
+// Reset discards the recorded messages.
+func (t *CaptureTransport) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.messages = nil
+}
+
+// MailTemplates renders message bodies from templates named NAME.html and
+// NAME.txt.
+type MailTemplates struct {
+	html *htmltemplate.Template
+	text *texttemplate.Template
+}
+
+// LoadMailTemplates parses the templates in fsys, e.g. an embed.FS, matching
+// the given patterns. Files ending .html are parsed as HTML templates and
+// files ending .txt as text templates, so layouts and partials can be shared
+// with {{template}}.
+func LoadMailTemplates(fsys fs.FS, patterns ...string) (*MailTemplates, error) {
+	t := &MailTemplates{
+		html: htmltemplate.New(""),
+		text: texttemplate.New(""),
+	}
+
+	for _, pattern := range patterns {
+		matches, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, match := range matches {
+			source, err := fs.ReadFile(fsys, match)
+			if err != nil {
+				return nil, err
+			}
+
+			name := match[strings.LastIndex(match, "/")+1:]
+			switch {
+			case strings.HasSuffix(name, ".html"):
+				_, err = t.html.New(name).Parse(string(source))
+			case strings.HasSuffix(name, ".txt"):
+				_, err = t.text.New(name).Parse(string(source))
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return t, nil
+}
+
+// Render executes the name.txt and name.html templates with data. Either may
+// be missing, but not both.
+func (t *MailTemplates) Render(name string, data interface{}) (text, html string, err error) {
+	var buf bytes.Buffer
+
+	if tmpl := t.text.Lookup(name + ".txt"); tmpl != nil {
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return "", "", err
+		}
+		text = buf.String()
+		buf.Reset()
+	}
+
+	if tmpl := t.html.Lookup(name + ".html"); tmpl != nil {
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return "", "", err
+		}
+		html = buf.String()
+	}
+
+	if text == "" && html == "" {
+		return "", "", fmt.Errorf("cservice: no mail template named %q", name)
+	}
+
+	return text, html, nil
+}
+
+// MailerConfig defines how a Mailer sends messages.
+type MailerConfig struct {
+	// Transport delivers messages.
+	Transport MailTransport
+
+	// Templates renders templated messages.
+	Templates *MailTemplates
+
+	// From is the sender used when a message has none.
+	From string
+
+	// QueueSize is the number of messages Queue can buffer. Defaults to 100.
+	QueueSize int
+
+	// Workers is the number of goroutines sending queued messages. Defaults
+	// to 1.
+	Workers int
+
+	// OnError is called when a queued message fails to send.
+	OnError func(message *Message, err error)
+
+	// Clock dates messages. Defaults to SystemClock.
+	Clock Clock
+}
+
+// Mailer sends email synchronously or through an in-process queue.
+type Mailer struct {
+	config MailerConfig
+	queue  chan *Message
+	wg     sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewMailer creates a Mailer and starts its queue workers.
+func NewMailer(config MailerConfig) *Mailer {
+	if config.QueueSize <= 0 {
+		config.QueueSize = 100
+	}
+
+	if config.Workers <= 0 {
+		config.Workers = 1
+	}
+
+	config.Clock = clockOrSystem(config.Clock)
+
+	m := &Mailer{config: config, queue: make(chan *Message, config.QueueSize)}
+
+	for i := 0; i < config.Workers; i++ {
+		m.wg.Add(1)
+		go m.work()
+	}
+
+	return m
+}
+
+// Send delivers message immediately. Defaults for the sender and date are
+// applied to a copy, leaving message unchanged.
+func (m *Mailer) Send(ctx context.Context, message *Message) error {
+	msg := *message
+	if msg.From == "" {
+		msg.From = m.config.From
+	}
+	if msg.Date.IsZero() {
+		msg.Date = m.config.Clock.Now()
+	}
+
+	return m.config.Transport.Send(ctx, &msg)
+}
+
+// Render builds a message to the given recipients from the named template.
+func (m *Mailer) Render(to []string, subject, template string, data interface{}) (*Message, error) {
+	if m.config.Templates == nil {
+		return nil, errors.New("cservice: mailer has no templates")
+	}
+
+	text, html, err := m.config.Templates.Render(template, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Message{From: m.config.From, To: to, Subject: subject, Text: text, HTML: html}, nil
+}
+
+// Queue sends message in the background. Failures are reported to
+// MailerConfig.OnError.
+func (m *Mailer) Queue(message *Message) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.closed {
+		return ErrMailerClosed
+	}
+
+	select {
+	case m.queue <- message:
+		return nil
+	default:
+		return ErrMailQueueFull
+	}
+}
+
+// Close stops accepting queued messages and waits for the queue to drain.
+func (m *Mailer) Close() {
+	m.mu.Lock()
+	if !m.closed {
+		m.closed = true
+		close(m.queue)
+	}
+	m.mu.Unlock()
+
+	m.wg.Wait()
+}
+
+func (m *Mailer) work() {
+	defer m.wg.Done()
+
+	for message := range m.queue {
+		if err := m.Send(context.Background(), message); err != nil && m.config.OnError != nil {
+			m.config.OnError(message, err)
+		}
+	}
+}
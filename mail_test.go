@@ -0,0 +1,231 @@
+package cservice
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpServer starts a listener handing each connection to serve.
+func smtpServer(t *testing.T, serve func(conn net.Conn)) *SMTPTransport {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				serve(conn)
+			}()
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	return &SMTPTransport{Host: "127.0.0.1", Port: addr.Port}
+}
+
+// serveSMTP speaks enough SMTP to accept one message, sending its data to
+// received. STARTTLS is offered when config is not nil.
+func serveSMTP(conn net.Conn, config *tls.Config, received chan<- string) {
+	r := bufio.NewReader(conn)
+	conn.Write([]byte("220 test ready\r\n"))
+
+	var data strings.Builder
+	inData := false
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		if inData {
+			if line == ".\r\n" {
+				inData = false
+				received <- data.String()
+				conn.Write([]byte("250 queued\r\n"))
+			} else {
+				data.WriteString(line)
+			}
+			continue
+		}
+
+		switch strings.ToUpper(strings.Fields(line)[0]) {
+		case "EHLO":
+			if config != nil {
+				conn.Write([]byte("250-test\r\n250 STARTTLS\r\n"))
+			} else {
+				conn.Write([]byte("250 test\r\n"))
+			}
+		case "STARTTLS":
+			conn.Write([]byte("220 ready\r\n"))
+			conn = tls.Server(conn, config)
+			r = bufio.NewReader(conn)
+			config = nil
+		case "DATA":
+			inData = true
+			conn.Write([]byte("354 go ahead\r\n"))
+		case "QUIT":
+			conn.Write([]byte("221 bye\r\n"))
+			return
+		default:
+			conn.Write([]byte("250 ok\r\n"))
+		}
+	}
+}
+
+// testTLSConfigs returns matching server and client configurations for a
+// certificate valid for 127.0.0.1.
+func testTLSConfigs(t *testing.T) (server, client *tls.Config) {
+	t.Helper()
+
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+
+	return &tls.Config{Certificates: srv.TLS.Certificates}, &tls.Config{RootCAs: roots}
+}
+
+func TestSMTPTransportSend(t *testing.T) {
+	received := make(chan string, 1)
+	transport := smtpServer(t, func(conn net.Conn) {
+		serveSMTP(conn, nil, received)
+	})
+
+	message := &Message{From: "app@example.com", To: []string{"user@example.com"}, Subject: "Hi", Text: "Hello"}
+	if err := transport.Send(context.Background(), message); err != nil {
+		t.Fatal(err)
+	}
+
+	if data := <-received; !strings.Contains(data, "Subject: Hi") {
+		t.Errorf("server received %q", data)
+	}
+}
+
+func TestSMTPTransportTLS(t *testing.T) {
+	serverConfig, clientConfig := testTLSConfigs(t)
+	message := &Message{From: "app@example.com", To: []string{"user@example.com"}, Subject: "Hi", Text: "Hello"}
+
+	t.Run("STARTTLS required but not offered", func(t *testing.T) {
+		received := make(chan string, 1)
+		transport := smtpServer(t, func(conn net.Conn) {
+			serveSMTP(conn, nil, received)
+		})
+		transport.RequireTLS = true
+
+		if err := transport.Send(context.Background(), message); err == nil {
+			t.Fatal("message sent without TLS")
+		}
+		select {
+		case data := <-received:
+			t.Errorf("server received %q", data)
+		default:
+		}
+	})
+
+	t.Run("STARTTLS", func(t *testing.T) {
+		received := make(chan string, 1)
+		transport := smtpServer(t, func(conn net.Conn) {
+			serveSMTP(conn, serverConfig, received)
+		})
+		transport.RequireTLS = true
+		transport.TLSConfig = clientConfig
+
+		if err := transport.Send(context.Background(), message); err != nil {
+			t.Fatal(err)
+		}
+		if data := <-received; !strings.Contains(data, "Subject: Hi") {
+			t.Errorf("server received %q", data)
+		}
+	})
+
+	t.Run("implicit TLS", func(t *testing.T) {
+		received := make(chan string, 1)
+		transport := smtpServer(t, func(conn net.Conn) {
+			serveSMTP(tls.Server(conn, serverConfig), nil, received)
+		})
+		transport.ImplicitTLS = true
+		transport.TLSConfig = clientConfig
+
+		if err := transport.Send(context.Background(), message); err != nil {
+			t.Fatal(err)
+		}
+		if data := <-received; !strings.Contains(data, "Subject: Hi") {
+			t.Errorf("server received %q", data)
+		}
+	})
+}
+
+func TestMailerSend(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC))
+	transport := &CaptureTransport{}
+	mailer := NewMailer(MailerConfig{Transport: transport, From: "app@example.com", Clock: clock})
+	defer mailer.Close()
+
+	message := &Message{To: []string{"user@example.com"}, Subject: "Hi", Text: "Hello"}
+	if err := mailer.Send(context.Background(), message); err != nil {
+		t.Fatal(err)
+	}
+
+	if message.From != "" || !message.Date.IsZero() {
+		t.Errorf("caller's message was changed: %+v", message)
+	}
+
+	sent := transport.Messages()
+	if len(sent) != 1 {
+		t.Fatalf("got %d messages", len(sent))
+	}
+	if sent[0].From != "app@example.com" {
+		t.Errorf("got sender %q", sent[0].From)
+	}
+
+	body, err := sent[0].Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), "Date: Fri, 01 Mar 2024 09:30:00 +0000\r\n") {
+		t.Errorf("message is not dated by the clock:\n%s", body)
+	}
+}
+
+func TestSMTPTransportHungServer(t *testing.T) {
+	transport := smtpServer(t, func(conn net.Conn) {
+		// Accept but never greet.
+		time.Sleep(5 * time.Second)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := transport.Send(ctx, &Message{From: "app@example.com", To: []string{"user@example.com"}})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("send took %s", elapsed)
+	}
+
+	transport.Timeout = 50 * time.Millisecond
+	if err := transport.Send(context.Background(), &Message{From: "app@example.com", To: []string{"user@example.com"}}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("with Timeout: got %v, want deadline exceeded", err)
+	}
+}
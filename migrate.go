@@ -0,0 +1,148 @@
+package cservice
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// MigrationMode controls how InitDatabase migrates DatabaseConfig.Models.
+type MigrationMode int
+
+const (
+	// MigrateDefault migrates outside Production and does nothing in
+	// Production.
+	MigrateDefault MigrationMode = iota
+
+	// MigrateOn always migrates.
+	MigrateOn
+
+	// MigrateOff never migrates.
+	MigrateOff
+
+	// MigrateDryRun logs the statements a migration would run without
+	// running them.
+	MigrateDryRun
+)
+
+// ModelMigration lists the statements needed to bring a model's table up to
+// date.
+type ModelMigration struct {
+	// Model is the name of the model's table.
+	Model string
+
+	// Statements are the DDL statements to run.
+	Statements []string
+}
+
+// PlanMigrations returns the statements AutoMigrate would run for each of the
+// models, without running them. Models whose tables are already up to date
+// are omitted.
+func PlanMigrations(models ...interface{}) ([]ModelMigration, error) {
+	if db == nil {
+		return nil, ErrDatabaseNotInitialised
+	}
+
+	return planMigrations(db, models)
+}
+
+func planMigrations(conn *gorm.DB, models []interface{}) ([]ModelMigration, error) {
+	var plan []ModelMigration
+
+	for _, model := range models {
+		recorder := &recordingConnPool{ConnPool: conn.Statement.ConnPool, dialector: conn.Dialector}
+
+		// Setting a context clones the statement, so the recorder replaces
+		// the pool of this session only, not the one shared with conn.
+		tx := conn.Session(&gorm.Session{NewDB: true, Context: context.Background()})
+		tx.Statement.ConnPool = recorder
+		tx.Config.ConnPool = recorder
+
+		if err := tx.AutoMigrate(model); err != nil {
+			return nil, err
+		}
+
+		if len(recorder.statements) == 0 {
+			continue
+		}
+
+		stmt := &gorm.Statement{DB: conn}
+		if err := stmt.Parse(model); err != nil {
+			return nil, err
+		}
+
+		plan = append(plan, ModelMigration{Model: stmt.Table, Statements: recorder.statements})
+	}
+
+	return plan, nil
+}
+
+// migrate runs the migration for config.Models according to config.Migrate.
+func migrate(conn *gorm.DB, config *DatabaseConfig) error {
+	mode := config.Migrate
+	if mode == MigrateDefault {
+		mode = MigrateOn
+		if IsProduction() {
+			mode = MigrateOff
+		}
+	}
+
+	if mode == MigrateOff || len(config.Models) == 0 {
+		return nil
+	}
+
+	plan, err := planMigrations(conn, config.Models)
+	if err != nil {
+		return err
+	}
+
+	writer := logWriter(config)
+
+	for _, migration := range plan {
+		if mode == MigrateDryRun {
+			writer.Printf("[migrate] dry run for %s:", migration.Model)
+			for _, statement := range migration.Statements {
+				writer.Printf("[migrate]   %s;", statement)
+			}
+			continue
+		}
+
+		writer.Printf("[migrate] migrating %s (%d statements)", migration.Model, len(migration.Statements))
+	}
+
+	if mode == MigrateDryRun || len(plan) == 0 {
+		return nil
+	}
+
+	timeout := config.MigrationLockTimeout
+	if timeout <= 0 {
+		timeout = DefaultMigrationLockTimeout
+	}
+
+	// Another instance may have migrated while this one planned; AutoMigrate
+	// re-checks the schema under the lock, so it only applies what is still
+	// missing.
+	return WithMigrationLock(context.Background(), conn, "cservice_automigrate", timeout, func() error {
+		return conn.AutoMigrate(config.Models...)
+	})
+}
+
+// recordingConnPool records statements executed through it instead of running
+// them. Queries are passed through so the migrator can inspect the schema.
+type recordingConnPool struct {
+	gorm.ConnPool
+	dialector  gorm.Dialector
+	statements []string
+}
+
+func (p *recordingConnPool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	p.statements = append(p.statements, p.dialector.Explain(query, args...))
+	return driver.RowsAffected(0), nil
+}
+
+func (p *recordingConnPool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return nil, fmt.Errorf("cservice: prepared statements are not supported while planning migrations")
+}
@@ -0,0 +1,45 @@
+package cservice
+
+import (
+	"testing"
+
+	"github.com/crockerio/cservice/cservicetest"
+)
+
+type migrateWidget struct {
+	ID   uint
+	Name string
+}
+
+func TestDryRunMigrationKeepsConnection(t *testing.T) {
+	conn := cservicetest.OpenDB(t)
+	pool := conn.Statement.ConnPool
+
+	if err := migrate(conn, &DatabaseConfig{Migrate: MigrateDryRun, Models: []interface{}{&migrateWidget{}}, LogWriter: discardWriter{}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if conn.Statement.ConnPool != pool || conn.Config.ConnPool != pool {
+		t.Fatal("dry run replaced the connection pool")
+	}
+	if conn.Migrator().HasTable(&migrateWidget{}) {
+		t.Fatal("dry run created the table")
+	}
+
+	if err := migrate(conn, &DatabaseConfig{Migrate: MigrateOn, Models: []interface{}{&migrateWidget{}}, LogWriter: discardWriter{}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := conn.Create(&migrateWidget{Name: "sprocket"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var count int64
+	if err := conn.Model(&migrateWidget{}).Count(&count).Error; err != nil || count != 1 {
+		t.Fatalf("got %d rows, err %v", count, err)
+	}
+}
+
+type discardWriter struct{}
+
+func (discardWriter) Printf(string, ...interface{}) {}
@@ -0,0 +1,162 @@
+package cservice
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"hash/fnv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// mysqlLockNameLimit is the longest name GET_LOCK accepts.
+const mysqlLockNameLimit = 64
+
+// DefaultMigrationLockTimeout is how long migrations wait for another instance
+// to finish migrating.
+const DefaultMigrationLockTimeout = time.Minute
+
+// ErrLockTimeout is returned when an advisory lock could not be acquired in
+// time.
+var ErrLockTimeout = errors.New("cservice: timed out waiting for lock")
+
+// ErrMigrationLockTimeout is returned when the migration lock could not be
+// acquired in time. It is ErrLockTimeout.
+var ErrMigrationLockTimeout = ErrLockTimeout
+
+// WithMigrationLock runs fn while holding the advisory lock name, so that only
+// one instance of a service migrates at a time. See WithAdvisoryLock.
+func WithMigrationLock(ctx context.Context, conn *gorm.DB, name string, timeout time.Duration, fn func() error) error {
+	return WithAdvisoryLock(ctx, conn, name, timeout, fn)
+}
+
+// WithAdvisoryLock runs fn while holding a database advisory lock named name,
+// so that only one instance of a service runs fn at a time. It waits up to
+// timeout for the lock, returning ErrLockTimeout if it is not acquired.
+// MySQL's GET_LOCK and PostgreSQL's advisory locks are supported; other
+// databases run fn without locking. The lock is scoped to the current
+// database (or PostgreSQL schema), as the locks are shared by every database
+// on the server.
+func WithAdvisoryLock(ctx context.Context, conn *gorm.DB, name string, timeout time.Duration, fn func() error) error {
+	dialect := conn.Dialector.Name()
+	if dialect != "mysql" && dialect != "postgres" {
+		return fn()
+	}
+
+	sqlDB, err := conn.DB()
+	if err != nil {
+		return err
+	}
+
+	// Advisory locks belong to a session, so acquire and release the lock on
+	// one dedicated connection.
+	lockConn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer lockConn.Close()
+
+	name, err = databaseLockName(ctx, lockConn, dialect, name)
+	if err != nil {
+		return err
+	}
+
+	if dialect == "mysql" {
+		err = mysqlLock(ctx, lockConn, name, timeout)
+	} else {
+		err = postgresLock(ctx, lockConn, name, timeout)
+	}
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if dialect == "mysql" {
+			lockConn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", name)
+		} else {
+			lockConn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", advisoryKey(name))
+		}
+	}()
+
+	return fn()
+}
+
+// databaseLockName scopes name to the database conn is using.
+func databaseLockName(ctx context.Context, conn *sql.Conn, dialect, name string) (string, error) {
+	query := "SELECT DATABASE()"
+	if dialect == "postgres" {
+		query = "SELECT current_schema()"
+	}
+
+	var database sql.NullString
+	if err := conn.QueryRowContext(ctx, query).Scan(&database); err != nil {
+		return "", err
+	}
+
+	return scopedLockName(name, database.String), nil
+}
+
+// scopedLockName joins name and database into a lock name, hashing names
+// too long for GET_LOCK.
+func scopedLockName(name, database string) string {
+	scoped := name + ":" + database
+	if len(scoped) > mysqlLockNameLimit {
+		sum := sha256.Sum256([]byte(scoped))
+		return hex.EncodeToString(sum[:])
+	}
+	return scoped
+}
+
+func mysqlLock(ctx context.Context, conn *sql.Conn, name string, timeout time.Duration) error {
+	var acquired sql.NullInt64
+	seconds := int64(timeout / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", name, seconds).Scan(&acquired); err != nil {
+		return err
+	}
+
+	if !acquired.Valid || acquired.Int64 != 1 {
+		return ErrLockTimeout
+	}
+
+	return nil
+}
+
+func postgresLock(ctx context.Context, conn *sql.Conn, name string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	key := advisoryKey(name)
+
+	for {
+		var acquired bool
+		if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&acquired); err != nil {
+			return err
+		}
+
+		if acquired {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return ErrLockTimeout
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+// advisoryKey maps a lock name to PostgreSQL's integer lock key space.
+func advisoryKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return int64(h.Sum64())
+}
@@ -0,0 +1,68 @@
+package cservice
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crockerio/cservice/cservicetest"
+)
+
+func TestWithMigrationLockWithoutLocking(t *testing.T) {
+	conn := cservicetest.OpenDB(t)
+
+	calls := 0
+	err := WithMigrationLock(context.Background(), conn, "test", time.Second, func() error {
+		calls++
+		return nil
+	})
+	if err != nil || calls != 1 {
+		t.Errorf("got %v after %d calls", err, calls)
+	}
+
+	failure := errors.New("migration failed")
+	err = WithMigrationLock(context.Background(), conn, "test", time.Second, func() error {
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Errorf("got %v, want the error from fn", err)
+	}
+
+	err = WithAdvisoryLock(context.Background(), conn, "test", time.Second, func() error {
+		calls++
+		return nil
+	})
+	if err != nil || calls != 2 {
+		t.Errorf("WithAdvisoryLock: got %v after %d calls", err, calls)
+	}
+}
+
+func TestScopedLockName(t *testing.T) {
+	if got := scopedLockName("cservice_migrations", "orders"); got != "cservice_migrations:orders" {
+		t.Errorf("got %q", got)
+	}
+
+	if scopedLockName("cservice_migrations", "orders") == scopedLockName("cservice_migrations", "billing") {
+		t.Error("databases share a lock name")
+	}
+
+	long := strings.Repeat("a", 60)
+	a, b := scopedLockName("cservice_migrations", long+"1"), scopedLockName("cservice_migrations", long+"2")
+	if len(a) > mysqlLockNameLimit || len(b) > mysqlLockNameLimit {
+		t.Errorf("lock names longer than %d: %q, %q", mysqlLockNameLimit, a, b)
+	}
+	if a == b {
+		t.Error("long database names share a lock name")
+	}
+}
+
+func TestAdvisoryKey(t *testing.T) {
+	if advisoryKey("cservice_migrations:public") != advisoryKey("cservice_migrations:public") {
+		t.Error("advisory key is not stable")
+	}
+	if advisoryKey("cservice_migrations:public") == advisoryKey("cservice_migrations:tenant") {
+		t.Error("schemas share an advisory key")
+	}
+}
@@ -0,0 +1,356 @@
+package cservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migration is a versioned schema change.
+type Migration struct {
+	// Version identifies the migration. Versions are applied in
+	// lexicographical order, so a timestamp prefix such as
+	// "20210701120000_create_users" is recommended.
+	Version string
+
+	// Up applies the migration.
+	Up func(tx *gorm.DB) error
+
+	// Down reverts the migration.
+	Down func(tx *gorm.DB) error
+
+	// NoTransaction runs the migration outside a transaction, for statements
+	// which cannot run inside one.
+	NoTransaction bool
+}
+
+// SchemaMigration records an applied migration.
+type SchemaMigration struct {
+	Version   string `gorm:"primaryKey;size:191"`
+	AppliedAt time.Time
+}
+
+// MigrationStatus describes whether a migration has been applied.
+type MigrationStatus struct {
+	// Version of the migration.
+	Version string
+
+	// Applied reports whether the migration has been applied.
+	Applied bool
+
+	// AppliedAt is when the migration was applied.
+	AppliedAt time.Time
+}
+
+// ErrUnknownMigration is returned when a target version does not match a
+// registered migration.
+var ErrUnknownMigration = errors.New("cservice: unknown migration version")
+
+// Migrator applies and reverts versioned migrations, recording them in the
+// schema_migrations table.
+type Migrator struct {
+	// LockTimeout is how long to wait for another instance to finish
+	// migrating. Defaults to DefaultMigrationLockTimeout.
+	LockTimeout time.Duration
+
+	db         *gorm.DB
+	migrations []Migration
+}
+
+// ErrFreshInProduction is returned by Migrator.Fresh when APP_ENV is
+// production, as it drops every table.
+var ErrFreshInProduction = errors.New("cservice: refusing to run fresh migrations in production")
+
+// NewMigrator creates a Migrator for the given migrations. It returns an
+// error if a version is empty or registered twice.
+func NewMigrator(db *gorm.DB, migrations ...Migration) (*Migrator, error) {
+	sorted := append([]Migration(nil), migrations...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+
+	for i, migration := range sorted {
+		if migration.Version == "" {
+			return nil, errors.New("cservice: migration has no version")
+		}
+		if i > 0 && sorted[i-1].Version == migration.Version {
+			return nil, fmt.Errorf("cservice: migration version %s is registered twice", migration.Version)
+		}
+	}
+
+	return &Migrator{db: db, migrations: sorted}, nil
+}
+
+// Status returns the state of every registered migration in version order.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Version: migration.Version}
+		if at, ok := applied[migration.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = at
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// Up applies pending migrations up to and including target. An empty target
+// applies every pending migration.
+func (m *Migrator) Up(ctx context.Context, target string) error {
+	if err := m.checkTarget(target); err != nil {
+		return err
+	}
+
+	return m.withLock(ctx, func() error {
+		return m.up(ctx, target)
+	})
+}
+
+func (m *Migrator) up(ctx context.Context, target string) error {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range m.migrations {
+		if target != "" && migration.Version > target {
+			break
+		}
+
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		err := m.run(ctx, migration, func(tx *gorm.DB) error {
+			if migration.Up != nil {
+				if err := migration.Up(tx); err != nil {
+					return err
+				}
+			}
+
+			return tx.Create(&SchemaMigration{Version: migration.Version, AppliedAt: tx.NowFunc()}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("cservice: migration %s: %w", migration.Version, err)
+		}
+	}
+
+	return nil
+}
+
+// Down reverts applied migrations newer than target. An empty target reverts
+// only the most recently applied migration.
+func (m *Migrator) Down(ctx context.Context, target string) error {
+	if err := m.checkTarget(target); err != nil {
+		return err
+	}
+
+	return m.withLock(ctx, func() error {
+		return m.down(ctx, target)
+	})
+}
+
+func (m *Migrator) down(ctx context.Context, target string) error {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		migration := m.migrations[i]
+
+		if target != "" && migration.Version <= target {
+			break
+		}
+
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+
+		err := m.run(ctx, migration, func(tx *gorm.DB) error {
+			if migration.Down != nil {
+				if err := migration.Down(tx); err != nil {
+					return err
+				}
+			}
+
+			return tx.Delete(&SchemaMigration{Version: migration.Version}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("cservice: reverting migration %s: %w", migration.Version, err)
+		}
+
+		if target == "" {
+			break
+		}
+	}
+
+	return nil
+}
+
+// Fresh drops every table in the database and applies all migrations. It
+// refuses to run in Production and supports MySQL and PostgreSQL.
+func (m *Migrator) Fresh(ctx context.Context) error {
+	if IsProduction() {
+		return ErrFreshInProduction
+	}
+
+	dialect := m.db.Dialector.Name()
+
+	var listTables string
+	switch dialect {
+	case "mysql":
+		listTables = "SELECT table_name FROM information_schema.tables WHERE table_schema = DATABASE() AND table_type = 'BASE TABLE'"
+	case "postgres":
+		listTables = "SELECT table_name FROM information_schema.tables WHERE table_schema = current_schema() AND table_type = 'BASE TABLE'"
+	default:
+		return fmt.Errorf("cservice: fresh migrations are not supported on %s", dialect)
+	}
+
+	return m.withLock(ctx, func() error {
+		var tables []string
+		if err := m.db.WithContext(ctx).Raw(listTables).Scan(&tables).Error; err != nil {
+			return err
+		}
+
+		// Run on a single connection so MySQL's foreign key checks stay
+		// disabled for every drop. PostgreSQL drops with CASCADE instead.
+		err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if dialect == "mysql" {
+				if err := tx.Exec("SET FOREIGN_KEY_CHECKS = 0").Error; err != nil {
+					return err
+				}
+			}
+
+			for _, table := range tables {
+				if err := tx.Migrator().DropTable(table); err != nil {
+					return err
+				}
+			}
+
+			if dialect == "mysql" {
+				return tx.Exec("SET FOREIGN_KEY_CHECKS = 1").Error
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		return m.up(ctx, "")
+	})
+}
+
+// withLock runs fn holding the migration lock, so concurrently starting
+// instances do not migrate at the same time.
+func (m *Migrator) withLock(ctx context.Context, fn func() error) error {
+	timeout := m.LockTimeout
+	if timeout <= 0 {
+		timeout = DefaultMigrationLockTimeout
+	}
+
+	return WithMigrationLock(ctx, m.db, "cservice_migrations", timeout, fn)
+}
+
+// run calls fc with a transaction, or with the database itself when the
+// migration opts out of transactions.
+func (m *Migrator) run(ctx context.Context, migration Migration, fc func(tx *gorm.DB) error) error {
+	if migration.NoTransaction {
+		return fc(m.db.WithContext(ctx))
+	}
+
+	return m.db.WithContext(ctx).Transaction(fc)
+}
+
+// applied returns the applied migration versions and when they were applied.
+func (m *Migrator) applied(ctx context.Context) (map[string]time.Time, error) {
+	conn := m.db.WithContext(ctx)
+	if err := conn.AutoMigrate(&SchemaMigration{}); err != nil {
+		return nil, err
+	}
+
+	var records []SchemaMigration
+	if err := conn.Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	applied := make(map[string]time.Time, len(records))
+	for _, record := range records {
+		applied[record.Version] = record.AppliedAt
+	}
+
+	return applied, nil
+}
+
+func (m *Migrator) checkTarget(target string) error {
+	if target == "" {
+		return nil
+	}
+
+	for _, migration := range m.migrations {
+		if migration.Version == target {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s", ErrUnknownMigration, target)
+}
+
+// RunMigrateCommand runs a migrate sub-command, as given on the command line
+// after "migrate": up [version], down [version], status or fresh. Output is
+// written to w.
+func RunMigrateCommand(ctx context.Context, m *Migrator, args []string, w io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("cservice: usage: migrate up|down|status|fresh [version]")
+	}
+
+	target := ""
+	if len(args) > 1 {
+		target = args[1]
+	}
+
+	switch args[0] {
+	case "up":
+		if err := m.Up(ctx, target); err != nil {
+			return err
+		}
+	case "down":
+		if err := m.Down(ctx, target); err != nil {
+			return err
+		}
+	case "fresh":
+		if err := m.Fresh(ctx); err != nil {
+			return err
+		}
+	case "status":
+	default:
+		return fmt.Errorf("cservice: unknown migrate command %q", args[0])
+	}
+
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, status := range statuses {
+		if status.Applied {
+			fmt.Fprintf(w, "applied  %s  %s\n", status.AppliedAt.Format(time.RFC3339), status.Version)
+		} else {
+			fmt.Fprintf(w, "pending  %-20s  %s\n", "", status.Version)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,216 @@
+package cservice
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ErrArgsWithMultipleStatements is returned when arguments are bound to a
+// script containing more than one statement.
+var ErrArgsWithMultipleStatements = errors.New("cservice: arguments can only be bound to a single statement")
+
+// ExecOptions control how ExecWith and ExecFileWith run a script.
+type ExecOptions struct {
+	// NoTransaction runs the statements one by one outside a transaction,
+	// for statements which cannot run inside one, such as CREATE INDEX
+	// CONCURRENTLY, or MySQL DDL, which commits implicitly anyway.
+	NoTransaction bool
+}
+
+// Exec runs sql against the migrator's database in a transaction. sql may
+// contain several statements separated by semicolons; args may only be given
+// for a single statement.
+func (m *Migrator) Exec(ctx context.Context, sql string, args ...interface{}) error {
+	return m.ExecWith(ctx, ExecOptions{}, sql, args...)
+}
+
+// ExecWith runs sql like Exec, as controlled by options.
+func (m *Migrator) ExecWith(ctx context.Context, options ExecOptions, sql string, args ...interface{}) error {
+	if options.NoTransaction {
+		return ExecScript(m.db.WithContext(ctx), sql, args...)
+	}
+
+	return m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return ExecScript(tx, sql, args...)
+	})
+}
+
+// ExecFile runs the statements in the SQL file at path in a transaction.
+func (m *Migrator) ExecFile(ctx context.Context, path string) error {
+	return m.ExecFileWith(ctx, ExecOptions{}, path)
+}
+
+// ExecFileWith runs the statements in the SQL file at path, as controlled by
+// options.
+func (m *Migrator) ExecFileWith(ctx context.Context, options ExecOptions, path string) error {
+	script, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	return m.ExecWith(ctx, options, string(script))
+}
+
+// SQLMigration returns a Migration running the up and down scripts. Set
+// NoTransaction on the result for scripts which cannot run in a transaction.
+func SQLMigration(version, up, down string) Migration {
+	return Migration{
+		Version: version,
+		Up: func(tx *gorm.DB) error {
+			return ExecScript(tx, up)
+		},
+		Down: func(tx *gorm.DB) error {
+			return ExecScript(tx, down)
+		},
+	}
+}
+
+// SQLFileMigration returns a Migration running the scripts in the up and down
+// files. An empty path skips that direction.
+func SQLFileMigration(version, upPath, downPath string) Migration {
+	run := func(path string) func(tx *gorm.DB) error {
+		return func(tx *gorm.DB) error {
+			if path == "" {
+				return nil
+			}
+
+			script, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+
+			return ExecScript(tx, string(script))
+		}
+	}
+
+	return Migration{Version: version, Up: run(upPath), Down: run(downPath)}
+}
+
+// ExecScript splits script into statements and runs each on tx.
+func ExecScript(tx *gorm.DB, script string, args ...interface{}) error {
+	statements := SplitStatements(script)
+
+	if len(args) > 0 && len(statements) > 1 {
+		return ErrArgsWithMultipleStatements
+	}
+
+	for _, statement := range statements {
+		if err := tx.Exec(statement, args...).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SplitStatements splits an SQL script into statements. Delimiters inside
+// quotes and comments are ignored, and mysql client style DELIMITER lines are
+// honoured so routines can be defined in files. Comments are dropped, except
+// MySQL's executable /*! ... */ comments and /*+ ... */ optimizer hints,
+// which are kept as part of their statement.
+func SplitStatements(script string) []string {
+	var (
+		statements []string
+		current    strings.Builder
+		delimiter  = ";"
+	)
+
+	flush := func() {
+		if statement := strings.TrimSpace(current.String()); statement != "" {
+			statements = append(statements, statement)
+		}
+		current.Reset()
+	}
+
+	for i := 0; i < len(script); {
+		// DELIMITER is only recognised at the start of a line.
+		if atLineStart(script, i) {
+			line := script[i:]
+			if end := strings.IndexByte(line, '\n'); end >= 0 {
+				line = line[:end]
+			}
+
+			fields := strings.Fields(line)
+			if len(fields) == 2 && strings.EqualFold(fields[0], "DELIMITER") {
+				flush()
+				delimiter = fields[1]
+				i += len(line)
+				continue
+			}
+		}
+
+		c := script[i]
+
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end := i + 1
+			for end < len(script) && script[end] != c {
+				if script[end] == '\\' && c != '`' {
+					end++
+				}
+				end++
+			}
+			if end < len(script) {
+				end++
+			}
+			current.WriteString(script[i:end])
+			i = end
+		case c == '#' || isDashComment(script, i):
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				i = len(script)
+			} else {
+				i += end
+			}
+		case strings.HasPrefix(script[i:], "/*"):
+			end := len(script)
+			if closing := strings.Index(script[i+2:], "*/"); closing >= 0 {
+				end = i + closing + 4
+			}
+
+			if strings.HasPrefix(script[i:], "/*!") || strings.HasPrefix(script[i:], "/*+") {
+				current.WriteString(script[i:end])
+			}
+			i = end
+		case strings.HasPrefix(script[i:], delimiter):
+			flush()
+			i += len(delimiter)
+		default:
+			current.WriteByte(c)
+			i++
+		}
+	}
+
+	flush()
+
+	return statements
+}
+
+// isDashComment reports whether a -- comment starts at i. MySQL requires the
+// dashes to be followed by whitespace or a control character, or to end the
+// script.
+func isDashComment(script string, i int) bool {
+	if !strings.HasPrefix(script[i:], "--") {
+		return false
+	}
+
+	return i+2 == len(script) || script[i+2] <= ' '
+}
+
+func atLineStart(script string, i int) bool {
+	for j := i - 1; j >= 0; j-- {
+		switch script[j] {
+		case ' ', '\t', '\r':
+			continue
+		case '\n':
+			return true
+		default:
+			return false
+		}
+	}
+	return true
+}
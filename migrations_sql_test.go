@@ -0,0 +1,82 @@
+package cservice
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/crockerio/cservice/cservicetest"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{"single", "SELECT 1", []string{"SELECT 1"}},
+		{"several", "SELECT 1; SELECT 2;\n\nSELECT 3;", []string{"SELECT 1", "SELECT 2", "SELECT 3"}},
+		{"empty statements", ";;  ; SELECT 1;;", []string{"SELECT 1"}},
+		{"single quotes", "INSERT INTO t VALUES ('a;b'); SELECT 2", []string{"INSERT INTO t VALUES ('a;b')", "SELECT 2"}},
+		{"escaped quote", `INSERT INTO t VALUES ('it\'s;'); SELECT 2`, []string{`INSERT INTO t VALUES ('it\'s;')`, "SELECT 2"}},
+		{"doubled quote", "INSERT INTO t VALUES ('it''s;'); SELECT 2", []string{"INSERT INTO t VALUES ('it''s;')", "SELECT 2"}},
+		{"double quotes", `SELECT "a;b"; SELECT 2`, []string{`SELECT "a;b"`, "SELECT 2"}},
+		{"backticks", "SELECT `a;b` FROM t; SELECT 2", []string{"SELECT `a;b` FROM t", "SELECT 2"}},
+		{"hash comment", "SELECT 1; # comment; with semicolon\nSELECT 2", []string{"SELECT 1", "SELECT 2"}},
+		{"dash comment with space", "SELECT 1; -- comment;\nSELECT 2", []string{"SELECT 1", "SELECT 2"}},
+		{"dash comment with tab", "SELECT 1; --\tcomment;\nSELECT 2", []string{"SELECT 1", "SELECT 2"}},
+		{"dash comment at end of line", "SELECT 1; --\nSELECT 2", []string{"SELECT 1", "SELECT 2"}},
+		{"dash comment at end of script", "SELECT 1; --", []string{"SELECT 1"}},
+		{"double minus", "SELECT 5--1; SELECT 2", []string{"SELECT 5--1", "SELECT 2"}},
+		{"block comment", "SELECT /* a; b */ 1; SELECT 2", []string{"SELECT  1", "SELECT 2"}},
+		{"unterminated block comment", "SELECT 1; /* never closed; SELECT 2", []string{"SELECT 1"}},
+		{
+			"executable comment",
+			"/*!40101 SET @OLD_CHARACTER_SET_CLIENT=@@CHARACTER_SET_CLIENT */;\n/*!40014 SET FOREIGN_KEY_CHECKS=0 */;",
+			[]string{"/*!40101 SET @OLD_CHARACTER_SET_CLIENT=@@CHARACTER_SET_CLIENT */", "/*!40014 SET FOREIGN_KEY_CHECKS=0 */"},
+		},
+		{"optimizer hint", "SELECT /*+ MAX_EXECUTION_TIME(1000) */ * FROM t", []string{"SELECT /*+ MAX_EXECUTION_TIME(1000) */ * FROM t"}},
+		{
+			"delimiter",
+			"DELIMITER //\nCREATE PROCEDURE p() BEGIN SELECT 1; SELECT 2; END //\nDELIMITER ;\nSELECT 3;",
+			[]string{"CREATE PROCEDURE p() BEGIN SELECT 1; SELECT 2; END", "SELECT 3"},
+		},
+		{"delimiter word mid-line", "SELECT 'DELIMITER //'; SELECT 2", []string{"SELECT 'DELIMITER //'", "SELECT 2"}},
+	}
+
+	for _, test := range tests {
+		if got := SplitStatements(test.script); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestMigratorExec(t *testing.T) {
+	conn := cservicetest.OpenDB(t)
+	m, err := NewMigrator(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if err := m.Exec(ctx, "CREATE TABLE notes (body TEXT); INSERT INTO notes VALUES ('a;b')"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Exec(ctx, "INSERT INTO notes VALUES (?)", "bound"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Exec(ctx, "SELECT 1; SELECT ?", 2); !errors.Is(err, ErrArgsWithMultipleStatements) {
+		t.Errorf("args with several statements: got %v", err)
+	}
+
+	// A failing script is rolled back in a transaction, but not without one.
+	m.Exec(ctx, "INSERT INTO notes VALUES ('rolled back'); INSERT INTO missing VALUES (1)")
+	m.ExecWith(ctx, ExecOptions{NoTransaction: true}, "INSERT INTO notes VALUES ('kept'); INSERT INTO missing VALUES (1)")
+
+	var bodies []string
+	conn.Raw("SELECT body FROM notes ORDER BY rowid").Scan(&bodies)
+	if want := []string{"a;b", "bound", "kept"}; !reflect.DeepEqual(bodies, want) {
+		t.Errorf("got %q, want %q", bodies, want)
+	}
+}
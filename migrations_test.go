@@ -0,0 +1,85 @@
+package cservice
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crockerio/cservice/cservicetest"
+	"gorm.io/gorm"
+)
+
+func TestMigratorUpDown(t *testing.T) {
+	conn := cservicetest.OpenDB(t)
+	m, err := NewMigrator(conn,
+		SQLMigration("002_create_parts", "CREATE TABLE parts (widget_id INTEGER REFERENCES widgets (id))", "DROP TABLE parts"),
+		Migration{
+			Version: "001_create_widgets",
+			Up:      func(tx *gorm.DB) error { return tx.Exec("CREATE TABLE widgets (id INTEGER PRIMARY KEY)").Error },
+			Down:    func(tx *gorm.DB) error { return tx.Exec("DROP TABLE widgets").Error },
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.LockTimeout = time.Second
+
+	ctx := context.Background()
+	if err := m.Up(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+	if !conn.Migrator().HasTable("parts") {
+		t.Fatal("migrations were not applied")
+	}
+
+	if err := m.Down(ctx, "001_create_widgets"); err != nil {
+		t.Fatal(err)
+	}
+
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !statuses[0].Applied || statuses[1].Applied || conn.Migrator().HasTable("parts") {
+		t.Errorf("got %+v", statuses)
+	}
+}
+
+func TestNewMigratorRejectsDuplicateVersions(t *testing.T) {
+	conn := cservicetest.OpenDB(t)
+
+	if _, err := NewMigrator(conn, Migration{Version: "001"}, Migration{Version: "002"}, Migration{Version: "001"}); err == nil {
+		t.Error("duplicate versions were accepted")
+	}
+	if _, err := NewMigrator(conn, Migration{}); err == nil {
+		t.Error("an empty version was accepted")
+	}
+}
+
+func TestMigratorFreshGuards(t *testing.T) {
+	conn := cservicetest.OpenDB(t)
+	if err := conn.Exec("CREATE TABLE keep (id INTEGER)").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewMigrator(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("APP_ENV", "production")
+	if err := m.Fresh(context.Background()); !errors.Is(err, ErrFreshInProduction) {
+		t.Errorf("production: got %v, want ErrFreshInProduction", err)
+	}
+
+	t.Setenv("APP_ENV", "dev")
+	if err := m.Fresh(context.Background()); err == nil || !strings.Contains(err.Error(), "sqlite") {
+		t.Errorf("sqlite: got %v, want an unsupported dialect error", err)
+	}
+
+	if !conn.Migrator().HasTable("keep") {
+		t.Error("Fresh dropped tables despite failing")
+	}
+}
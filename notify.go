@@ -0,0 +1,416 @@
+package cservice
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrNotifierNotInitialised is returned by Notify before InitNotifier.
+var ErrNotifierNotInitialised = errors.New("cservice: notifier not initialised")
+
+// notifyHTTPClient sends webhook and mail API requests when no client is
+// configured. Unlike http.DefaultClient, it gives up on unresponsive servers.
+var notifyHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// Notifiable is the recipient of notifications, usually a user model.
+type Notifiable interface {
+	// NotificationID identifies the recipient for stored preferences.
+	NotificationID() string
+}
+
+// Notification is a message delivered through one or more channels.
+type Notification interface {
+	// NotificationType names the kind of notification, e.g.
+	// "password_reset", for routing and preferences.
+	NotificationType() string
+
+	// Channels lists the channels the notification is sent on by default.
+	Channels() []string
+}
+
+// NotificationChannel delivers notifications by one medium.
+type NotificationChannel interface {
+	// Name identifies the channel, e.g. "mail".
+	Name() string
+
+	// Deliver sends notification to recipient.
+	Deliver(ctx context.Context, recipient Notifiable, notification Notification) error
+}
+
+// NotificationPreference stores whether a recipient receives a type of
+// notification on a channel. Add it to DatabaseConfig.Models to create its
+// table. Without a stored preference, notifications are delivered.
+type NotificationPreference struct {
+	RecipientID      string `gorm:"primaryKey;size:191"`
+	NotificationType string `gorm:"primaryKey;size:191"`
+	Channel          string `gorm:"primaryKey;size:64"`
+	Enabled          bool
+}
+
+// NotifyError reports the channels a notification failed on.
+type NotifyError struct {
+	// Errors maps channel names to delivery errors.
+	Errors map[string]error
+}
+
+// Error describes the failed channels.
+func (e *NotifyError) Error() string {
+	channels := make([]string, 0, len(e.Errors))
+	for channel := range e.Errors {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+
+	parts := make([]string, 0, len(channels))
+	for _, channel := range channels {
+		parts = append(parts, channel+": "+e.Errors[channel].Error())
+	}
+
+	return "cservice: notification failed on " + strings.Join(parts, "; ")
+}
+
+// Notifier routes notifications to channels, honouring stored preferences.
+type Notifier struct {
+	db       *gorm.DB
+	channels map[string]NotificationChannel
+
+	mu     sync.RWMutex
+	routes map[string][]string
+}
+
+// NewNotifier creates a Notifier delivering through channels. Preferences are
+// read from db, which may be nil to always deliver.
+func NewNotifier(db *gorm.DB, channels ...NotificationChannel) *Notifier {
+	n := &Notifier{
+		db:       db,
+		channels: map[string]NotificationChannel{},
+		routes:   map[string][]string{},
+	}
+
+	for _, channel := range channels {
+		n.channels[channel.Name()] = channel
+	}
+
+	return n
+}
+
+// Route overrides the channels a type of notification is sent on.
+func (n *Notifier) Route(notificationType string, channels ...string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.routes[notificationType] = channels
+}
+
+// Notify delivers notification to recipient on each routed channel the
+// recipient has not opted out of. Every channel is attempted; failures are
+// returned as a *NotifyError.
+func (n *Notifier) Notify(ctx context.Context, recipient Notifiable, notification Notification) error {
+	n.mu.RLock()
+	channels, ok := n.routes[notification.NotificationType()]
+	n.mu.RUnlock()
+	if !ok {
+		channels = notification.Channels()
+	}
+
+	disabled, err := n.disabledChannels(ctx, recipient, notification)
+	if err != nil {
+		return err
+	}
+
+	failures := map[string]error{}
+	for _, name := range channels {
+		if disabled[name] {
+			continue
+		}
+
+		channel, ok := n.channels[name]
+		if !ok {
+			failures[name] = fmt.Errorf("unknown channel")
+			continue
+		}
+
+		if err := channel.Deliver(ctx, recipient, notification); err != nil {
+			failures[name] = err
+		}
+	}
+
+	if len(failures) > 0 {
+		return &NotifyError{Errors: failures}
+	}
+
+	return nil
+}
+
+// SetPreference stores whether recipientID receives notificationType on
+// channel.
+func (n *Notifier) SetPreference(ctx context.Context, recipientID, notificationType, channel string, enabled bool) error {
+	if n.db == nil {
+		return ErrDatabaseNotInitialised
+	}
+
+	preference := NotificationPreference{
+		RecipientID:      recipientID,
+		NotificationType: notificationType,
+		Channel:          channel,
+		Enabled:          enabled,
+	}
+
+	return n.db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(&preference).Error
+}
+
+func (n *Notifier) disabledChannels(ctx context.Context, recipient Notifiable, notification Notification) (map[string]bool, error) {
+	disabled := map[string]bool{}
+	if n.db == nil {
+		return disabled, nil
+	}
+
+	var preferences []NotificationPreference
+	err := n.db.WithContext(ctx).
+		Where("recipient_id = ? AND notification_type = ?", recipient.NotificationID(), notification.NotificationType()).
+		Find(&preferences).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, preference := range preferences {
+		if !preference.Enabled {
+			disabled[preference.Channel] = true
+		}
+	}
+
+	return disabled, nil
+}
+
+var notifier *Notifier
+
+// InitNotifier sets the Notifier used by Notify.
+func InitNotifier(n *Notifier) {
+	notifier = n
+}
+
+// Notify delivers notification to recipient with the Notifier set by
+// InitNotifier.
+func Notify(ctx context.Context, recipient Notifiable, notification Notification) error {
+	if notifier == nil {
+		return ErrNotifierNotInitialised
+	}
+	return notifier.Notify(ctx, recipient, notification)
+}
+
+// MailRecipient is a Notifiable with an email address.
+type MailRecipient interface {
+	EmailAddress() string
+}
+
+// MailNotification is a Notification which can be sent as email.
+type MailNotification interface {
+	ToMail(recipient Notifiable) (*Message, error)
+}
+
+// MailChannel delivers MailNotifications to MailRecipients with a Mailer.
+type MailChannel struct {
+	Mailer *Mailer
+}
+
+// Name returns "mail".
+func (MailChannel) Name() string {
+	return "mail"
+}
+
+// Deliver sends notification as email.
+func (c MailChannel) Deliver(ctx context.Context, recipient Notifiable, notification Notification) error {
+	mailNotification, ok := notification.(MailNotification)
+	if !ok {
+		return fmt.Errorf("%T cannot be sent as mail", notification)
+	}
+
+	message, err := mailNotification.ToMail(recipient)
+	if err != nil {
+		return err
+	}
+
+	if len(message.To) == 0 {
+		mailRecipient, ok := recipient.(MailRecipient)
+		if !ok {
+			return fmt.Errorf("%T has no email address", recipient)
+		}
+		message.To = []string{mailRecipient.EmailAddress()}
+	}
+
+	return c.Mailer.Send(ctx, message)
+}
+
+// SMSRecipient is a Notifiable with a phone number.
+type SMSRecipient interface {
+	PhoneNumber() string
+}
+
+// SMSNotification is a Notification which can be sent as a text message.
+type SMSNotification interface {
+	ToSMS(recipient Notifiable) (string, error)
+}
+
+// SMSChannel delivers SMSNotifications to SMSRecipients through a provider.
+type SMSChannel struct {
+	// Send delivers text to the phone number.
+	Send func(ctx context.Context, phoneNumber, text string) error
+}
+
+// Name returns "sms".
+func (SMSChannel) Name() string {
+	return "sms"
+}
+
+// Deliver sends notification as a text message.
+func (c SMSChannel) Deliver(ctx context.Context, recipient Notifiable, notification Notification) error {
+	smsNotification, ok := notification.(SMSNotification)
+	if !ok {
+		return fmt.Errorf("%T cannot be sent as SMS", notification)
+	}
+
+	smsRecipient, ok := recipient.(SMSRecipient)
+	if !ok {
+		return fmt.Errorf("%T has no phone number", recipient)
+	}
+
+	text, err := smsNotification.ToSMS(recipient)
+	if err != nil {
+		return err
+	}
+
+	return c.Send(ctx, smsRecipient.PhoneNumber(), text)
+}
+
+// PushMessage is a push notification payload.
+type PushMessage struct {
+	Title string
+	Body  string
+	Data  map[string]string
+}
+
+// PushRecipient is a Notifiable with registered device tokens.
+type PushRecipient interface {
+	PushTokens() []string
+}
+
+// PushNotification is a Notification which can be sent as a push
+// notification.
+type PushNotification interface {
+	ToPush(recipient Notifiable) (*PushMessage, error)
+}
+
+// PushChannel delivers PushNotifications to PushRecipients through a
+// provider.
+type PushChannel struct {
+	// Send delivers message to the device tokens.
+	Send func(ctx context.Context, tokens []string, message *PushMessage) error
+}
+
+// Name returns "push".
+func (PushChannel) Name() string {
+	return "push"
+}
+
+// Deliver sends notification to the recipient's devices.
+func (c PushChannel) Deliver(ctx context.Context, recipient Notifiable, notification Notification) error {
+	pushNotification, ok := notification.(PushNotification)
+	if !ok {
+		return fmt.Errorf("%T cannot be sent as a push notification", notification)
+	}
+
+	pushRecipient, ok := recipient.(PushRecipient)
+	if !ok {
+		return fmt.Errorf("%T has no push tokens", recipient)
+	}
+
+	tokens := pushRecipient.PushTokens()
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	message, err := pushNotification.ToPush(recipient)
+	if err != nil {
+		return err
+	}
+
+	return c.Send(ctx, tokens, message)
+}
+
+// WebhookNotification is a Notification which can be posted to a webhook.
+type WebhookNotification interface {
+	// ToWebhook returns the payload, which is encoded as JSON.
+	ToWebhook(recipient Notifiable) (interface{}, error)
+}
+
+// WebhookChannel posts WebhookNotifications as JSON.
+type WebhookChannel struct {
+	// URL returns the webhook URL of recipient.
+	URL func(recipient Notifiable) (string, error)
+
+	// Client sends the requests. Defaults to a client with a 30 second
+	// timeout.
+	Client *http.Client
+}
+
+// Name returns "webhook".
+func (WebhookChannel) Name() string {
+	return "webhook"
+}
+
+// Deliver posts notification to the recipient's webhook.
+func (c WebhookChannel) Deliver(ctx context.Context, recipient Notifiable, notification Notification) error {
+	webhookNotification, ok := notification.(WebhookNotification)
+	if !ok {
+		return fmt.Errorf("%T cannot be sent to a webhook", notification)
+	}
+
+	url, err := c.URL(recipient)
+	if err != nil {
+		return err
+	}
+
+	payload, err := webhookNotification.ToWebhook(recipient)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := c.Client
+	if client == nil {
+		client = notifyHTTPClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+
+	return nil
+}
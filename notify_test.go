@@ -0,0 +1,216 @@
+package cservice
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/crockerio/cservice/cservicetest"
+)
+
+type testRecipient struct {
+	id    string
+	email string
+}
+
+func (r testRecipient) NotificationID() string { return r.id }
+func (r testRecipient) EmailAddress() string   { return r.email }
+
+type welcomeNotification struct{}
+
+func (welcomeNotification) NotificationType() string { return "welcome" }
+func (welcomeNotification) Channels() []string       { return []string{"mail", "webhook"} }
+
+func (welcomeNotification) ToMail(recipient Notifiable) (*Message, error) {
+	return &Message{Subject: "Welcome", Text: "Hello"}, nil
+}
+
+func (welcomeNotification) ToWebhook(recipient Notifiable) (interface{}, error) {
+	return map[string]string{"type": "welcome", "recipient": recipient.NotificationID()}, nil
+}
+
+// recordingChannel records the recipients it delivers to and fails with err.
+type recordingChannel struct {
+	name string
+	err  error
+
+	mu        sync.Mutex
+	delivered []string
+}
+
+func (c *recordingChannel) Name() string { return c.name }
+
+func (c *recordingChannel) Deliver(ctx context.Context, recipient Notifiable, notification Notification) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.delivered = append(c.delivered, recipient.NotificationID())
+	return c.err
+}
+
+func (c *recordingChannel) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.delivered)
+}
+
+func TestNotifierRouting(t *testing.T) {
+	ctx := context.Background()
+	mail := &recordingChannel{name: "mail"}
+	webhook := &recordingChannel{name: "webhook"}
+	sms := &recordingChannel{name: "sms"}
+	n := NewNotifier(nil, mail, webhook, sms)
+
+	if err := n.Notify(ctx, testRecipient{id: "1"}, welcomeNotification{}); err != nil {
+		t.Fatal(err)
+	}
+	if mail.count() != 1 || webhook.count() != 1 || sms.count() != 0 {
+		t.Errorf("default channels: mail %d, webhook %d, sms %d", mail.count(), webhook.count(), sms.count())
+	}
+
+	n.Route("welcome", "sms")
+	if err := n.Notify(ctx, testRecipient{id: "1"}, welcomeNotification{}); err != nil {
+		t.Fatal(err)
+	}
+	if mail.count() != 1 || webhook.count() != 1 || sms.count() != 1 {
+		t.Errorf("routed channels: mail %d, webhook %d, sms %d", mail.count(), webhook.count(), sms.count())
+	}
+}
+
+func TestNotifierReportsFailures(t *testing.T) {
+	mail := &recordingChannel{name: "mail", err: errors.New("smtp down")}
+	sms := &recordingChannel{name: "sms"}
+	n := NewNotifier(nil, mail, sms)
+	n.Route("welcome", "mail", "push", "sms")
+
+	err := n.Notify(context.Background(), testRecipient{id: "1"}, welcomeNotification{})
+
+	var notifyErr *NotifyError
+	if !errors.As(err, &notifyErr) {
+		t.Fatalf("got %v, want *NotifyError", err)
+	}
+	if len(notifyErr.Errors) != 2 || notifyErr.Errors["mail"] == nil || notifyErr.Errors["push"] == nil {
+		t.Errorf("got failures %v", notifyErr.Errors)
+	}
+	if want := "cservice: notification failed on mail: smtp down; push: unknown channel"; err.Error() != want {
+		t.Errorf("got %q, want %q", err, want)
+	}
+	if sms.count() != 1 {
+		t.Error("channels after a failure were not attempted")
+	}
+}
+
+func TestNotifierPreferences(t *testing.T) {
+	ctx := context.Background()
+	conn := cservicetest.OpenDB(t, &NotificationPreference{})
+	mail := &recordingChannel{name: "mail"}
+	webhook := &recordingChannel{name: "webhook"}
+	n := NewNotifier(conn, mail, webhook)
+
+	if err := n.SetPreference(ctx, "1", "welcome", "mail", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Notify(ctx, testRecipient{id: "1"}, welcomeNotification{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Notify(ctx, testRecipient{id: "2"}, welcomeNotification{}); err != nil {
+		t.Fatal(err)
+	}
+	if mail.count() != 1 || webhook.count() != 2 {
+		t.Errorf("opted out: mail %d, webhook %d", mail.count(), webhook.count())
+	}
+
+	if err := n.SetPreference(ctx, "1", "welcome", "mail", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Notify(ctx, testRecipient{id: "1"}, welcomeNotification{}); err != nil {
+		t.Fatal(err)
+	}
+	if mail.count() != 2 {
+		t.Errorf("opted back in: mail %d", mail.count())
+	}
+}
+
+func TestNotifierChannels(t *testing.T) {
+	var mu sync.Mutex
+	var payloads []map[string]string
+	fail := false
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if fail {
+			rw.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		var payload map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || r.Header.Get("Content-Type") != "application/json" {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		payloads = append(payloads, payload)
+	}))
+	defer server.Close()
+
+	transport := &CaptureTransport{}
+	mailer := NewMailer(MailerConfig{Transport: transport, From: "app@example.com"})
+	defer mailer.Close()
+
+	n := NewNotifier(nil,
+		MailChannel{Mailer: mailer},
+		WebhookChannel{URL: func(recipient Notifiable) (string, error) {
+			return server.URL + "/hooks/" + recipient.NotificationID(), nil
+		}},
+	)
+
+	recipient := testRecipient{id: "1", email: "user@example.com"}
+	if err := n.Notify(context.Background(), recipient, welcomeNotification{}); err != nil {
+		t.Fatal(err)
+	}
+
+	messages := transport.Messages()
+	if len(messages) != 1 || len(messages[0].To) != 1 || messages[0].To[0] != "user@example.com" {
+		t.Errorf("got messages %+v", messages)
+	}
+	if len(payloads) != 1 || payloads[0]["recipient"] != "1" {
+		t.Errorf("got payloads %v", payloads)
+	}
+
+	mu.Lock()
+	fail = true
+	mu.Unlock()
+
+	err := n.Notify(context.Background(), recipient, welcomeNotification{})
+	var notifyErr *NotifyError
+	if !errors.As(err, &notifyErr) || len(notifyErr.Errors) != 1 || !strings.Contains(notifyErr.Errors["webhook"].Error(), "502") {
+		t.Errorf("failing webhook: got %v", err)
+	}
+	if len(transport.Messages()) != 2 {
+		t.Error("mail was not sent alongside the failing webhook")
+	}
+}
+
+func TestNotifierConcurrentRoute(t *testing.T) {
+	n := NewNotifier(nil, &recordingChannel{name: "mail"}, &recordingChannel{name: "webhook"})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			n.Route("welcome", "mail")
+		}()
+		go func() {
+			defer wg.Done()
+			n.Notify(context.Background(), testRecipient{id: "1"}, welcomeNotification{})
+		}()
+	}
+	wg.Wait()
+}
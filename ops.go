@@ -0,0 +1,198 @@
+package cservice
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm/logger"
+)
+
+// ErrTaskRunning is returned when a task is started while it is already
+// running.
+var ErrTaskRunning = errors.New("cservice: task is already running")
+
+// ErrUnknownTask is returned for tasks which have not been registered.
+var ErrUnknownTask = errors.New("cservice: unknown task")
+
+// OpsTask is an administrative task, such as rebuilding a search index.
+type OpsTask struct {
+	Name        string
+	Description string
+
+	// Run performs the task, writing progress to w.
+	Run func(ctx context.Context, args []string, w io.Writer) error
+}
+
+// TaskRunnerConfig defines who may run tasks and where runs are recorded.
+type TaskRunnerConfig struct {
+	// Authorize returns the actor making an HTTP request, and false if they
+	// may not run tasks. Handler rejects every request without it.
+	Authorize func(r *http.Request) (actor string, ok bool)
+
+	// AuditWriter receives a line for every run. Defaults to stdout.
+	AuditWriter logger.Writer
+}
+
+// TaskRunner runs registered tasks from the command line or over HTTP,
+// auditing every run and never running the same task twice at once in this
+// process. Tasks which must not overlap across instances should also take a
+// lock, e.g. with WithAdvisoryLock.
+type TaskRunner struct {
+	config TaskRunnerConfig
+
+	mu      sync.Mutex
+	tasks   map[string]OpsTask
+	running map[string]bool
+}
+
+// NewTaskRunner creates a TaskRunner from config.
+func NewTaskRunner(config TaskRunnerConfig) *TaskRunner {
+	if config.AuditWriter == nil {
+		config.AuditWriter = log.New(os.Stdout, "", log.LstdFlags)
+	}
+
+	return &TaskRunner{config: config, tasks: map[string]OpsTask{}, running: map[string]bool{}}
+}
+
+// Register adds task to the runner, replacing any task with the same name.
+func (t *TaskRunner) Register(task OpsTask) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.tasks[task.Name] = task
+}
+
+// Tasks returns the registered tasks sorted by name.
+func (t *TaskRunner) Tasks() []OpsTask {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tasks := make([]OpsTask, 0, len(t.tasks))
+	for _, task := range t.tasks {
+		tasks = append(tasks, task)
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].Name < tasks[j].Name })
+
+	return tasks
+}
+
+// Run runs the named task on behalf of the actor stored in ctx by WithActor,
+// writing its output to w.
+func (t *TaskRunner) Run(ctx context.Context, name string, args []string, w io.Writer) error {
+	t.mu.Lock()
+	task, ok := t.tasks[name]
+	if !ok {
+		t.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrUnknownTask, name)
+	}
+	if t.running[name] {
+		t.mu.Unlock()
+		return ErrTaskRunning
+	}
+	t.running[name] = true
+	t.mu.Unlock()
+
+	defer func() {
+		t.mu.Lock()
+		delete(t.running, name)
+		t.mu.Unlock()
+	}()
+
+	actor := Actor(ctx)
+	t.config.AuditWriter.Printf("[ops] %s started %s %q", actor, name, args)
+
+	start := time.Now()
+	err := task.Run(ctx, args, w)
+
+	t.config.AuditWriter.Printf("[ops] %s finished %s in %s err=%v", actor, name, time.Since(start), err)
+
+	return err
+}
+
+// Handler serves the task list as JSON on GET / and runs the task named by
+// the path on POST, e.g. POST /reindex?arg=users. The task's output is
+// returned as text once it finishes. Every request is checked with
+// TaskRunnerConfig.Authorize and the actor is recorded in the audit log.
+func (t *TaskRunner) Handler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		actor, ok := "", false
+		if t.config.Authorize != nil {
+			actor, ok = t.config.Authorize(r)
+		}
+		if !ok {
+			http.Error(rw, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		name := strings.Trim(r.URL.Path, "/")
+
+		switch {
+		case r.Method == http.MethodGet && name == "":
+			type taskInfo struct {
+				Name        string `json:"name"`
+				Description string `json:"description"`
+			}
+
+			var infos []taskInfo
+			for _, task := range t.Tasks() {
+				infos = append(infos, taskInfo{Name: task.Name, Description: task.Description})
+			}
+
+			rw.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(rw).Encode(infos)
+		case r.Method == http.MethodPost && name != "":
+			var output bytes.Buffer
+			err := t.Run(WithActor(r.Context(), actor), name, r.URL.Query()["arg"], &output)
+
+			status := http.StatusOK
+			switch {
+			case errors.Is(err, ErrUnknownTask):
+				status = http.StatusNotFound
+			case errors.Is(err, ErrTaskRunning):
+				status = http.StatusConflict
+			case err != nil:
+				status = http.StatusInternalServerError
+				fmt.Fprintf(&output, "\nerror: %v\n", err)
+			}
+
+			rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			rw.WriteHeader(status)
+			if status == http.StatusOK || status == http.StatusInternalServerError {
+				output.WriteTo(rw)
+			} else {
+				fmt.Fprintln(rw, err)
+			}
+		default:
+			http.Error(rw, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// RunTaskCommand runs a task sub-command, as given on the command line after
+// "task": list, or the name of a task followed by its arguments. The actor
+// recorded in the audit log is taken from ctx. Output is written to w.
+func RunTaskCommand(ctx context.Context, t *TaskRunner, args []string, w io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("cservice: usage: task list|<name> [args...]")
+	}
+
+	if args[0] == "list" {
+		for _, task := range t.Tasks() {
+			fmt.Fprintf(w, "%-20s  %s\n", task.Name, task.Description)
+		}
+		return nil
+	}
+
+	return t.Run(ctx, args[0], args[1:], w)
+}
@@ -0,0 +1,188 @@
+package cservice
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestTaskRunner(audit *bufferWriter) *TaskRunner {
+	runner := NewTaskRunner(TaskRunnerConfig{
+		AuditWriter: audit,
+		Authorize: func(r *http.Request) (string, bool) {
+			actor := r.Header.Get("X-Actor")
+			return actor, actor == "alice"
+		},
+	})
+
+	runner.Register(OpsTask{
+		Name:        "reindex",
+		Description: "Rebuild the search index",
+		Run: func(ctx context.Context, args []string, w io.Writer) error {
+			fmt.Fprintf(w, "reindexed %s", strings.Join(args, ","))
+			return nil
+		},
+	})
+	runner.Register(OpsTask{
+		Name:        "broken",
+		Description: "Always fails",
+		Run: func(ctx context.Context, args []string, w io.Writer) error {
+			fmt.Fprint(w, "partial output")
+			return errors.New("disk full")
+		},
+	})
+
+	return runner
+}
+
+func TestTaskRunnerHandler(t *testing.T) {
+	var audit bufferWriter
+	handler := newTestTaskRunner(&audit).Handler()
+
+	serve := func(method, target, actor string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		if actor != "" {
+			req.Header.Set("X-Actor", actor)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		actor  string
+		code   int
+		body   string
+	}{
+		{"anonymous", http.MethodGet, "/", "", http.StatusForbidden, ""},
+		{"unauthorised run", http.MethodPost, "/reindex", "mallory", http.StatusForbidden, ""},
+		{"list", http.MethodGet, "/", "alice", http.StatusOK, `{"name":"broken","description":"Always fails"}`},
+		{"run", http.MethodPost, "/reindex?arg=users&arg=orders", "alice", http.StatusOK, "reindexed users,orders"},
+		{"failing task", http.MethodPost, "/broken", "alice", http.StatusInternalServerError, "partial output\nerror: disk full"},
+		{"unknown task", http.MethodPost, "/missing", "alice", http.StatusNotFound, "unknown task: missing"},
+		{"GET a task", http.MethodGet, "/reindex", "alice", http.StatusMethodNotAllowed, ""},
+		{"POST the list", http.MethodPost, "/", "alice", http.StatusMethodNotAllowed, ""},
+	}
+
+	for _, tt := range tests {
+		rec := serve(tt.method, tt.target, tt.actor)
+		if rec.Code != tt.code || !strings.Contains(rec.Body.String(), tt.body) {
+			t.Errorf("%s: got %d %q, want %d containing %q", tt.name, rec.Code, rec.Body, tt.code, tt.body)
+		}
+	}
+
+	log := audit.String()
+	for _, want := range []string{
+		`[ops] alice started reindex ["users" "orders"]`,
+		"[ops] alice finished reindex in ",
+		"[ops] alice finished broken in ",
+		"err=disk full",
+	} {
+		if !strings.Contains(log, want) {
+			t.Errorf("audit log does not contain %q:\n%s", want, log)
+		}
+	}
+	if strings.Contains(log, "mallory") {
+		t.Errorf("unauthorised request reached the audit log:\n%s", log)
+	}
+}
+
+func TestTaskRunnerHandlerWithoutAuthorize(t *testing.T) {
+	runner := NewTaskRunner(TaskRunnerConfig{AuditWriter: &bufferWriter{}})
+	runner.Register(OpsTask{Name: "reindex", Run: func(ctx context.Context, args []string, w io.Writer) error { return nil }})
+
+	rec := httptest.NewRecorder()
+	runner.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/reindex", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("got %d, want every request rejected", rec.Code)
+	}
+}
+
+func TestTaskRunnerRejectsOverlappingRuns(t *testing.T) {
+	runner := NewTaskRunner(TaskRunnerConfig{
+		AuditWriter: &bufferWriter{},
+		Authorize:   func(r *http.Request) (string, bool) { return "alice", true },
+	})
+
+	started, release := make(chan struct{}, 2), make(chan struct{})
+	runner.Register(OpsTask{Name: "slow", Run: func(ctx context.Context, args []string, w io.Writer) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	}})
+
+	done := make(chan error)
+	go func() { done <- runner.Run(context.Background(), "slow", nil, io.Discard) }()
+	<-started
+
+	rec := httptest.NewRecorder()
+	runner.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/slow", nil))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("overlapping run: got %d", rec.Code)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runner.Run(context.Background(), "slow", nil, io.Discard); err != nil {
+		t.Errorf("run after the first finished: %v", err)
+	}
+}
+
+func TestRunTaskCommand(t *testing.T) {
+	var audit bufferWriter
+	runner := newTestTaskRunner(&audit)
+	ctx := WithActor(context.Background(), "deploy")
+
+	var out bytes.Buffer
+	if err := RunTaskCommand(ctx, runner, []string{"list"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 2 || !strings.HasPrefix(lines[0], "broken") {
+		t.Errorf("list: got %q", out.String())
+	}
+
+	out.Reset()
+	if err := RunTaskCommand(ctx, runner, []string{"reindex", "users"}, &out); err != nil || out.String() != "reindexed users" {
+		t.Errorf("run: got %q, %v", out.String(), err)
+	}
+	if !strings.Contains(audit.String(), "[ops] deploy started reindex") {
+		t.Errorf("audit log: %s", audit.String())
+	}
+
+	if err := RunTaskCommand(ctx, runner, nil, &out); err == nil {
+		t.Error("no arguments: no error")
+	}
+	if err := RunTaskCommand(ctx, runner, []string{"missing"}, &out); !errors.Is(err, ErrUnknownTask) {
+		t.Errorf("unknown task: got %v", err)
+	}
+}
+
+func TestTaskRunnerList(t *testing.T) {
+	runner := newTestTaskRunner(&bufferWriter{})
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Actor", "alice")
+	runner.Handler().ServeHTTP(rec, req)
+
+	var tasks []struct{ Name, Description string }
+	if err := json.NewDecoder(rec.Body).Decode(&tasks); err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 2 || tasks[0].Name != "broken" || tasks[1].Name != "reindex" || tasks[1].Description != "Rebuild the search index" {
+		t.Errorf("got %+v", tasks)
+	}
+}
@@ -1,10 +1,17 @@
 package cservice
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
+	"net/url"
+	"strings"
+	"time"
 
+	mysqldriver "github.com/go-sql-driver/mysql"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 )
 
 // DatabaseConfig defines the settings required to initialise a MySQL database
@@ -25,38 +32,301 @@ type DatabaseConfig struct {
 	// Database to use.
 	Database string
 
+	// DSNParams are extra driver parameters appended to the DSN, e.g.
+	// {"charset": "utf8mb4"}. They override the defaults of charset=utf8,
+	// parseTime=True and loc.
+	DSNParams map[string]string
+
+	// DSN is a complete data source name. When set, the connection fields
+	// above are ignored, but TLS settings and Location are merged into it.
+	// A DSN setting tls or loc to a different value is an error.
+	DSN string
+
+	// TLS connects over TLS, verifying the server against the system root
+	// CAs.
+	TLS bool
+
+	// TLSCAFile is a PEM file of CAs to verify the server against, for
+	// managed databases such as RDS. Setting it enables TLS.
+	TLSCAFile string
+
+	// TLSCertFile and TLSKeyFile are a PEM client certificate and key to
+	// authenticate with. Setting them enables TLS.
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// TLSSkipVerify enables TLS without verifying the server's certificate.
+	// Only use it in development.
+	TLSSkipVerify bool
+
+	// Location is the time zone DATETIME and TIMESTAMP values are read and
+	// written in. Defaults to time.Local; use time.UTC to store timestamps
+	// in UTC.
+	Location *time.Location
+
 	// Models to auto-migrate.
 	Models []interface{}
 
+	// Plugins are registered with GORM before Models are migrated, e.g.
+	// NewUUIDPlugin.
+	Plugins []gorm.Plugin
+
+	// Migrate controls whether Models are migrated on start up. By default
+	// they are migrated outside Production only.
+	Migrate MigrationMode
+
+	// MigrationLockTimeout is how long to wait for another instance to
+	// finish migrating. Defaults to DefaultMigrationLockTimeout.
+	MigrationLockTimeout time.Duration
+
 	// ExtraConfig defines the GORM configuration options.
 	ExtraConfig *gorm.Config
+
+	// LogLevel sets the verbosity of the query log. Defaults to logger.Info
+	// in Development and logger.Warn elsewhere.
+	LogLevel logger.LogLevel
+
+	// LogWriter receives the query log. Defaults to stdout.
+	LogWriter logger.Writer
+
+	// SlowQueryThreshold is the duration after which a query is logged as
+	// slow, at the Warn level. Defaults to DefaultSlowQueryThreshold; a
+	// negative value disables slow-query logging.
+	SlowQueryThreshold time.Duration
+
+	// RedactQueryParams replaces literal values in logged queries with
+	// placeholders.
+	RedactQueryParams bool
+
+	// QueryLogSampling logs only one in this many queries at the Info level.
+	// Slow queries and errors are always logged. Zero or one logs every
+	// query.
+	QueryLogSampling int
+
+	// ConnectRetries is the number of times to retry opening the connection
+	// before giving up.
+	ConnectRetries int
+
+	// ConnectRetryDelay is the delay before the first retry. It doubles after
+	// each failed attempt. Defaults to 1 second.
+	ConnectRetryDelay time.Duration
+
+	// ConnectMaxRetryDelay caps the delay between retries. Defaults to 30
+	// seconds.
+	ConnectMaxRetryDelay time.Duration
+
+	// CircuitBreaker optionally guards connection attempts, failing fast with
+	// ErrCircuitOpen while it is open.
+	CircuitBreaker *CircuitBreaker
+
+	// Clock provides the time used for GORM's timestamps. Defaults to
+	// SystemClock.
+	Clock Clock
+
+	// Profiles holds per-environment overrides, applied to the config by
+	// InitDatabase for the current Env().
+	Profiles map[Environment]func(*DatabaseConfig)
 }
 
 var db *gorm.DB
 
-func createDSN(config *DatabaseConfig) string {
-	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8&parseTime=True&loc=Local", config.User, config.Password, config.Host, config.Port, config.Database)
+func createDSN(config *DatabaseConfig, tlsParam string) (string, error) {
+	if config.DSN != "" {
+		return mergeDSN(config.DSN, tlsParam, config.Location)
+	}
+
+	params := url.Values{}
+	params.Set("charset", "utf8")
+	params.Set("parseTime", "True")
+	params.Set("loc", "Local")
+	if config.Location != nil {
+		params.Set("loc", config.Location.String())
+	}
+	if tlsParam != "" {
+		params.Set("tls", tlsParam)
+	}
+
+	for key, value := range config.DSNParams {
+		params.Set(key, value)
+	}
+
+	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?%s", config.User, config.Password, config.Host, config.Port, config.Database, params.Encode()), nil
+}
+
+// mergeDSN sets the tls and loc parameters of dsn, returning an error if dsn
+// already sets them to something else.
+func mergeDSN(dsn, tlsParam string, loc *time.Location) (string, error) {
+	if tlsParam == "" && loc == nil {
+		return dsn, nil
+	}
+
+	parsed, err := mysqldriver.ParseDSN(dsn)
+	if err != nil {
+		return "", err
+	}
+
+	var given url.Values
+	if i := strings.LastIndex(dsn, "?"); i >= 0 {
+		given, _ = url.ParseQuery(dsn[i+1:])
+	}
+
+	if tlsParam != "" {
+		if value := given.Get("tls"); value != "" && value != tlsParam {
+			return "", fmt.Errorf("cservice: DSN sets tls=%s, conflicting with the TLS settings", value)
+		}
+		parsed.TLSConfig = tlsParam
+	}
+
+	if loc != nil {
+		if value := given.Get("loc"); value != "" && value != loc.String() {
+			return "", fmt.Errorf("cservice: DSN sets loc=%s, conflicting with Location %s", value, loc)
+		}
+		parsed.Loc = loc
+	}
+
+	return parsed.FormatDSN(), nil
 }
 
 // "root:root@tcp(localhost:3306)/user-service?charset=utf8&parseTime=True&loc=Local", &gorm.Config{}
 func InitDatabase(config *DatabaseConfig) error {
+	if profile, ok := config.Profiles[Env()]; ok {
+		profile(config)
+	}
+
 	if config.ExtraConfig == nil {
 		config.ExtraConfig = &gorm.Config{}
 	}
 
-	dsn := createDSN(config)
+	if config.ExtraConfig.NowFunc == nil && (config.Clock != nil || config.Location != nil) {
+		clock := clockOrSystem(config.Clock)
+		loc := config.Location
+		config.ExtraConfig.NowFunc = func() time.Time {
+			if loc == nil {
+				return clock.Now().Local()
+			}
+			return clock.Now().In(loc)
+		}
+	}
+
+	if config.ExtraConfig.Logger == nil {
+		config.ExtraConfig.Logger = newQueryLogger(config)
+	}
+
+	tlsParam, err := configureTLS(config)
+	if err != nil {
+		return err
+	}
+
+	dsn, err := createDSN(config, tlsParam)
+	if err != nil {
+		return err
+	}
+
+	db, err = openWithRetry(config, dsn)
+	if err != nil {
+		return err
+	}
 
-	var err error
-	db, err = gorm.Open(mysql.Open(dsn), config.ExtraConfig)
+	for _, plugin := range config.Plugins {
+		if err := db.Use(plugin); err != nil {
+			return err
+		}
+	}
 
-	if err == nil {
-		for _, model := range config.Models {
-			err := db.AutoMigrate(model)
-			if err != nil {
-				break
+	return migrate(db, config)
+}
+
+// openWithRetry opens the connection, retrying with exponential backoff as
+// configured.
+func openWithRetry(config *DatabaseConfig, dsn string) (*gorm.DB, error) {
+	delay := config.ConnectRetryDelay
+	if delay <= 0 {
+		delay = time.Second
+	}
+
+	maxDelay := config.ConnectMaxRetryDelay
+	if maxDelay <= 0 {
+		maxDelay = 30 * time.Second
+	}
+
+	for attempt := 0; ; attempt++ {
+		conn, err := openAttempt(config, dsn)
+		if err == nil {
+			return conn, nil
+		}
+
+		if attempt >= config.ConnectRetries {
+			return nil, err
+		}
+
+		// Wait out an open breaker's cooldown rather than spending the
+		// remaining attempts on calls it would reject.
+		wait := delay
+		if errors.Is(err, ErrCircuitOpen) {
+			if cooldown := config.CircuitBreaker.retryIn(); cooldown > wait {
+				wait = cooldown
 			}
 		}
+
+		time.Sleep(wait)
+
+		delay *= 2
+		if delay > maxDelay {
+			delay = maxDelay
+		}
+	}
+}
+
+// openDatabase opens and pings the database. Tests replace it.
+var openDatabase = func(dsn string, config *gorm.Config) (*gorm.DB, error) {
+	return gorm.Open(mysql.Open(dsn), config)
+}
+
+// openAttempt makes one connection attempt through the circuit breaker,
+// closing the connection pool if the attempt fails.
+func openAttempt(config *DatabaseConfig, dsn string) (*gorm.DB, error) {
+	breaker := config.CircuitBreaker
+	if breaker != nil {
+		if err := breaker.Allow(); err != nil {
+			return nil, err
+		}
+	}
+
+	conn, err := openDatabase(dsn, config.ExtraConfig)
+	if err != nil {
+		if conn != nil {
+			if sqlDB, dbErr := conn.DB(); dbErr == nil {
+				sqlDB.Close()
+			}
+		}
+
+		if breaker != nil {
+			breaker.Failure()
+		}
+		return nil, err
+	}
+
+	if breaker != nil {
+		breaker.Success()
+	}
+	return conn, nil
+}
+
+// ErrDatabaseNotInitialised is returned when the database is used before
+// InitDatabase has succeeded.
+var ErrDatabaseNotInitialised = errors.New("cservice: database not initialised")
+
+// DBStats returns the connection pool statistics of the database opened by
+// InitDatabase.
+func DBStats() (sql.DBStats, error) {
+	if db == nil {
+		return sql.DBStats{}, ErrDatabaseNotInitialised
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return sql.DBStats{}, err
 	}
 
-	return err
+	return sqlDB.Stats(), nil
 }
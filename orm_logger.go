@@ -0,0 +1,251 @@
+package cservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the given request ID. Queries
+// run with this context (db.WithContext(ctx)) are tagged with the ID in the
+// query log.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID stored in ctx, or an empty string.
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+var (
+	stringLiteral  = regexp.MustCompile(`'(?:[^'\\]|\\.)*'`)
+	numericLiteral = regexp.MustCompile(`\b\d+(?:\.\d+)?\b`)
+)
+
+// redactSQL replaces the literal values GORM interpolates into logged SQL with
+// placeholders.
+func redactSQL(sql string) string {
+	sql = stringLiteral.ReplaceAllString(sql, "?")
+	return numericLiteral.ReplaceAllString(sql, "?")
+}
+
+// DefaultSlowQueryThreshold is the duration after which queries are logged as
+// slow unless DatabaseConfig.SlowQueryThreshold says otherwise. It matches
+// GORM's default logger.
+const DefaultSlowQueryThreshold = 200 * time.Millisecond
+
+// queryLogLevel is the level of the query logger installed by InitDatabase.
+var queryLogLevel int32
+
+// logLevelNames maps query log levels to the names used by LogLevelHandler.
+var logLevelNames = map[logger.LogLevel]string{
+	logger.Silent: "silent",
+	logger.Error:  "error",
+	logger.Warn:   "warn",
+	logger.Info:   "info",
+}
+
+// SetQueryLogLevel changes the verbosity of the query log at runtime.
+func SetQueryLogLevel(level logger.LogLevel) {
+	atomic.StoreInt32(&queryLogLevel, int32(level))
+}
+
+// QueryLogLevel returns the current verbosity of the query log.
+func QueryLogLevel() logger.LogLevel {
+	return logger.LogLevel(atomic.LoadInt32(&queryLogLevel))
+}
+
+// LogLevelHandler serves the query log level as text on GET, and changes it
+// on PUT or POST to the level named in the body: silent, error, warn or info.
+// Mount it behind authentication, e.g. at /debug/loglevel.
+func LogLevelHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			body, err := ioutil.ReadAll(http.MaxBytesReader(rw, r.Body, 64))
+			if err != nil {
+				http.Error(rw, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+				return
+			}
+
+			level, ok := parseLogLevel(strings.TrimSpace(string(body)))
+			if !ok {
+				http.Error(rw, "unknown log level", http.StatusBadRequest)
+				return
+			}
+
+			SetQueryLogLevel(level)
+		default:
+			http.Error(rw, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(rw, logLevelNames[QueryLogLevel()])
+	})
+}
+
+func parseLogLevel(name string) (logger.LogLevel, bool) {
+	for level, levelName := range logLevelNames {
+		if strings.EqualFold(name, levelName) {
+			return level, true
+		}
+	}
+	return 0, false
+}
+
+// queryLogger wraps a GORM logger, adding parameter redaction, request ID
+// correlation, sampling and a level which can change at runtime. The wrapped
+// logger logs everything; queryLogger decides what reaches it.
+type queryLogger struct {
+	logger.Interface
+	redact   bool
+	level    *int32
+	slow     time.Duration
+	sampling uint64
+	count    *uint64
+}
+
+// logWriter returns the configured log writer, defaulting to stdout.
+func logWriter(config *DatabaseConfig) logger.Writer {
+	if config.LogWriter == nil {
+		return log.New(os.Stdout, "\r\n", log.LstdFlags)
+	}
+	return config.LogWriter
+}
+
+func newQueryLogger(config *DatabaseConfig) logger.Interface {
+	writer := logWriter(config)
+
+	level := config.LogLevel
+	if level == 0 {
+		level = logger.Warn
+		if IsDevelopment() {
+			level = logger.Info
+		}
+	}
+
+	SetQueryLogLevel(level)
+
+	slow := config.SlowQueryThreshold
+	switch {
+	case slow == 0:
+		slow = DefaultSlowQueryThreshold
+	case slow < 0:
+		slow = 0
+	}
+
+	sampling := uint64(1)
+	if config.QueryLogSampling > 1 {
+		sampling = uint64(config.QueryLogSampling)
+	}
+
+	return &queryLogger{
+		Interface: logger.New(writer, logger.Config{
+			SlowThreshold:             slow,
+			IgnoreRecordNotFoundError: true,
+			LogLevel:                  logger.Info,
+		}),
+		redact:   config.RedactQueryParams,
+		level:    &queryLogLevel,
+		slow:     slow,
+		sampling: sampling,
+		count:    new(uint64),
+	}
+}
+
+// LogMode returns a copy of the logger fixed at level, as used by
+// db.Debug(). It is unaffected by SetQueryLogLevel and sampling.
+func (l *queryLogger) LogMode(level logger.LogLevel) logger.Interface {
+	newLogger := *l
+	newLogger.level = new(int32)
+	*newLogger.level = int32(level)
+	newLogger.sampling = 1
+	return &newLogger
+}
+
+func (l *queryLogger) enabled(level logger.LogLevel) bool {
+	return logger.LogLevel(atomic.LoadInt32(l.level)) >= level
+}
+
+// Info logs an info message.
+func (l *queryLogger) Info(ctx context.Context, msg string, data ...interface{}) {
+	if l.enabled(logger.Info) {
+		l.Interface.Info(ctx, l.formatPrefix(ctx)+msg, data...)
+	}
+}
+
+// Warn logs a warning message.
+func (l *queryLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	if l.enabled(logger.Warn) {
+		l.Interface.Warn(ctx, l.formatPrefix(ctx)+msg, data...)
+	}
+}
+
+// Error logs an error message.
+func (l *queryLogger) Error(ctx context.Context, msg string, data ...interface{}) {
+	if l.enabled(logger.Error) {
+		l.Interface.Error(ctx, l.formatPrefix(ctx)+msg, data...)
+	}
+}
+
+// Trace logs an executed query. Failed queries need the Error level, slow
+// queries Warn, and others Info, where they are sampled.
+func (l *queryLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		if !l.enabled(logger.Error) {
+			return
+		}
+	case l.slow != 0 && time.Since(begin) > l.slow:
+		if !l.enabled(logger.Warn) {
+			return
+		}
+	default:
+		if !l.enabled(logger.Info) || atomic.AddUint64(l.count, 1)%l.sampling != 0 {
+			return
+		}
+	}
+
+	prefix := l.prefix(ctx)
+	l.Interface.Trace(ctx, begin, func() (string, int64) {
+		sql, rows := fc()
+		if l.redact {
+			sql = redactSQL(sql)
+		}
+		return prefix + sql, rows
+	}, err)
+}
+
+// formatPrefix returns the request ID prefix escaped for use in a format
+// string.
+func (l *queryLogger) formatPrefix(ctx context.Context) string {
+	return strings.ReplaceAll(l.prefix(ctx), "%", "%%")
+}
+
+func (l *queryLogger) prefix(ctx context.Context) string {
+	if id := RequestID(ctx); id != "" {
+		return "[request_id:" + id + "] "
+	}
+	return ""
+}
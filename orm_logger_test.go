@@ -0,0 +1,136 @@
+package cservice
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm/logger"
+)
+
+func TestRedactSQL(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want string
+	}{
+		{"SELECT * FROM users WHERE email = 'ann@example.com'", "SELECT * FROM users WHERE email = ?"},
+		{"SELECT * FROM users WHERE id = 42 AND score > 1.5", "SELECT * FROM users WHERE id = ? AND score > ?"},
+		{`UPDATE users SET name = 'O\'Brien' WHERE id = 7`, "UPDATE users SET name = ? WHERE id = ?"},
+		{"SELECT * FROM users_2024 LIMIT 10", "SELECT * FROM users_2024 LIMIT ?"},
+	}
+
+	for _, test := range tests {
+		if got := redactSQL(test.sql); got != test.want {
+			t.Errorf("redactSQL(%q) = %q, want %q", test.sql, got, test.want)
+		}
+	}
+}
+
+// newTestQueryLogger returns a query logger writing to a buffer, restoring
+// the global query log level afterwards.
+func newTestQueryLogger(t *testing.T, config DatabaseConfig) (*queryLogger, *bufferWriter) {
+	saved := QueryLogLevel()
+	t.Cleanup(func() { SetQueryLogLevel(saved) })
+
+	out := &bufferWriter{}
+	config.LogWriter = out
+	return newQueryLogger(&config).(*queryLogger), out
+}
+
+func traceQuery(l logger.Interface, ctx context.Context, sql string, elapsed time.Duration, err error) {
+	l.Trace(ctx, time.Now().Add(-elapsed), func() (string, int64) { return sql, 1 }, err)
+}
+
+func TestQueryLoggerRedactsAndTagsRequests(t *testing.T) {
+	l, out := newTestQueryLogger(t, DatabaseConfig{LogLevel: logger.Info, RedactQueryParams: true})
+
+	traceQuery(l, WithRequestID(context.Background(), "req-1"), "SELECT * FROM users WHERE email = 'ann@example.com'", 0, nil)
+
+	logged := out.String()
+	if strings.Contains(logged, "ann@example.com") || !strings.Contains(logged, "email = ?") {
+		t.Errorf("query not redacted: %q", logged)
+	}
+	if !strings.Contains(logged, "[request_id:req-1] SELECT") {
+		t.Errorf("query not tagged with the request ID: %q", logged)
+	}
+}
+
+func TestQueryLoggerSampling(t *testing.T) {
+	l, out := newTestQueryLogger(t, DatabaseConfig{LogLevel: logger.Info, QueryLogSampling: 3})
+
+	for i := 0; i < 6; i++ {
+		traceQuery(l, context.Background(), "SELECT 1", 0, nil)
+	}
+	traceQuery(l, context.Background(), "SELECT broken", 0, errors.New("syntax error"))
+
+	if got := strings.Count(out.String(), "SELECT 1"); got != 2 {
+		t.Errorf("logged %d of 6 queries, want 2", got)
+	}
+	if !strings.Contains(out.String(), "syntax error") {
+		t.Error("failed query was sampled out")
+	}
+}
+
+func TestQueryLoggerRuntimeLevel(t *testing.T) {
+	l, out := newTestQueryLogger(t, DatabaseConfig{LogLevel: logger.Info})
+
+	SetQueryLogLevel(logger.Warn)
+	traceQuery(l, context.Background(), "SELECT hidden", 0, nil)
+	if out.Len() != 0 {
+		t.Errorf("Info query logged at Warn: %q", out.String())
+	}
+
+	rec := httptest.NewRecorder()
+	LogLevelHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/", strings.NewReader("info\n")))
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != "info" || QueryLogLevel() != logger.Info {
+		t.Fatalf("PUT info: got %d %q, level %d", rec.Code, rec.Body, QueryLogLevel())
+	}
+
+	traceQuery(l, context.Background(), "SELECT shown", 0, nil)
+	if !strings.Contains(out.String(), "SELECT shown") {
+		t.Errorf("Info query not logged after raising the level: %q", out.String())
+	}
+
+	rec = httptest.NewRecorder()
+	LogLevelHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/", strings.NewReader("loud")))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown level: got %d", rec.Code)
+	}
+
+	debug := l.LogMode(logger.Info)
+	SetQueryLogLevel(logger.Silent)
+	traceQuery(debug, context.Background(), "SELECT debug", 0, nil)
+	if !strings.Contains(out.String(), "SELECT debug") {
+		t.Error("LogMode copy followed the runtime level")
+	}
+}
+
+func TestQueryLoggerSlowQueries(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold time.Duration
+		elapsed   time.Duration
+		logged    bool
+	}{
+		{"default threshold, slow", 0, 300 * time.Millisecond, true},
+		{"default threshold, fast", 0, 10 * time.Millisecond, false},
+		{"custom threshold", 50 * time.Millisecond, 60 * time.Millisecond, true},
+		{"disabled", -1, time.Hour, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l, out := newTestQueryLogger(t, DatabaseConfig{LogLevel: logger.Warn, SlowQueryThreshold: test.threshold})
+
+			traceQuery(l, context.Background(), "SELECT sleep", test.elapsed, nil)
+
+			if logged := strings.Contains(out.String(), "SLOW SQL"); logged != test.logged {
+				t.Errorf("logged %v, want %v: %q", logged, test.logged, out.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package cservice
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crockerio/cservice/cservicetest"
+	"gorm.io/gorm"
+)
+
+func TestOpenWithRetryWaitsForBreaker(t *testing.T) {
+	var failed []*gorm.DB
+	attempts := 0
+
+	open := openDatabase
+	t.Cleanup(func() { openDatabase = open })
+	openDatabase = func(dsn string, config *gorm.Config) (*gorm.DB, error) {
+		attempts++
+		conn := cservicetest.OpenDB(t)
+		if attempts < 3 {
+			failed = append(failed, conn)
+			return conn, errors.New("connection refused")
+		}
+		return conn, nil
+	}
+
+	config := &DatabaseConfig{
+		ConnectRetries:    5,
+		ConnectRetryDelay: time.Millisecond,
+		CircuitBreaker:    NewCircuitBreaker(1, 20*time.Millisecond),
+		ExtraConfig:       &gorm.Config{},
+	}
+
+	if _, err := openWithRetry(config, ""); err != nil {
+		t.Fatalf("got %v after %d attempts", err, attempts)
+	}
+	if attempts != 3 {
+		t.Errorf("got %d attempts, want 3", attempts)
+	}
+
+	for _, conn := range failed {
+		sqlDB, _ := conn.DB()
+		if err := sqlDB.Ping(); err == nil {
+			t.Error("failed attempt's connection pool was not closed")
+		}
+	}
+}
+
+func TestCreateDSNMergesTLSAndLocation(t *testing.T) {
+	params := map[string]string{"charset": "utf8mb4"}
+	config := &DatabaseConfig{User: "app", Host: "db", Port: 3306, Database: "app", DSNParams: params, Location: time.UTC}
+
+	dsn, err := createDSN(config, "true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(dsn, "tls=true") || !strings.Contains(dsn, "loc=UTC") || !strings.Contains(dsn, "charset=utf8mb4") {
+		t.Errorf("got %s", dsn)
+	}
+	if len(params) != 1 {
+		t.Errorf("DSNParams was modified: %v", params)
+	}
+
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	config.DSN = "app:secret@tcp(db:3306)/app?parseTime=true"
+	config.Location = london
+	dsn, err = createDSN(config, "custom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(dsn, "tls=custom") || !strings.Contains(dsn, "loc=Europe%2FLondon") || !strings.Contains(dsn, "parseTime=true") {
+		t.Errorf("custom DSN: got %s", dsn)
+	}
+
+	config.DSN = "app:secret@tcp(db:3306)/app?tls=false"
+	if _, err := createDSN(config, "custom"); err == nil {
+		t.Error("conflicting tls parameter was accepted")
+	}
+
+	config.DSN = "app:secret@tcp(db:3306)/app?loc=Local"
+	if _, err := createDSN(config, ""); err == nil {
+		t.Error("conflicting loc parameter was accepted")
+	}
+}
@@ -0,0 +1,81 @@
+package cservice
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+)
+
+// configureTLS registers the TLS settings of config with the MySQL driver and
+// returns the value of the DSN's tls parameter, or "" if TLS is not enabled.
+// Custom settings are registered under a name derived from their contents,
+// so databases with different settings do not overwrite each other's.
+func configureTLS(config *DatabaseConfig) (string, error) {
+	custom := config.TLSCAFile != "" || config.TLSCertFile != "" || config.TLSKeyFile != ""
+
+	switch {
+	case !custom && config.TLSSkipVerify:
+		return "skip-verify", nil
+	case !custom && config.TLS:
+		return "true", nil
+	case !custom:
+		return "", nil
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         config.Host,
+		InsecureSkipVerify: config.TLSSkipVerify,
+	}
+
+	name := sha256.New()
+	fmt.Fprintf(name, "%s\x00%t\x00", config.Host, config.TLSSkipVerify)
+
+	if config.TLSCAFile != "" {
+		pem, err := ioutil.ReadFile(config.TLSCAFile)
+		if err != nil {
+			return "", err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return "", errors.New("cservice: no certificates found in " + config.TLSCAFile)
+		}
+		tlsConfig.RootCAs = pool
+		name.Write(pem)
+	}
+	name.Write([]byte{0})
+
+	if config.TLSCertFile != "" || config.TLSKeyFile != "" {
+		certPEM, err := ioutil.ReadFile(config.TLSCertFile)
+		if err != nil {
+			return "", err
+		}
+
+		keyPEM, err := ioutil.ReadFile(config.TLSKeyFile)
+		if err != nil {
+			return "", err
+		}
+
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return "", err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+		name.Write(certPEM)
+		name.Write([]byte{0})
+		name.Write(keyPEM)
+	}
+
+	tlsConfigName := "cservice-" + hex.EncodeToString(name.Sum(nil))[:16]
+	if err := mysqldriver.RegisterTLSConfig(tlsConfigName, tlsConfig); err != nil {
+		return "", err
+	}
+
+	return tlsConfigName, nil
+}
@@ -0,0 +1,125 @@
+package cservice
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTestCert writes a self-signed certificate and its key to dir,
+// returning their paths.
+func writeTestCert(t *testing.T, dir, name string) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return certFile, keyFile
+}
+
+func TestConfigureTLS(t *testing.T) {
+	dir := t.TempDir()
+	caA, _ := writeTestCert(t, dir, "ca-a")
+	caB, _ := writeTestCert(t, dir, "ca-b")
+	clientCert, clientKey := writeTestCert(t, dir, "client")
+
+	for _, tt := range []struct {
+		config DatabaseConfig
+		want   string
+	}{
+		{DatabaseConfig{}, ""},
+		{DatabaseConfig{TLS: true}, "true"},
+		{DatabaseConfig{TLS: true, TLSSkipVerify: true}, "skip-verify"},
+	} {
+		if got, err := configureTLS(&tt.config); err != nil || got != tt.want {
+			t.Errorf("%+v: got %q, %v, want %q", tt.config, got, err, tt.want)
+		}
+	}
+
+	names := map[string]string{}
+	for label, config := range map[string]DatabaseConfig{
+		"CA A":             {Host: "db.internal", TLSCAFile: caA},
+		"CA B":             {Host: "db.internal", TLSCAFile: caB},
+		"other host":       {Host: "replica.internal", TLSCAFile: caA},
+		"skip verify":      {Host: "db.internal", TLSCAFile: caA, TLSSkipVerify: true},
+		"client cert":      {Host: "db.internal", TLSCAFile: caA, TLSCertFile: clientCert, TLSKeyFile: clientKey},
+		"client cert only": {Host: "db.internal", TLSCertFile: clientCert, TLSKeyFile: clientKey},
+	} {
+		config := config
+		name, err := configureTLS(&config)
+		if err != nil {
+			t.Fatalf("%s: %v", label, err)
+		}
+		if !strings.HasPrefix(name, "cservice-") {
+			t.Errorf("%s: got name %q", label, name)
+		}
+		if other, ok := names[name]; ok {
+			t.Errorf("%s and %s share the TLS config name %q", label, other, name)
+		}
+		names[name] = label
+
+		again, err := configureTLS(&config)
+		if err != nil || again != name {
+			t.Errorf("%s: registering again gave %q, %v, want %q", label, again, err, name)
+		}
+	}
+}
+
+func TestConfigureTLSErrors(t *testing.T) {
+	dir := t.TempDir()
+	cert, key := writeTestCert(t, dir, "client")
+	notPEM := filepath.Join(dir, "ca.txt")
+	if err := ioutil.WriteFile(notPEM, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for label, config := range map[string]DatabaseConfig{
+		"missing CA":     {TLSCAFile: filepath.Join(dir, "missing.crt")},
+		"CA without PEM": {TLSCAFile: notPEM},
+		"key only":       {TLSKeyFile: key},
+		"mismatched key": {TLSCertFile: cert, TLSKeyFile: cert},
+	} {
+		config := config
+		if _, err := configureTLS(&config); err == nil {
+			t.Errorf("%s: no error", label)
+		}
+	}
+}
@@ -0,0 +1,467 @@
+package cservice
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Patch media types.
+const (
+	MergePatchContentType = "application/merge-patch+json"
+	JSONPatchContentType  = "application/json-patch+json"
+)
+
+// ErrUnsupportedPatchType is returned by ApplyPatch for bodies which are
+// neither JSON Merge Patch nor JSON Patch. Respond with 415 Unsupported Media
+// Type.
+var ErrUnsupportedPatchType = errors.New("cservice: unsupported patch content type")
+
+// ErrPatchTestFailed is returned when a JSON Patch "test" operation fails.
+// Respond with 409 Conflict.
+var ErrPatchTestFailed = errors.New("cservice: patch test failed")
+
+// ApplyPatch applies the PATCH request body to model, a pointer to a struct.
+// Bodies of type application/merge-patch+json (RFC 7386), or plain
+// application/json, are merged; application/json-patch+json bodies (RFC 6902)
+// are applied as a list of operations. Changes to the top-level JSON fields
+// named in immutable, e.g. "id" or "created_at", are discarded. Fields which
+// are not encoded to JSON are left untouched.
+func ApplyPatch(r *http.Request, model interface{}, immutable ...string) error {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return ErrUnsupportedPatchType
+	}
+
+	var patch interface{}
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		return fmt.Errorf("cservice: invalid patch: %w", err)
+	}
+
+	original, err := toJSONDocument(model)
+	if err != nil {
+		return err
+	}
+
+	var patched interface{}
+	switch mediaType {
+	case MergePatchContentType, "application/json":
+		patched = MergePatch(original, patch)
+	case JSONPatchContentType:
+		if patched, err = JSONPatch(original, patch); err != nil {
+			return err
+		}
+	default:
+		return ErrUnsupportedPatchType
+	}
+
+	return applyDocument(model, original, patched, immutable)
+}
+
+// MergePatch applies a JSON Merge Patch to doc and returns the result. Both
+// are decoded JSON values; doc is not modified.
+func MergePatch(doc, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	result := map[string]interface{}{}
+	if docObject, ok := doc.(map[string]interface{}); ok {
+		for k, v := range docObject {
+			result[k] = v
+		}
+	}
+
+	for k, v := range patchObject {
+		if v == nil {
+			delete(result, k)
+			continue
+		}
+		result[k] = MergePatch(result[k], v)
+	}
+
+	return result
+}
+
+// JSONPatch applies a list of JSON Patch operations to doc and returns the
+// result. Both are decoded JSON values; doc is not modified.
+func JSONPatch(doc, patch interface{}) (interface{}, error) {
+	operations, ok := patch.([]interface{})
+	if !ok {
+		return nil, errors.New("cservice: invalid patch: expected an array of operations")
+	}
+
+	doc = deepCopyJSON(doc)
+
+	for i, raw := range operations {
+		operation, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("cservice: invalid patch: operation %d is not an object", i)
+		}
+
+		op, _ := operation["op"].(string)
+		path, ok := operation["path"].(string)
+		if !ok {
+			return nil, fmt.Errorf("cservice: invalid patch: operation %d has no path", i)
+		}
+
+		value, hasValue := operation["value"]
+		if (op == "add" || op == "replace" || op == "test") && !hasValue {
+			return nil, fmt.Errorf("cservice: invalid patch: operation %d has no value", i)
+		}
+
+		var err error
+		switch op {
+		case "add":
+			doc, err = jsonPointerAdd(doc, path, deepCopyJSON(value))
+		case "remove":
+			doc, _, err = jsonPointerRemove(doc, path)
+		case "replace":
+			if doc, _, err = jsonPointerRemove(doc, path); err == nil {
+				doc, err = jsonPointerAdd(doc, path, deepCopyJSON(value))
+			}
+		case "move", "copy":
+			from, ok := operation["from"].(string)
+			if !ok {
+				return nil, fmt.Errorf("cservice: invalid patch: operation %d has no from", i)
+			}
+
+			var moved interface{}
+			if op == "move" {
+				if strings.HasPrefix(path, from+"/") {
+					return nil, fmt.Errorf("cservice: invalid patch: cannot move %q into itself", from)
+				}
+				doc, moved, err = jsonPointerRemove(doc, from)
+			} else {
+				moved, err = jsonPointerGet(doc, from)
+				moved = deepCopyJSON(moved)
+			}
+			if err == nil {
+				doc, err = jsonPointerAdd(doc, path, moved)
+			}
+		case "test":
+			var actual interface{}
+			if actual, err = jsonPointerGet(doc, path); err == nil && !reflect.DeepEqual(actual, value) {
+				err = fmt.Errorf("%w: %s", ErrPatchTestFailed, path)
+			}
+		default:
+			err = fmt.Errorf("cservice: invalid patch: unknown operation %q", op)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return doc, nil
+}
+
+// toJSONDocument encodes v and decodes it as a generic JSON value.
+func toJSONDocument(v interface{}) (interface{}, error) {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(encoded, &doc); err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+// applyDocument decodes patched into model, restoring immutable fields from
+// original. Every top-level field of original is reset to its zero value
+// first, as decoding alone would keep fields, and nested object keys, which
+// the patch removed.
+func applyDocument(model, original, patched interface{}, immutable []string) error {
+	result, ok := patched.(map[string]interface{})
+	if !ok {
+		return errors.New("cservice: invalid patch: result is not an object")
+	}
+
+	before, _ := original.(map[string]interface{})
+
+	for _, k := range immutable {
+		if v, ok := before[k]; ok {
+			result[k] = v
+		} else {
+			delete(result, k)
+		}
+	}
+
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	// Decode into a copy, so model is untouched if the patch is invalid.
+	value := reflect.ValueOf(model).Elem()
+	decoded := reflect.New(value.Type())
+	decoded.Elem().Set(value)
+
+	for k := range before {
+		if field, ok := jsonField(decoded.Elem(), k); ok {
+			field.Set(reflect.Zero(field.Type()))
+		}
+	}
+
+	if err := json.Unmarshal(encoded, decoded.Interface()); err != nil {
+		return fmt.Errorf("cservice: invalid patch: %w", err)
+	}
+
+	value.Set(decoded.Elem())
+
+	return nil
+}
+
+// jsonField returns the field of struct v which encoding/json uses for the
+// object key name, looking into embedded structs.
+func jsonField(v reflect.Value, name string) (reflect.Value, bool) {
+	if v.Kind() != reflect.Struct {
+		return reflect.Value{}, false
+	}
+
+	var fold reflect.Value
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		tagName := strings.Split(tag, ",")[0]
+
+		if field.Anonymous && tagName == "" {
+			embedded := v.Field(i)
+			if embedded.Kind() == reflect.Ptr {
+				if embedded.IsNil() {
+					continue
+				}
+				embedded = embedded.Elem()
+			}
+			if found, ok := jsonField(embedded, name); ok {
+				return found, true
+			}
+			continue
+		}
+
+		if field.PkgPath != "" {
+			continue
+		}
+
+		if tagName != "" {
+			if tagName == name {
+				return v.Field(i), true
+			}
+			continue
+		}
+
+		if field.Name == name {
+			return v.Field(i), true
+		}
+		if !fold.IsValid() && strings.EqualFold(field.Name, name) {
+			fold = v.Field(i)
+		}
+	}
+
+	return fold, fold.IsValid()
+}
+
+func deepCopyJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			copied[k] = deepCopyJSON(item)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = deepCopyJSON(item)
+		}
+		return copied
+	default:
+		return v
+	}
+}
+
+// parseJSONPointer splits an RFC 6901 JSON Pointer into unescaped tokens.
+func parseJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("cservice: invalid patch: bad path %q", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+
+	return tokens, nil
+}
+
+// arrayIndex parses token as an index into an array of length n. "-", which
+// refers to the end of the array, is allowed if end is true.
+func arrayIndex(token string, n int, end bool) (int, error) {
+	if token == "-" && end {
+		return n, nil
+	}
+
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > n || (i == n && !end) || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("cservice: invalid patch: bad array index %q", token)
+	}
+
+	return i, nil
+}
+
+func jsonPointerGet(doc interface{}, pointer string) (interface{}, error) {
+	tokens, err := parseJSONPointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, token := range tokens {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if doc, ok = node[token]; !ok {
+				return nil, fmt.Errorf("cservice: invalid patch: path %q does not exist", pointer)
+			}
+		case []interface{}:
+			i, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, fmt.Errorf("cservice: invalid patch: path %q does not exist", pointer)
+		}
+	}
+
+	return doc, nil
+}
+
+// jsonPointerAdd returns doc with value added at pointer. Containers are
+// modified in place, but arrays may be reallocated, so the result must be
+// used.
+func jsonPointerAdd(doc interface{}, pointer string, value interface{}) (interface{}, error) {
+	tokens, err := parseJSONPointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tokens) == 0 {
+		return value, nil
+	}
+
+	parentPointer := pointer[:strings.LastIndex(pointer, "/")]
+	parent, err := jsonPointerGet(doc, parentPointer)
+	if err != nil {
+		return nil, err
+	}
+
+	last := tokens[len(tokens)-1]
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[last] = value
+		return doc, nil
+	case []interface{}:
+		i, err := arrayIndex(last, len(node), true)
+		if err != nil {
+			return nil, err
+		}
+
+		node = append(node, nil)
+		copy(node[i+1:], node[i:])
+		node[i] = value
+		return jsonPointerSet(doc, parentPointer, node)
+	default:
+		return nil, fmt.Errorf("cservice: invalid patch: path %q does not exist", pointer)
+	}
+}
+
+// jsonPointerSet returns doc with the existing value at pointer replaced.
+func jsonPointerSet(doc interface{}, pointer string, value interface{}) (interface{}, error) {
+	tokens, err := parseJSONPointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tokens) == 0 {
+		return value, nil
+	}
+
+	parent, err := jsonPointerGet(doc, pointer[:strings.LastIndex(pointer, "/")])
+	if err != nil {
+		return nil, err
+	}
+
+	last := tokens[len(tokens)-1]
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[last] = value
+	case []interface{}:
+		i, err := arrayIndex(last, len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		node[i] = value
+	}
+
+	return doc, nil
+}
+
+// jsonPointerRemove returns doc with the value at pointer removed, and the
+// removed value.
+func jsonPointerRemove(doc interface{}, pointer string) (interface{}, interface{}, error) {
+	tokens, err := parseJSONPointer(pointer)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(tokens) == 0 {
+		return nil, doc, nil
+	}
+
+	parentPointer := pointer[:strings.LastIndex(pointer, "/")]
+	parent, err := jsonPointerGet(doc, parentPointer)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	last := tokens[len(tokens)-1]
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		removed, ok := node[last]
+		if !ok {
+			return nil, nil, fmt.Errorf("cservice: invalid patch: path %q does not exist", pointer)
+		}
+		delete(node, last)
+		return doc, removed, nil
+	case []interface{}:
+		i, err := arrayIndex(last, len(node), false)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		removed := node[i]
+		node = append(node[:i:i], node[i+1:]...)
+		doc, err = jsonPointerSet(doc, parentPointer, node)
+		return doc, removed, err
+	default:
+		return nil, nil, fmt.Errorf("cservice: invalid patch: path %q does not exist", pointer)
+	}
+}
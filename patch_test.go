@@ -0,0 +1,82 @@
+package cservice
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type patchAddress struct {
+	City     string `json:"city"`
+	Postcode string `json:"postcode,omitempty"`
+}
+
+type patchUser struct {
+	ID       uint              `json:"id"`
+	Name     string            `json:"name"`
+	Address  patchAddress      `json:"address"`
+	Labels   map[string]string `json:"labels"`
+	Tags     []string          `json:"tags"`
+	internal string
+}
+
+func patchRequest(contentType, body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPatch, "/users/1", strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	return req
+}
+
+func TestApplyMergePatchRemovesNestedKeys(t *testing.T) {
+	user := patchUser{
+		ID:       1,
+		Name:     "Alice",
+		Address:  patchAddress{City: "Leeds", Postcode: "LS1"},
+		Labels:   map[string]string{"team": "core", "tier": "gold"},
+		internal: "kept",
+	}
+
+	patch := `{"id": 2, "address": {"postcode": null}, "labels": {"tier": null}, "tags": ["a"]}`
+	if err := ApplyPatch(patchRequest(MergePatchContentType, patch), &user, "id"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := patchUser{
+		ID:       1,
+		Name:     "Alice",
+		Address:  patchAddress{City: "Leeds"},
+		Labels:   map[string]string{"team": "core"},
+		Tags:     []string{"a"},
+		internal: "kept",
+	}
+	if !reflect.DeepEqual(user, want) {
+		t.Errorf("got %+v, want %+v", user, want)
+	}
+}
+
+func TestApplyJSONPatch(t *testing.T) {
+	user := patchUser{Name: "Alice", Tags: []string{"a", "b"}}
+
+	patch := `[
+		{"op": "test", "path": "/name", "value": "Alice"},
+		{"op": "replace", "path": "/name", "value": "Bob"},
+		{"op": "remove", "path": "/tags/0"},
+		{"op": "add", "path": "/tags/-", "value": "c"}
+	]`
+	if err := ApplyPatch(patchRequest(JSONPatchContentType, patch), &user); err != nil {
+		t.Fatal(err)
+	}
+	if user.Name != "Bob" || !reflect.DeepEqual(user.Tags, []string{"b", "c"}) {
+		t.Errorf("got %+v", user)
+	}
+
+	failing := `[{"op": "test", "path": "/name", "value": "Alice"}, {"op": "replace", "path": "/name", "value": "Eve"}]`
+	if err := ApplyPatch(patchRequest(JSONPatchContentType, failing), &user); !errors.Is(err, ErrPatchTestFailed) {
+		t.Errorf("got %v, want ErrPatchTestFailed", err)
+	}
+	if user.Name != "Bob" {
+		t.Errorf("failed patch modified the model: %+v", user)
+	}
+}
@@ -0,0 +1,152 @@
+package cservice
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"gorm.io/gorm/logger"
+)
+
+// PreflightPolicy decides whether failed preflight checks stop startup.
+type PreflightPolicy int
+
+const (
+	// PreflightFailFast stops at the first failed check.
+	PreflightFailFast PreflightPolicy = iota
+
+	// PreflightDegrade runs every check and only stops for failed Required
+	// checks, so the service can start with reduced functionality.
+	PreflightDegrade
+)
+
+// PreflightCheck verifies a dependency before the service starts serving.
+type PreflightCheck struct {
+	Name string
+
+	// Check returns an error if the dependency is not ready.
+	Check func(ctx context.Context) error
+
+	// Required checks stop startup even under PreflightDegrade.
+	Required bool
+}
+
+// PreflightConfig defines the checks run by RunPreflight.
+type PreflightConfig struct {
+	Checks []PreflightCheck
+
+	// Policy decides whether failures stop startup.
+	Policy PreflightPolicy
+
+	// Timeout limits each check. Defaults to 10 seconds.
+	Timeout time.Duration
+
+	// Writer receives a line per check. Defaults to stdout.
+	Writer logger.Writer
+}
+
+// PreflightResult is the outcome of one check.
+type PreflightResult struct {
+	Name     string
+	Err      error
+	Duration time.Duration
+}
+
+// RunPreflight runs the configured checks in order, logging each result.
+// Call it before opening the listener. It returns an error if startup should
+// stop under the configured policy, along with the results so far, which
+// report the dependencies a degraded service is running without.
+func RunPreflight(ctx context.Context, config PreflightConfig) ([]PreflightResult, error) {
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+
+	writer := config.Writer
+	if writer == nil {
+		writer = log.New(os.Stdout, "", log.LstdFlags)
+	}
+
+	var results []PreflightResult
+	var failed []string
+	for _, check := range config.Checks {
+		checkCtx, cancel := context.WithTimeout(ctx, config.Timeout)
+		start := time.Now()
+		err := check.Check(checkCtx)
+		cancel()
+
+		results = append(results, PreflightResult{Name: check.Name, Err: err, Duration: time.Since(start)})
+
+		if err == nil {
+			writer.Printf("[preflight] %s ok", check.Name)
+			continue
+		}
+
+		writer.Printf("[preflight] %s failed: %v", check.Name, err)
+
+		if config.Policy == PreflightFailFast {
+			return results, fmt.Errorf("cservice: preflight check %s failed: %w", check.Name, err)
+		}
+
+		if check.Required {
+			failed = append(failed, check.Name)
+		}
+	}
+
+	if len(failed) > 0 {
+		return results, fmt.Errorf("cservice: required preflight checks failed: %s", strings.Join(failed, ", "))
+	}
+
+	return results, nil
+}
+
+// DatabaseReachable is a PreflightCheck pinging the database opened by
+// InitDatabase.
+func DatabaseReachable() PreflightCheck {
+	return PreflightCheck{
+		Name:     "database",
+		Required: true,
+		Check: func(ctx context.Context) error {
+			if db == nil {
+				return ErrDatabaseNotInitialised
+			}
+
+			sqlDB, err := db.DB()
+			if err != nil {
+				return err
+			}
+
+			return sqlDB.PingContext(ctx)
+		},
+	}
+}
+
+// MigrationsCurrent is a PreflightCheck failing while m has migrations which
+// have not been applied.
+func MigrationsCurrent(m *Migrator) PreflightCheck {
+	return PreflightCheck{
+		Name:     "migrations",
+		Required: true,
+		Check: func(ctx context.Context) error {
+			statuses, err := m.Status(ctx)
+			if err != nil {
+				return err
+			}
+
+			var pending []string
+			for _, status := range statuses {
+				if !status.Applied {
+					pending = append(pending, status.Version)
+				}
+			}
+
+			if len(pending) > 0 {
+				return fmt.Errorf("pending migrations: %s", strings.Join(pending, ", "))
+			}
+
+			return nil
+		},
+	}
+}
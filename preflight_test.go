@@ -0,0 +1,158 @@
+package cservice
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crockerio/cservice/cservicetest"
+)
+
+func TestRunPreflight(t *testing.T) {
+	down := errors.New("connection refused")
+
+	type check struct {
+		name     string
+		required bool
+		err      error
+	}
+
+	tests := []struct {
+		name    string
+		policy  PreflightPolicy
+		checks  []check
+		ran     string
+		wantErr string
+	}{
+		{
+			name:   "all pass",
+			policy: PreflightFailFast,
+			checks: []check{{"db", true, nil}, {"cache", false, nil}},
+			ran:    "db,cache",
+		},
+		{
+			name:    "fail fast stops at an optional failure",
+			policy:  PreflightFailFast,
+			checks:  []check{{"cache", false, down}, {"db", true, nil}},
+			ran:     "cache",
+			wantErr: "cservice: preflight check cache failed: connection refused",
+		},
+		{
+			name:   "degrade starts without optional checks",
+			policy: PreflightDegrade,
+			checks: []check{{"cache", false, down}, {"db", true, nil}, {"search", false, down}},
+			ran:    "cache,db,search",
+		},
+		{
+			name:    "degrade runs every check before failing on required ones",
+			policy:  PreflightDegrade,
+			checks:  []check{{"db", true, down}, {"cache", false, down}, {"queue", true, down}},
+			ran:     "db,cache,queue",
+			wantErr: "cservice: required preflight checks failed: db, queue",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ran []string
+			var checks []PreflightCheck
+			for _, c := range tt.checks {
+				c := c
+				checks = append(checks, PreflightCheck{
+					Name:     c.name,
+					Required: c.required,
+					Check: func(ctx context.Context) error {
+						ran = append(ran, c.name)
+						return c.err
+					},
+				})
+			}
+
+			var w bufferWriter
+			results, err := RunPreflight(context.Background(), PreflightConfig{Checks: checks, Policy: tt.policy, Writer: &w})
+
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("got %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Errorf("got %v, want %s", err, tt.wantErr)
+			}
+			if strings.Join(ran, ",") != tt.ran {
+				t.Errorf("ran %v, want %s", ran, tt.ran)
+			}
+			if len(results) != len(ran) {
+				t.Fatalf("got %d results for %d checks run", len(results), len(ran))
+			}
+			for i, result := range results {
+				if result.Name != tt.checks[i].name || result.Err != tt.checks[i].err {
+					t.Errorf("result %d: got %+v", i, result)
+				}
+			}
+			if lines := strings.Count(w.String(), "[preflight] "); lines != len(ran) {
+				t.Errorf("logged %d lines:\n%s", lines, w.String())
+			}
+		})
+	}
+}
+
+func TestRunPreflightTimeout(t *testing.T) {
+	var w bufferWriter
+	slow := PreflightCheck{Name: "slow", Check: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}
+
+	start := time.Now()
+	_, err := RunPreflight(context.Background(), PreflightConfig{Checks: []PreflightCheck{slow}, Timeout: 10 * time.Millisecond, Writer: &w})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("check ran for %s", elapsed)
+	}
+}
+
+func TestMigrationsCurrent(t *testing.T) {
+	conn := cservicetest.OpenDB(t)
+	m, err := NewMigrator(conn,
+		SQLMigration("001_create_widgets", "CREATE TABLE widgets (id INTEGER PRIMARY KEY)", "DROP TABLE widgets"),
+		SQLMigration("002_create_parts", "CREATE TABLE parts (id INTEGER PRIMARY KEY)", "DROP TABLE parts"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	check := MigrationsCurrent(m)
+
+	if err := m.Up(ctx, "001_create_widgets"); err != nil {
+		t.Fatal(err)
+	}
+	if err := check.Check(ctx); err == nil || err.Error() != "pending migrations: 002_create_parts" {
+		t.Errorf("with a pending migration: got %v", err)
+	}
+
+	if err := m.Up(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := check.Check(ctx); err != nil {
+		t.Errorf("after migrating: got %v", err)
+	}
+}
+
+func TestDatabaseReachable(t *testing.T) {
+	saved := db
+	t.Cleanup(func() { db = saved })
+
+	db = nil
+	if err := DatabaseReachable().Check(context.Background()); !errors.Is(err, ErrDatabaseNotInitialised) {
+		t.Errorf("before InitDatabase: got %v", err)
+	}
+
+	db = cservicetest.OpenDB(t)
+	if err := DatabaseReachable().Check(context.Background()); err != nil {
+		t.Errorf("got %v", err)
+	}
+}
@@ -0,0 +1,273 @@
+package cservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// QueryOptions narrows and orders the records returned by Repository.List.
+type QueryOptions struct {
+	// Filters are equality conditions keyed by column name.
+	Filters map[string]interface{}
+
+	// Scopes are applied to the query in order, for conditions Filters
+	// cannot express.
+	Scopes []func(*gorm.DB) *gorm.DB
+
+	// Order is the ORDER BY clause, e.g. "created_at desc".
+	Order string
+
+	// Limit caps the number of records returned. Zero means no limit.
+	Limit int
+
+	// Offset skips this many records.
+	Offset int
+
+	// Preload lists the associations to eager-load.
+	Preload []string
+}
+
+// Policy restricts the rows a repository can see, e.g. to those owned by the
+// user stored in ctx.
+type Policy func(ctx context.Context, tx *gorm.DB) *gorm.DB
+
+// Repository wraps common GORM operations on models of type T.
+type Repository[T any] struct {
+	db       *gorm.DB
+	cache    Cache
+	ttl      time.Duration
+	policies []Policy
+}
+
+// NewRepository creates a Repository for T backed by db.
+func NewRepository[T any](db *gorm.DB) *Repository[T] {
+	return &Repository[T]{db: db}
+}
+
+// WithCache returns a copy of the repository which caches FindByID results in
+// cache for ttl. Cached records are invalidated when they are updated or
+// deleted through the repository.
+func (r *Repository[T]) WithCache(cache Cache, ttl time.Duration) *Repository[T] {
+	return &Repository[T]{db: r.db, cache: cache, ttl: ttl, policies: r.policies}
+}
+
+// WithPolicy returns a copy of the repository which applies policies to
+// every query except Create. Records outside the policies are reported as
+// gorm.ErrRecordNotFound. The cache is bypassed while policies are set, as
+// cached records are shared between callers.
+func (r *Repository[T]) WithPolicy(policies ...Policy) *Repository[T] {
+	return &Repository[T]{
+		db:       r.db,
+		cache:    r.cache,
+		ttl:      r.ttl,
+		policies: append(append([]Policy(nil), r.policies...), policies...),
+	}
+}
+
+// DB returns the database the repository runs queries on.
+func (r *Repository[T]) DB() *gorm.DB {
+	return r.db
+}
+
+// FindByID returns the record with the given primary key, or
+// gorm.ErrRecordNotFound.
+func (r *Repository[T]) FindByID(ctx context.Context, id interface{}) (*T, error) {
+	if r.cached() {
+		if cached, ok := r.cache.Get(ctx, r.cacheKey(id)); ok {
+			// Hand out a copy so callers cannot modify the cached record.
+			model := cached.(T)
+			return &model, nil
+		}
+	}
+
+	condition, _, err := r.primaryKey(id)
+	if err != nil {
+		return nil, err
+	}
+
+	model := new(T)
+	if err := r.scoped(ctx).Where(condition).First(model).Error; err != nil {
+		return nil, err
+	}
+
+	if r.cached() {
+		r.cache.Set(ctx, r.cacheKey(id), *model, r.ttl)
+	}
+
+	return model, nil
+}
+
+// List returns the records matching options.
+func (r *Repository[T]) List(ctx context.Context, options QueryOptions) ([]T, error) {
+	tx := r.scoped(ctx).Model(new(T))
+
+	if len(options.Filters) > 0 {
+		tx = tx.Where(options.Filters)
+	}
+
+	tx = tx.Scopes(options.Scopes...)
+
+	if options.Order != "" {
+		tx = tx.Order(options.Order)
+	}
+
+	if options.Limit > 0 {
+		tx = tx.Limit(options.Limit)
+	}
+
+	if options.Offset > 0 {
+		tx = tx.Offset(options.Offset)
+	}
+
+	for _, association := range options.Preload {
+		tx = tx.Preload(association)
+	}
+
+	var models []T
+	if err := tx.Find(&models).Error; err != nil {
+		return nil, err
+	}
+
+	return models, nil
+}
+
+// Create inserts model.
+func (r *Repository[T]) Create(ctx context.Context, model *T) error {
+	return r.db.WithContext(ctx).Create(model).Error
+}
+
+// Update saves every field of model, returning gorm.ErrRecordNotFound if
+// there is no record with its primary key.
+func (r *Repository[T]) Update(ctx context.Context, model *T) error {
+	if err := r.updateScoped(ctx, model); err != nil {
+		return err
+	}
+
+	r.invalidate(ctx, model)
+	return nil
+}
+
+// Delete removes the record with the given primary key, returning
+// gorm.ErrRecordNotFound if there is none.
+func (r *Repository[T]) Delete(ctx context.Context, id interface{}) error {
+	condition, _, err := r.primaryKey(id)
+	if err != nil {
+		return err
+	}
+
+	result := r.scoped(ctx).Where(condition).Delete(new(T))
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if r.cache != nil {
+		r.cache.Delete(ctx, r.cacheKey(id))
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Exists reports whether a record with the given primary key exists.
+func (r *Repository[T]) Exists(ctx context.Context, id interface{}) (bool, error) {
+	condition, _, err := r.primaryKey(id)
+	if err != nil {
+		return false, err
+	}
+
+	var count int64
+	if err := r.scoped(ctx).Model(new(T)).Where(condition).Count(&count).Error; err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// updateScoped saves every field of model if it exists and is visible
+// under the repository's policies. Save is avoided as it inserts records it
+// cannot find.
+func (r *Repository[T]) updateScoped(ctx context.Context, model *T) error {
+	_, field, err := r.primaryKey(nil)
+	if err != nil {
+		return err
+	}
+
+	id, zero := field.ValueOf(reflect.ValueOf(model).Elem())
+	if zero {
+		return gorm.ErrRecordNotFound
+	}
+
+	exists, err := r.Exists(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return gorm.ErrRecordNotFound
+	}
+
+	return r.scoped(ctx).Model(model).Select("*").Updates(model).Error
+}
+
+// scoped returns a session bound to ctx with the repository's policies
+// applied.
+func (r *Repository[T]) scoped(ctx context.Context) *gorm.DB {
+	tx := r.db.WithContext(ctx)
+	for _, policy := range r.policies {
+		tx = policy(ctx, tx)
+	}
+	return tx
+}
+
+// cached reports whether FindByID reads through the cache.
+func (r *Repository[T]) cached() bool {
+	return r.cache != nil && len(r.policies) == 0
+}
+
+// primaryKey builds the WHERE condition matching id against T's primary key,
+// and returns the primary key field. Building the condition explicitly keeps
+// string IDs from being treated as SQL.
+func (r *Repository[T]) primaryKey(id interface{}) (clause.Expression, *schema.Field, error) {
+	stmt := &gorm.Statement{DB: r.db}
+	if err := stmt.Parse(new(T)); err != nil {
+		return nil, nil, err
+	}
+
+	field := stmt.Schema.PrioritizedPrimaryField
+	if field == nil {
+		return nil, nil, errors.New("cservice: model " + stmt.Schema.Name + " has no primary key")
+	}
+
+	condition := clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: id}
+	return condition, field, nil
+}
+
+// cacheKey returns the cache key of the record with the given primary key.
+func (r *Repository[T]) cacheKey(id interface{}) string {
+	return fmt.Sprintf("cservice:%T:%v", *new(T), id)
+}
+
+// invalidate removes model from the cache.
+func (r *Repository[T]) invalidate(ctx context.Context, model *T) {
+	if r.cache == nil {
+		return
+	}
+
+	_, field, err := r.primaryKey(nil)
+	if err != nil {
+		return
+	}
+
+	if id, zero := field.ValueOf(reflect.ValueOf(model).Elem()); !zero {
+		r.cache.Delete(ctx, r.cacheKey(id))
+	}
+}
@@ -0,0 +1,131 @@
+package cservice
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/crockerio/cservice/cservicetest"
+	"gorm.io/gorm"
+)
+
+type repoWidget struct {
+	ID    uint
+	Owner string
+	Name  string
+}
+
+type ownerKey struct{}
+
+func ownedBy(ctx context.Context, tx *gorm.DB) *gorm.DB {
+	return tx.Where("owner = ?", ctx.Value(ownerKey{}))
+}
+
+func TestRepositoryCRUD(t *testing.T) {
+	ctx := context.Background()
+	conn := cservicetest.OpenDB(t, &repoWidget{})
+	repo := NewRepository[repoWidget](conn)
+
+	for _, name := range []string{"b", "a", "c"} {
+		if err := repo.Create(ctx, &repoWidget{Owner: "alice", Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	widgets, err := repo.List(ctx, QueryOptions{Order: "name", Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(widgets) != 2 || widgets[0].Name != "a" || widgets[1].Name != "b" {
+		t.Fatalf("got %+v", widgets)
+	}
+
+	widget := widgets[0]
+	widget.Name = "renamed"
+	if err := repo.Update(ctx, &widget); err != nil {
+		t.Fatal(err)
+	}
+	found, err := repo.FindByID(ctx, widget.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.Name != "renamed" {
+		t.Errorf("got name %q after update", found.Name)
+	}
+
+	if err := repo.Delete(ctx, widget.ID); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := repo.Exists(ctx, widget.ID); err != nil || exists {
+		t.Errorf("deleted record: exists %v, err %v", exists, err)
+	}
+	if err := repo.Delete(ctx, widget.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("deleting twice: got %v", err)
+	}
+}
+
+func TestRepositoryUpdateMissing(t *testing.T) {
+	ctx := context.Background()
+	conn := cservicetest.OpenDB(t, &repoWidget{})
+
+	tests := []struct {
+		name string
+		repo *Repository[repoWidget]
+	}{
+		{"no policies", NewRepository[repoWidget](conn)},
+		{"with policy", NewRepository[repoWidget](conn).WithPolicy(ownedBy)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.WithValue(ctx, ownerKey{}, "alice")
+			for _, widget := range []*repoWidget{{ID: 42, Owner: "alice"}, {Owner: "alice"}} {
+				if err := tt.repo.Update(ctx, widget); !errors.Is(err, gorm.ErrRecordNotFound) {
+					t.Errorf("update of %+v: got %v, want ErrRecordNotFound", widget, err)
+				}
+			}
+
+			var count int64
+			if err := conn.Model(&repoWidget{}).Count(&count).Error; err != nil {
+				t.Fatal(err)
+			}
+			if count != 0 {
+				t.Errorf("update inserted %d records", count)
+			}
+		})
+	}
+}
+
+func TestRepositoryPolicy(t *testing.T) {
+	conn := cservicetest.OpenDB(t, &repoWidget{})
+	repo := NewRepository[repoWidget](conn).WithPolicy(ownedBy)
+
+	alice := context.WithValue(context.Background(), ownerKey{}, "alice")
+	bob := context.WithValue(context.Background(), ownerKey{}, "bob")
+
+	widget := &repoWidget{Owner: "alice", Name: "sprocket"}
+	if err := repo.Create(alice, widget); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := repo.FindByID(bob, widget.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("find by another owner: got %v", err)
+	}
+	if widgets, err := repo.List(bob, QueryOptions{}); err != nil || len(widgets) != 0 {
+		t.Errorf("list by another owner: got %+v, %v", widgets, err)
+	}
+	if err := repo.Update(bob, &repoWidget{ID: widget.ID, Owner: "bob", Name: "stolen"}); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("update by another owner: got %v", err)
+	}
+	if err := repo.Delete(bob, widget.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("delete by another owner: got %v", err)
+	}
+
+	found, err := repo.FindByID(alice, widget.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.Name != "sprocket" || found.Owner != "alice" {
+		t.Errorf("record changed by another owner: %+v", found)
+	}
+}
@@ -0,0 +1,198 @@
+package cservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RetentionPolicy keeps soft-deleted rows of a model for a period before
+// they are purged.
+type RetentionPolicy struct {
+	// Model is a pointer to a model with a gorm.DeletedAt field.
+	Model interface{}
+
+	// Retention is how long rows are kept after being soft-deleted.
+	Retention time.Duration
+}
+
+// RetentionConfig defines how soft-deleted rows are purged.
+type RetentionConfig struct {
+	Policies []RetentionPolicy
+
+	// Interval between purges. Defaults to an hour.
+	Interval time.Duration
+
+	// BatchSize is the number of rows deleted per statement. Defaults to
+	// 1000.
+	BatchSize int
+
+	// OnPurge is called after each purge with the number of rows deleted
+	// from each table, e.g. to record metrics, and any error.
+	OnPurge func(purged map[string]int64, err error)
+
+	// Clock provides the current time. Defaults to SystemClock.
+	Clock Clock
+}
+
+// PurgeExpired permanently deletes soft-deleted rows which have outlived
+// their policy's retention, in batches of batchSize rows. It returns the
+// number of rows deleted from each table. Nothing is deleted if any policy
+// has a Retention which is not positive.
+func PurgeExpired(ctx context.Context, conn *gorm.DB, now time.Time, batchSize int, policies ...RetentionPolicy) (map[string]int64, error) {
+	purged := map[string]int64{}
+
+	for _, policy := range policies {
+		if policy.Retention <= 0 {
+			return purged, fmt.Errorf("cservice: retention for %T must be positive, got %s", policy.Model, policy.Retention)
+		}
+	}
+
+	for _, policy := range policies {
+		stmt := &gorm.Statement{DB: conn}
+		if err := stmt.Parse(policy.Model); err != nil {
+			return purged, err
+		}
+
+		deletedAt := softDeleteField(stmt)
+		primaryKey := stmt.Schema.PrioritizedPrimaryField
+		if deletedAt == "" || primaryKey == nil {
+			return purged, errors.New("cservice: model " + stmt.Schema.Name + " needs a primary key and gorm.DeletedAt field for retention")
+		}
+
+		cutoff := now.Add(-policy.Retention)
+		expired := clause.Lt{Column: clause.Column{Table: clause.CurrentTable, Name: deletedAt}, Value: cutoff}
+
+		for {
+			// Select each batch's keys first, as not every database
+			// supports DELETE with LIMIT.
+			keys := reflect.New(reflect.SliceOf(primaryKey.FieldType))
+			err := conn.WithContext(ctx).Unscoped().Model(policy.Model).
+				Where(expired).
+				Order(clause.OrderByColumn{Column: clause.Column{Table: clause.CurrentTable, Name: primaryKey.DBName}}).
+				Limit(batchSize).
+				Pluck(primaryKey.DBName, keys.Interface()).Error
+			if err != nil {
+				return purged, err
+			}
+
+			ids := make([]interface{}, keys.Elem().Len())
+			for i := range ids {
+				ids[i] = keys.Elem().Index(i).Interface()
+			}
+
+			if len(ids) == 0 {
+				break
+			}
+
+			result := conn.WithContext(ctx).Unscoped().
+				Where(clause.IN{Column: clause.Column{Table: clause.CurrentTable, Name: primaryKey.DBName}, Values: ids}).
+				Delete(policy.Model)
+			if result.Error != nil {
+				return purged, result.Error
+			}
+
+			purged[stmt.Schema.Table] += result.RowsAffected
+
+			if len(ids) < batchSize {
+				break
+			}
+		}
+	}
+
+	return purged, nil
+}
+
+// softDeleteField returns the column of the model's gorm.DeletedAt field.
+func softDeleteField(stmt *gorm.Statement) string {
+	deletedAtType := reflect.TypeOf(gorm.DeletedAt{})
+	for _, field := range stmt.Schema.Fields {
+		if field.FieldType == deletedAtType && field.DBName != "" {
+			return field.DBName
+		}
+	}
+	return ""
+}
+
+// RetentionPurger purges expired soft-deleted rows in the background.
+type RetentionPurger struct {
+	conn   *gorm.DB
+	config RetentionConfig
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// StartRetentionPurger starts purging the database opened by InitDatabase.
+func StartRetentionPurger(config RetentionConfig) (*RetentionPurger, error) {
+	if db == nil {
+		return nil, ErrDatabaseNotInitialised
+	}
+
+	return NewRetentionPurger(db, config), nil
+}
+
+// NewRetentionPurger starts purging conn on config.Interval.
+func NewRetentionPurger(conn *gorm.DB, config RetentionConfig) *RetentionPurger {
+	if config.Interval <= 0 {
+		config.Interval = time.Hour
+	}
+
+	if config.BatchSize <= 0 {
+		config.BatchSize = 1000
+	}
+
+	p := &RetentionPurger{
+		conn:   conn,
+		config: config,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	go p.run()
+
+	return p
+}
+
+// Stop stops purging, waiting for a purge in progress to be cancelled. It
+// is safe to call more than once.
+func (p *RetentionPurger) Stop() {
+	p.stopOnce.Do(func() { close(p.stop) })
+	<-p.done
+}
+
+func (p *RetentionPurger) run() {
+	defer close(p.done)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-p.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-time.After(p.config.Interval):
+		}
+
+		now := clockOrSystem(p.config.Clock).Now()
+		purged, err := PurgeExpired(ctx, p.conn, now, p.config.BatchSize, p.config.Policies...)
+		if p.config.OnPurge != nil {
+			p.config.OnPurge(purged, err)
+		}
+	}
+}
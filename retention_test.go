@@ -0,0 +1,78 @@
+package cservice
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/crockerio/cservice/cservicetest"
+)
+
+type retainedNote struct {
+	ID        uint
+	DeletedAt gorm.DeletedAt
+}
+
+func seedRetainedNotes(t *testing.T, now time.Time) *gorm.DB {
+	db := cservicetest.OpenDB(t, &retainedNote{})
+
+	deleted := []time.Duration{48 * time.Hour, 30 * time.Hour, 25 * time.Hour, time.Hour, 0}
+	for _, age := range deleted {
+		note := retainedNote{}
+		if age > 0 {
+			note.DeletedAt = gorm.DeletedAt{Time: now.Add(-age), Valid: true}
+		}
+		if err := db.Create(&note).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return db
+}
+
+func TestPurgeExpired(t *testing.T) {
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+	db := seedRetainedNotes(t, now)
+
+	purged, err := PurgeExpired(context.Background(), db, now, 2, RetentionPolicy{Model: &retainedNote{}, Retention: 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if purged["retained_notes"] != 3 {
+		t.Errorf("purged %v, want 3 retained_notes", purged)
+	}
+
+	var left []uint
+	db.Unscoped().Model(&retainedNote{}).Order("id").Pluck("id", &left)
+	if len(left) != 2 || left[0] != 4 || left[1] != 5 {
+		t.Errorf("left rows %v, want [4 5]", left)
+	}
+}
+
+func TestPurgeExpiredRejectsNonPositiveRetention(t *testing.T) {
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+	db := seedRetainedNotes(t, now)
+
+	_, err := PurgeExpired(context.Background(), db, now, 100,
+		RetentionPolicy{Model: &retainedNote{}, Retention: 24 * time.Hour},
+		RetentionPolicy{Model: &retainedNote{}},
+	)
+	if err == nil {
+		t.Fatal("expected an error for a zero retention")
+	}
+
+	var count int64
+	db.Unscoped().Model(&retainedNote{}).Count(&count)
+	if count != 5 {
+		t.Errorf("%d rows left, want all 5", count)
+	}
+}
+
+func TestRetentionPurgerStopTwice(t *testing.T) {
+	p := NewRetentionPurger(cservicetest.OpenDB(t), RetentionConfig{})
+	p.Stop()
+	p.Stop()
+}
@@ -0,0 +1,153 @@
+package cservice
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// TriggerOptions defines a trigger.
+type TriggerOptions struct {
+	// Name of the trigger.
+	Name string
+
+	// Table the trigger is attached to.
+	Table string
+
+	// Timing is BEFORE or AFTER.
+	Timing string
+
+	// Event is INSERT, UPDATE or DELETE.
+	Event string
+
+	// Body is the statement run for each row, e.g.
+	// "SET NEW.updated = 1" or a BEGIN ... END block.
+	Body string
+}
+
+// BuildTrigger returns the CREATE TRIGGER statement for options.
+func BuildTrigger(options TriggerOptions) (string, error) {
+	if err := validateIdentifier("trigger", options.Name); err != nil {
+		return "", err
+	}
+
+	if err := validateIdentifier("table", options.Table); err != nil {
+		return "", err
+	}
+
+	timing := strings.ToUpper(options.Timing)
+	if timing != "BEFORE" && timing != "AFTER" {
+		return "", fmt.Errorf("cservice: invalid trigger timing %q", options.Timing)
+	}
+
+	event := strings.ToUpper(options.Event)
+	switch event {
+	case "INSERT", "UPDATE", "DELETE":
+	default:
+		return "", fmt.Errorf("cservice: invalid trigger event %q", options.Event)
+	}
+
+	body := strings.TrimSpace(options.Body)
+	if body == "" {
+		return "", fmt.Errorf("cservice: trigger %s has no body", options.Name)
+	}
+
+	return fmt.Sprintf("CREATE TRIGGER %s %s %s ON %s FOR EACH ROW %s",
+		quoteIdentifier(options.Name), timing, event, quoteIdentifier(options.Table), body), nil
+}
+
+// TriggerMigration returns a Migration creating the trigger on Up and dropping
+// it on Down.
+func TriggerMigration(version string, options TriggerOptions) Migration {
+	return Migration{
+		Version: version,
+		Up: func(tx *gorm.DB) error {
+			statement, err := BuildTrigger(options)
+			if err != nil {
+				return err
+			}
+			return tx.Exec(statement).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := validateIdentifier("trigger", options.Name); err != nil {
+				return err
+			}
+			return tx.Exec("DROP TRIGGER IF EXISTS " + quoteIdentifier(options.Name)).Error
+		},
+	}
+}
+
+var parameterTypePattern = regexp.MustCompile(`^(?i)[a-z]+(\s*\(\s*\d+\s*(,\s*\d+\s*)?\))?(\s+unsigned)?$`)
+
+// ProcedureParam is a stored procedure parameter.
+type ProcedureParam struct {
+	// Mode is IN, OUT or INOUT. Defaults to IN.
+	Mode string
+
+	// Name of the parameter.
+	Name string
+
+	// Type is the SQL type, e.g. "INT" or "VARCHAR(255)".
+	Type string
+}
+
+// BuildProcedure returns the CREATE PROCEDURE statement for a procedure named
+// name running body, which is wrapped in BEGIN ... END.
+func BuildProcedure(name string, params []ProcedureParam, body string) (string, error) {
+	if err := validateIdentifier("procedure", name); err != nil {
+		return "", err
+	}
+
+	declarations := make([]string, 0, len(params))
+	for _, param := range params {
+		mode := strings.ToUpper(param.Mode)
+		switch mode {
+		case "":
+			mode = "IN"
+		case "IN", "OUT", "INOUT":
+		default:
+			return "", fmt.Errorf("cservice: invalid parameter mode %q", param.Mode)
+		}
+
+		if err := validateIdentifier("parameter", param.Name); err != nil {
+			return "", err
+		}
+
+		if !parameterTypePattern.MatchString(param.Type) {
+			return "", fmt.Errorf("cservice: invalid parameter type %q", param.Type)
+		}
+
+		declarations = append(declarations, mode+" "+quoteIdentifier(param.Name)+" "+param.Type)
+	}
+
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return "", fmt.Errorf("cservice: procedure %s has no body", name)
+	}
+
+	return fmt.Sprintf("CREATE PROCEDURE %s(%s) BEGIN %s END",
+		quoteIdentifier(name), strings.Join(declarations, ", "), body), nil
+}
+
+// ProcedureMigration returns a Migration creating the procedure on Up and
+// dropping it on Down.
+func ProcedureMigration(version, name string, params []ProcedureParam, body string) Migration {
+	return Migration{
+		Version: version,
+		Up: func(tx *gorm.DB) error {
+			statement, err := BuildProcedure(name, params, body)
+			if err != nil {
+				return err
+			}
+			return tx.Exec(statement).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := validateIdentifier("procedure", name); err != nil {
+				return err
+			}
+			return tx.Exec("DROP PROCEDURE IF EXISTS " + quoteIdentifier(name)).Error
+		},
+	}
+}
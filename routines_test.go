@@ -0,0 +1,111 @@
+package cservice
+
+import (
+	"context"
+	"testing"
+
+	"github.com/crockerio/cservice/cservicetest"
+)
+
+func TestBuildTrigger(t *testing.T) {
+	got, err := BuildTrigger(TriggerOptions{Name: "users_touch", Table: "users", Timing: "before", Event: "update", Body: " SET NEW.updated = 1 "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "CREATE TRIGGER `users_touch` BEFORE UPDATE ON `users` FOR EACH ROW SET NEW.updated = 1"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	valid := TriggerOptions{Name: "t", Table: "users", Timing: "AFTER", Event: "INSERT", Body: "SET @x = 1"}
+	invalid := map[string]func(*TriggerOptions){
+		"name":   func(o *TriggerOptions) { o.Name = "t; DROP" },
+		"table":  func(o *TriggerOptions) { o.Table = "" },
+		"timing": func(o *TriggerOptions) { o.Timing = "INSTEAD OF" },
+		"event":  func(o *TriggerOptions) { o.Event = "TRUNCATE" },
+		"body":   func(o *TriggerOptions) { o.Body = " " },
+	}
+
+	for name, change := range invalid {
+		options := valid
+		change(&options)
+		if got, err := BuildTrigger(options); err == nil {
+			t.Errorf("invalid %s: got %q, want an error", name, got)
+		}
+	}
+}
+
+func TestBuildProcedure(t *testing.T) {
+	params := []ProcedureParam{
+		{Name: "user_id", Type: "INT unsigned"},
+		{Mode: "out", Name: "total", Type: "DECIMAL(10, 2)"},
+	}
+
+	got, err := BuildProcedure("user_total", params, "SELECT SUM(amount) INTO total FROM orders WHERE user = user_id;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "CREATE PROCEDURE `user_total`(IN `user_id` INT unsigned, OUT `total` DECIMAL(10, 2)) BEGIN SELECT SUM(amount) INTO total FROM orders WHERE user = user_id; END"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	invalid := map[string][]ProcedureParam{
+		"mode": {{Mode: "BOTH", Name: "a", Type: "INT"}},
+		"name": {{Name: "a b", Type: "INT"}},
+		"type": {{Name: "a", Type: "INT); DROP TABLE users; --"}},
+	}
+	for name, params := range invalid {
+		if got, err := BuildProcedure("p", params, "SELECT 1;"); err == nil {
+			t.Errorf("invalid %s: got %q, want an error", name, got)
+		}
+	}
+
+	if _, err := BuildProcedure("p", nil, ""); err == nil {
+		t.Error("empty body was accepted")
+	}
+}
+
+func TestTriggerMigration(t *testing.T) {
+	conn := cservicetest.OpenDB(t)
+	for _, statement := range []string{
+		"CREATE TABLE users (id INTEGER PRIMARY KEY)",
+		"CREATE TABLE audit (user_id INTEGER)",
+	} {
+		if err := conn.Exec(statement).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, err := NewMigrator(conn, TriggerMigration("001_audit_users", TriggerOptions{
+		Name:   "users_audit",
+		Table:  "users",
+		Timing: "AFTER",
+		Event:  "INSERT",
+		Body:   "BEGIN INSERT INTO audit (user_id) VALUES (NEW.id); END",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if err := m.Up(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	conn.Exec("INSERT INTO users (id) VALUES (7)")
+	var audited int64
+	conn.Raw("SELECT COUNT(*) FROM audit WHERE user_id = 7").Scan(&audited)
+	if audited != 1 {
+		t.Errorf("trigger recorded %d rows, want 1", audited)
+	}
+
+	if err := m.Down(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	conn.Exec("INSERT INTO users (id) VALUES (8)")
+	conn.Raw("SELECT COUNT(*) FROM audit").Scan(&audited)
+	if audited != 1 {
+		t.Errorf("trigger still fired after Down: %d rows", audited)
+	}
+}
@@ -0,0 +1,240 @@
+package cservice
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Workflow statuses.
+const (
+	WorkflowRunning      = "running"
+	WorkflowCompleted    = "completed"
+	WorkflowCompensating = "compensating"
+	WorkflowCompensated  = "compensated"
+	WorkflowFailed       = "failed"
+)
+
+// Workflow is the persisted state of a saga. Add it to DatabaseConfig.Models
+// to create its table.
+type Workflow struct {
+	ID     string `gorm:"primaryKey;size:36"`
+	Saga   string `gorm:"size:191;index"`
+	Status string `gorm:"size:16;index"`
+
+	// Step is the number of steps completed and not yet compensated.
+	Step int
+
+	// Data is the saga's state, encoded as JSON.
+	Data string `gorm:"type:text"`
+
+	// Error is the error which caused compensation or failure.
+	Error string `gorm:"type:text"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// SagaStep is one step of a saga. Steps may run more than once if the
+// service stops between a step finishing and its progress being saved, so
+// actions and compensations should be idempotent.
+type SagaStep[T any] struct {
+	Name string
+
+	// Action performs the step, updating data as needed.
+	Action func(ctx context.Context, data *T) error
+
+	// Compensate undoes the step after a later step fails. It may be nil
+	// for steps with nothing to undo.
+	Compensate func(ctx context.Context, data *T) error
+}
+
+// Saga is a sequence of steps which are compensated in reverse order if one
+// fails. T is the saga's state, which must encode to JSON.
+type Saga[T any] struct {
+	Name  string
+	Steps []SagaStep[T]
+}
+
+// sagaDefinition is a Saga with its state type erased.
+type sagaDefinition interface {
+	run(ctx context.Context, db *gorm.DB, workflow *Workflow) error
+}
+
+// sagaResumeLockTimeout is how long Resume waits for another instance to
+// finish resuming workflows.
+const sagaResumeLockTimeout = time.Minute
+
+// SagaRunner runs registered sagas, persisting their progress so they can be
+// resumed after a restart.
+type SagaRunner struct {
+	db *gorm.DB
+
+	mu    sync.RWMutex
+	sagas map[string]sagaDefinition
+}
+
+// NewSagaRunner creates a SagaRunner storing workflows in db.
+func NewSagaRunner(db *gorm.DB) *SagaRunner {
+	return &SagaRunner{db: db, sagas: map[string]sagaDefinition{}}
+}
+
+// RegisterSaga adds saga to runner.
+func RegisterSaga[T any](runner *SagaRunner, saga Saga[T]) {
+	runner.mu.Lock()
+	defer runner.mu.Unlock()
+
+	runner.sagas[saga.Name] = saga
+}
+
+// StartSaga persists a new workflow for the named saga with the initial data
+// and runs it to completion. The workflow is returned even if a step fails;
+// its Status reports whether it completed or was compensated.
+func StartSaga[T any](ctx context.Context, runner *SagaRunner, name string, data T) (*Workflow, error) {
+	saga, ok := runner.saga(name)
+	if !ok {
+		return nil, fmt.Errorf("cservice: unknown saga %q", name)
+	}
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := NewUUIDv7()
+	if err != nil {
+		return nil, err
+	}
+
+	workflow := &Workflow{ID: id, Saga: name, Status: WorkflowRunning, Data: string(encoded)}
+	if err := runner.db.WithContext(ctx).Create(workflow).Error; err != nil {
+		return nil, err
+	}
+
+	return workflow, saga.run(ctx, runner.db, workflow)
+}
+
+// Resume continues running or compensating workflows which have not been
+// updated for staleAfter, such as those interrupted by a restart. Set
+// staleAfter longer than the slowest step so workflows still running on
+// another instance are left alone. Only one instance resumes at a time. Every
+// workflow is attempted; the first error is returned.
+func (r *SagaRunner) Resume(ctx context.Context, staleAfter time.Duration) error {
+	return WithAdvisoryLock(ctx, r.db, "cservice_saga_resume", sagaResumeLockTimeout, func() error {
+		var workflows []Workflow
+		err := r.db.WithContext(ctx).
+			Where("status IN ? AND updated_at < ?", []string{WorkflowRunning, WorkflowCompensating}, time.Now().Add(-staleAfter)).
+			Order("created_at").
+			Find(&workflows).Error
+		if err != nil {
+			return err
+		}
+
+		var firstErr error
+		for i := range workflows {
+			saga, ok := r.saga(workflows[i].Saga)
+			if !ok {
+				continue
+			}
+
+			if err := saga.run(ctx, r.db, &workflows[i]); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+
+		return firstErr
+	})
+}
+
+// saga returns the saga registered as name.
+func (r *SagaRunner) saga(name string) (sagaDefinition, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	saga, ok := r.sagas[name]
+	return saga, ok
+}
+
+// run advances workflow until it completes, is compensated or fails. It
+// returns an error only if progress could not be saved or a compensation
+// failed; a failing action is recorded in the workflow.
+func (s Saga[T]) run(ctx context.Context, db *gorm.DB, workflow *Workflow) error {
+	var data T
+	if err := json.Unmarshal([]byte(workflow.Data), &data); err != nil {
+		return err
+	}
+
+	save := func() error {
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+
+		workflow.Data = string(encoded)
+		return db.WithContext(ctx).Save(workflow).Error
+	}
+
+	// Work from a copy of the steps so the saga's slice changing while the
+	// workflow runs cannot shift which steps are compensated.
+	steps := append([]SagaStep[T](nil), s.Steps...)
+
+	// A workflow persisted by a longer version of the saga cannot be
+	// advanced or compensated safely.
+	if workflow.Step < 0 || workflow.Step > len(steps) {
+		err := fmt.Errorf("cservice: saga %s has %d steps, workflow %s is at step %d", s.Name, len(steps), workflow.ID, workflow.Step)
+		workflow.Status = WorkflowFailed
+		workflow.Error = err.Error()
+		if saveErr := save(); saveErr != nil {
+			return saveErr
+		}
+		return err
+	}
+
+	for workflow.Status == WorkflowRunning {
+		if workflow.Step >= len(steps) {
+			workflow.Status = WorkflowCompleted
+			return save()
+		}
+
+		if err := steps[workflow.Step].Action(ctx, &data); err != nil {
+			workflow.Status = WorkflowCompensating
+			workflow.Error = fmt.Sprintf("%s: %v", steps[workflow.Step].Name, err)
+		} else {
+			workflow.Step++
+		}
+
+		if err := save(); err != nil {
+			return err
+		}
+	}
+
+	for workflow.Status == WorkflowCompensating {
+		if workflow.Step <= 0 {
+			workflow.Status = WorkflowCompensated
+			return save()
+		}
+
+		step := steps[workflow.Step-1]
+		if step.Compensate != nil {
+			if err := step.Compensate(ctx, &data); err != nil {
+				workflow.Status = WorkflowFailed
+				workflow.Error = fmt.Sprintf("%s; compensating %s: %v", workflow.Error, step.Name, err)
+				if saveErr := save(); saveErr != nil {
+					return saveErr
+				}
+				return fmt.Errorf("cservice: saga %s failed compensating %s: %w", s.Name, step.Name, err)
+			}
+		}
+
+		workflow.Step--
+		if err := save(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,141 @@
+package cservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/crockerio/cservice/cservicetest"
+)
+
+func TestSagaCompensatesInReverse(t *testing.T) {
+	db := cservicetest.OpenDB(t, &Workflow{})
+
+	var calls []string
+	step := func(name string, fail bool) SagaStep[int] {
+		return SagaStep[int]{
+			Name: name,
+			Action: func(ctx context.Context, data *int) error {
+				calls = append(calls, "do "+name)
+				if fail {
+					return errors.New("boom")
+				}
+				return nil
+			},
+			Compensate: func(ctx context.Context, data *int) error {
+				calls = append(calls, "undo "+name)
+				return nil
+			},
+		}
+	}
+
+	runner := NewSagaRunner(db)
+	RegisterSaga(runner, Saga[int]{Name: "order", Steps: []SagaStep[int]{step("a", false), step("b", false), step("c", true)}})
+
+	workflow, err := StartSaga(context.Background(), runner, "order", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if workflow.Status != WorkflowCompensated || workflow.Step != 0 {
+		t.Errorf("got status %s at step %d", workflow.Status, workflow.Step)
+	}
+
+	want := []string{"do a", "do b", "do c", "undo b", "undo a"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("got %v, want %v", calls, want)
+	}
+}
+
+func TestSagaFailsWorkflowBeyondSteps(t *testing.T) {
+	db := cservicetest.OpenDB(t, &Workflow{})
+
+	saga := Saga[int]{Name: "order", Steps: []SagaStep[int]{{
+		Name:   "a",
+		Action: func(ctx context.Context, data *int) error { return nil },
+	}}}
+
+	workflow := &Workflow{ID: "w1", Saga: "order", Status: WorkflowCompensating, Step: 3, Data: "0"}
+	if err := db.Create(workflow).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	err := saga.run(context.Background(), db, workflow)
+	if err == nil || !strings.Contains(err.Error(), "at step 3") {
+		t.Fatalf("got %v", err)
+	}
+
+	var stored Workflow
+	if err := db.First(&stored, "id = ?", "w1").Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != WorkflowFailed {
+		t.Errorf("got status %s, want %s", stored.Status, WorkflowFailed)
+	}
+}
+
+func TestSagaRunnerResume(t *testing.T) {
+	db := cservicetest.OpenDB(t, &Workflow{})
+	runner := NewSagaRunner(db)
+
+	var ran []string
+	RegisterSaga(runner, Saga[string]{Name: "order", Steps: []SagaStep[string]{
+		{Name: "a", Action: func(ctx context.Context, data *string) error { ran = append(ran, "a "+*data); return nil }},
+		{Name: "b", Action: func(ctx context.Context, data *string) error { ran = append(ran, "b "+*data); return nil }},
+	}})
+
+	stale := &Workflow{ID: "stale", Saga: "order", Status: WorkflowRunning, Step: 1, Data: `"w1"`}
+	fresh := &Workflow{ID: "fresh", Saga: "order", Status: WorkflowRunning, Step: 1, Data: `"w2"`}
+	for _, workflow := range []*Workflow{stale, fresh} {
+		if err := db.Create(workflow).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Model(stale).UpdateColumn("updated_at", time.Now().Add(-time.Hour)).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runner.Resume(context.Background(), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(ran, []string{"b w1"}) {
+		t.Errorf("ran %v, want only the stale workflow's remaining step", ran)
+	}
+
+	if err := db.First(stale, "id = ?", "stale").Error; err != nil {
+		t.Fatal(err)
+	}
+	if stale.Status != WorkflowCompleted {
+		t.Errorf("stale workflow is %s", stale.Status)
+	}
+}
+
+func TestSagaRunnerConcurrentRegistration(t *testing.T) {
+	runner := NewSagaRunner(nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			RegisterSaga(runner, Saga[int]{Name: fmt.Sprintf("saga-%d", i)})
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			runner.saga(fmt.Sprintf("saga-%d", i))
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < 10; i++ {
+		if _, ok := runner.saga(fmt.Sprintf("saga-%d", i)); !ok {
+			t.Errorf("saga-%d was not registered", i)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package cservice
+
+import (
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+var (
+	charTypePattern  = regexp.MustCompile(`(?i)^(?:var)?char\((\d+)\)`)
+	enumTypePattern  = regexp.MustCompile(`(?i)^enum\((.*)\)$`)
+	enumValuePattern = regexp.MustCompile(`'((?:[^']|'')*)'`)
+)
+
+// ValidateSchema checks model against the columns declared by its gorm tags,
+// so request validation cannot drift from the table definition: strings must
+// fit size:N or varchar(N) columns, enum columns must hold one of their
+// values unless empty with a default, and not null columns must not be nil.
+// Failures are returned as a *ValidationError.
+func ValidateSchema(db *gorm.DB, model interface{}) error {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return err
+	}
+
+	value := reflect.Indirect(reflect.ValueOf(model))
+
+	var failures []FieldError
+	for _, field := range stmt.Schema.Fields {
+		if field.DBName == "" {
+			continue
+		}
+
+		if message := validateField(field, field.ReflectValueOf(value)); message != "" {
+			failures = append(failures, FieldError{Field: field.DBName, Message: message})
+		}
+	}
+
+	if len(failures) > 0 {
+		return &ValidationError{Fields: failures}
+	}
+
+	return nil
+}
+
+// validateField returns why value is not valid for field, or "".
+func validateField(field *schema.Field, value reflect.Value) string {
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			if field.NotNull && !field.HasDefaultValue {
+				return "is required"
+			}
+			return ""
+		}
+		value = value.Elem()
+	}
+
+	if value.Kind() != reflect.String {
+		return ""
+	}
+	s := value.String()
+
+	size := 0
+	if match := charTypePattern.FindStringSubmatch(string(field.DataType)); match != nil {
+		size, _ = strconv.Atoi(match[1])
+	} else if field.GORMDataType == schema.String {
+		size = field.Size
+	}
+
+	if size > 0 && utf8.RuneCountInString(s) > size {
+		return "must be at most " + strconv.Itoa(size) + " characters"
+	}
+
+	if match := enumTypePattern.FindStringSubmatch(string(field.DataType)); match != nil {
+		// GORM inserts the default in place of a zero value.
+		if s == "" && field.HasDefaultValue {
+			return ""
+		}
+
+		var values []string
+		for _, value := range enumValuePattern.FindAllStringSubmatch(match[1], -1) {
+			values = append(values, strings.ReplaceAll(value[1], "''", "'"))
+			if values[len(values)-1] == s {
+				return ""
+			}
+		}
+		return "must be one of " + strings.Join(values, ", ")
+	}
+
+	return ""
+}
@@ -0,0 +1,44 @@
+package cservice
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/crockerio/cservice/cservicetest"
+)
+
+type validatedAccount struct {
+	ID     uint
+	Name   string  `gorm:"size:5"`
+	Status string  `gorm:"type:enum('active','closed');default:'active'"`
+	Plan   string  `gorm:"type:enum('free','paid')"`
+	Email  *string `gorm:"not null"`
+}
+
+func TestValidateSchema(t *testing.T) {
+	conn := cservicetest.OpenDB(t)
+	email := "a@example.com"
+
+	valid := validatedAccount{Name: "abc", Plan: "free", Email: &email}
+	if err := ValidateSchema(conn, &valid); err != nil {
+		t.Errorf("valid account: %v", err)
+	}
+
+	invalid := validatedAccount{Name: "abcdef", Status: "open"}
+	err := ValidateSchema(conn, &invalid)
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("got %v, want a ValidationError", err)
+	}
+
+	failed := map[string]bool{}
+	for _, field := range validationErr.Fields {
+		failed[field.Field] = true
+	}
+	for _, field := range []string{"name", "status", "plan", "email"} {
+		if !failed[field] {
+			t.Errorf("%s was not reported in %v", field, err)
+		}
+	}
+}
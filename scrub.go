@@ -0,0 +1,159 @@
+package cservice
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// ErrScrubInProduction is returned by Scrub when APP_ENV is production, as
+// scrubbing rewrites data in place.
+var ErrScrubInProduction = errors.New("cservice: refusing to scrub in production")
+
+// Scrubber returns the replacement for value in the row with primary key
+// id. Returning nil stores the column's zero value.
+type Scrubber func(id, value interface{}) interface{}
+
+var (
+	scrubbersMu sync.RWMutex
+	scrubbers   = map[string]Scrubber{
+		"email": func(id, value interface{}) interface{} {
+			return fmt.Sprintf("user-%v@example.invalid", id)
+		},
+		"name": func(id, value interface{}) interface{} {
+			return fmt.Sprintf("User %v", id)
+		},
+		"phone": func(id, value interface{}) interface{} {
+			return fmt.Sprintf("+1555%07d", scrubNumber(id)%10000000)
+		},
+		"address": func(id, value interface{}) interface{} {
+			return fmt.Sprintf("%v Example Street", id)
+		},
+		"ip": func(id, value interface{}) interface{} {
+			// 192.0.2.0/24 is reserved for documentation.
+			return fmt.Sprintf("192.0.2.%d", scrubNumber(id)%254+1)
+		},
+		"text": func(id, value interface{}) interface{} {
+			return "[redacted]"
+		},
+		"hash": func(id, value interface{}) interface{} {
+			sum := sha256.Sum256([]byte(fmt.Sprint(value)))
+			return hex.EncodeToString(sum[:8])
+		},
+		"null": func(id, value interface{}) interface{} {
+			return nil
+		},
+	}
+)
+
+// RegisterScrubber adds a scrubber for the kind used in scrub struct tags,
+// replacing any existing one. The built-in kinds are email, name, phone,
+// address, ip, text, hash and null.
+func RegisterScrubber(kind string, scrubber Scrubber) {
+	scrubbersMu.Lock()
+	defer scrubbersMu.Unlock()
+
+	scrubbers[kind] = scrubber
+}
+
+// Scrub rewrites the columns of each model tagged with scrub:"kind" using the
+// scrubber for that kind, e.g.
+//
+//	Email string `scrub:"email"`
+//
+// Rows are processed in primary key order in batches of batchSize, without
+// running hooks or touching UpdatedAt. Replacements derive from the primary
+// key, so scrubbed data stays unique where the original was. Run it against
+// a copy of production data to produce a safe staging dataset.
+func Scrub(ctx context.Context, db *gorm.DB, batchSize int, models ...interface{}) error {
+	if IsProduction() {
+		return ErrScrubInProduction
+	}
+
+	for _, model := range models {
+		if err := scrubModel(ctx, db, batchSize, model); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// scrubModel scrubs the rows of model matched by scopes.
+func scrubModel(ctx context.Context, db *gorm.DB, batchSize int, model interface{}, scopes ...func(*gorm.DB) *gorm.DB) error {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return err
+	}
+
+	scrubbersMu.RLock()
+	fields := map[*schema.Field]Scrubber{}
+	var columns []string
+	for _, field := range stmt.Schema.Fields {
+		kind := field.Tag.Get("scrub")
+		if kind == "" || field.DBName == "" {
+			continue
+		}
+
+		scrubber, ok := scrubbers[kind]
+		if !ok {
+			scrubbersMu.RUnlock()
+			return fmt.Errorf("cservice: unknown scrub kind %q on %s.%s", kind, stmt.Schema.Name, field.Name)
+		}
+
+		fields[field] = scrubber
+		columns = append(columns, field.DBName)
+	}
+	scrubbersMu.RUnlock()
+
+	if len(fields) == 0 {
+		return nil
+	}
+
+	primaryKey := stmt.Schema.PrioritizedPrimaryField
+	if primaryKey == nil {
+		return errors.New("cservice: model " + stmt.Schema.Name + " has no primary key")
+	}
+
+	rows := reflect.New(reflect.SliceOf(stmt.Schema.ModelType))
+
+	// Soft-deleted rows hold personal data too, so both the batches and the
+	// updates are unscoped.
+	return db.WithContext(ctx).Unscoped().Model(model).Scopes(scopes...).FindInBatches(rows.Interface(), batchSize, func(tx *gorm.DB, batch int) error {
+		for i := 0; i < rows.Elem().Len(); i++ {
+			row := rows.Elem().Index(i)
+			id, _ := primaryKey.ValueOf(row)
+
+			for field, scrubber := range fields {
+				value, _ := field.ValueOf(row)
+				if err := field.Set(row, scrubber(id, value)); err != nil {
+					return err
+				}
+			}
+
+			err := db.WithContext(ctx).Unscoped().Model(row.Addr().Interface()).Select(columns).UpdateColumns(row.Addr().Interface()).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}).Error
+}
+
+// scrubNumber derives a stable non-negative number from a primary key.
+func scrubNumber(id interface{}) uint64 {
+	sum := sha256.Sum256([]byte(fmt.Sprint(id)))
+	var n uint64
+	for _, b := range sum[:8] {
+		n = n<<8 | uint64(b)
+	}
+	return n
+}
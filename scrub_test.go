@@ -0,0 +1,78 @@
+package cservice
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/crockerio/cservice/cservicetest"
+	"gorm.io/gorm"
+)
+
+type scrubbedUser struct {
+	ID        uint
+	Email     string `scrub:"email"`
+	Name      string `scrub:"name"`
+	Plan      string
+	DeletedAt gorm.DeletedAt
+}
+
+func TestScrub(t *testing.T) {
+	t.Setenv("APP_ENV", "dev")
+	db := cservicetest.OpenDB(t, &scrubbedUser{})
+
+	users := []scrubbedUser{
+		{Email: "ann@example.com", Name: "Ann", Plan: "pro"},
+		{Email: "bob@example.com", Name: "Bob", Plan: "free"},
+		{Email: "cat@example.com", Name: "Cat", Plan: "pro"},
+	}
+	if err := db.Create(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete(&users[1]).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Scrub(context.Background(), db, 2, &scrubbedUser{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var scrubbed []scrubbedUser
+	if err := db.Unscoped().Order("id").Find(&scrubbed).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(scrubbed) != len(users) || !scrubbed[1].DeletedAt.Valid {
+		t.Fatalf("got %+v", scrubbed)
+	}
+
+	for i, user := range scrubbed {
+		want := scrubbedUser{ID: users[i].ID, Plan: users[i].Plan, DeletedAt: user.DeletedAt}
+		want.Email = scrubbers["email"](user.ID, nil).(string)
+		want.Name = scrubbers["name"](user.ID, nil).(string)
+		if user != want {
+			t.Errorf("got %+v, want %+v", user, want)
+		}
+	}
+}
+
+func TestScrubRefusesProduction(t *testing.T) {
+	t.Setenv("APP_ENV", "production")
+
+	err := Scrub(context.Background(), cservicetest.OpenDB(t), 100, &scrubbedUser{})
+	if !errors.Is(err, ErrScrubInProduction) {
+		t.Errorf("got %v, want ErrScrubInProduction", err)
+	}
+}
+
+func TestScrubUnknownKind(t *testing.T) {
+	type model struct {
+		ID   uint
+		Name string `scrub:"nope"`
+	}
+
+	t.Setenv("APP_ENV", "dev")
+	db := cservicetest.OpenDB(t, &model{})
+	if err := Scrub(context.Background(), db, 100, &model{}); err == nil {
+		t.Error("expected an error for an unknown scrub kind")
+	}
+}
@@ -0,0 +1,59 @@
+package cservice
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Search returns a query over model matching query against columns. On MySQL
+// it uses MATCH ... AGAINST, which needs a FULLTEXT index covering exactly
+// the given columns (e.g. the tag `gorm:"index:idx_search,class:FULLTEXT"`);
+// other databases fall back to a LIKE on each column. Columns must be columns
+// of model, so they may safely come from request parameters.
+func Search(db *gorm.DB, model interface{}, query string, columns ...string) *gorm.DB {
+	tx := db.Model(model)
+
+	if len(columns) == 0 {
+		tx.AddError(gorm.ErrInvalidField)
+		return tx
+	}
+
+	if err := tx.Statement.Parse(model); err != nil {
+		tx.AddError(err)
+		return tx
+	}
+
+	quoted := make([]string, 0, len(columns))
+	for _, column := range columns {
+		if err := validateIdentifier("column", column); err != nil {
+			tx.AddError(err)
+			return tx
+		}
+		if _, ok := tx.Statement.Schema.FieldsByDBName[column]; !ok {
+			tx.AddError(fmt.Errorf("cservice: unknown search column %q", column))
+			return tx
+		}
+		quoted = append(quoted, tx.Statement.Quote(column))
+	}
+
+	if db.Dialector.Name() == "mysql" {
+		return tx.Where("MATCH("+strings.Join(quoted, ", ")+") AGAINST (? IN NATURAL LANGUAGE MODE)", query)
+	}
+
+	pattern := "%" + escapeLike(query) + "%"
+	conditions := make([]string, 0, len(columns))
+	args := make([]interface{}, 0, len(columns))
+	for _, column := range quoted {
+		conditions = append(conditions, column+` LIKE ? ESCAPE '\'`)
+		args = append(args, pattern)
+	}
+
+	return tx.Where(strings.Join(conditions, " OR "), args...)
+}
+
+// escapeLike escapes LIKE wildcards in s.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
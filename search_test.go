@@ -0,0 +1,91 @@
+package cservice
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/crockerio/cservice/cservicetest"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+type searchArticle struct {
+	ID    uint
+	Title string
+	Body  string
+}
+
+func TestSearch(t *testing.T) {
+	conn := cservicetest.OpenDB(t, &searchArticle{})
+	articles := []searchArticle{
+		{Title: "Go generics", Body: "type parameters"},
+		{Title: "SQL", Body: "100% indexed"},
+		{Title: "Snake", Body: "under_score"},
+	}
+	if err := conn.Create(&articles).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query   string
+		columns []string
+		want    []string
+	}{
+		{"generics", []string{"title"}, []string{"Go generics"}},
+		{"PARAM", []string{"title", "body"}, []string{"Go generics"}},
+		{"%", []string{"body"}, []string{"SQL"}},
+		{"_", []string{"body"}, []string{"Snake"}},
+		{"parameters", []string{"title"}, nil},
+	}
+
+	for _, tt := range tests {
+		var found []searchArticle
+		if err := Search(conn, &searchArticle{}, tt.query, tt.columns...).Find(&found).Error; err != nil {
+			t.Fatalf("%q: %v", tt.query, err)
+		}
+
+		var titles []string
+		for _, article := range found {
+			titles = append(titles, article.Title)
+		}
+		sort.Strings(titles)
+		if strings.Join(titles, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%q in %v: got %v, want %v", tt.query, tt.columns, titles, tt.want)
+		}
+	}
+}
+
+func TestSearchRejectsColumns(t *testing.T) {
+	conn := cservicetest.OpenDB(t, &searchArticle{})
+
+	for _, columns := range [][]string{
+		nil,
+		{"password"},
+		{"title", "body) OR 1=1 --"},
+		{"title`"},
+	} {
+		var found []searchArticle
+		if err := Search(conn, &searchArticle{}, "x", columns...).Find(&found).Error; err == nil {
+			t.Errorf("%q: no error", columns)
+		}
+	}
+}
+
+func TestSearchMySQL(t *testing.T) {
+	conn, err := gorm.Open(mysql.New(mysql.Config{DSN: "user:pass@tcp(localhost:3306)/db", SkipInitializeWithVersion: true}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found []searchArticle
+	stmt := Search(conn, &searchArticle{}, "generics", "title", "body").Find(&found).Statement
+	if stmt.Error != nil {
+		t.Fatal(stmt.Error)
+	}
+
+	sql := stmt.SQL.String()
+	if !strings.Contains(sql, "MATCH(`title`, `body`) AGAINST (? IN NATURAL LANGUAGE MODE)") {
+		t.Errorf("got %s", sql)
+	}
+}
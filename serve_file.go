@@ -0,0 +1,83 @@
+package cservice
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// ServeFile sends the file at path as a download. Range, If-Range,
+// If-None-Match and If-Modified-Since requests are answered from the file's
+// size and modification time. Missing files are answered with 404 Not
+// Found. Set the Content-Disposition header beforehand to change the download
+// name or serve the file inline.
+func ServeFile(rw http.ResponseWriter, r *http.Request, path string) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		http.Error(rw, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		http.Error(rw, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return nil
+	}
+
+	if rw.Header().Get("ETag") == "" {
+		// A strong validator, so If-Range requests can resume downloads.
+		rw.Header().Set("ETag", `"`+strconv.FormatInt(info.Size(), 16)+"-"+strconv.FormatInt(info.ModTime().UnixNano(), 16)+`"`)
+	}
+
+	setContentDisposition(rw, info.Name())
+	http.ServeContent(rw, r, info.Name(), info.ModTime(), file)
+	return nil
+}
+
+// ServeReader sends content as a download named name, supporting the same
+// conditional and Range requests as ServeFile. modified may be zero if
+// unknown. Unless the ETag header is already set, it is computed by hashing
+// content, so set it beforehand for large content with a known version.
+func ServeReader(rw http.ResponseWriter, r *http.Request, name string, modified time.Time, content io.ReadSeeker) error {
+	if rw.Header().Get("ETag") == "" {
+		hash := sha256.New()
+		if _, err := io.Copy(hash, content); err != nil {
+			return err
+		}
+
+		if _, err := content.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+
+		rw.Header().Set("ETag", `"`+hex.EncodeToString(hash.Sum(nil))+`"`)
+	}
+
+	setContentDisposition(rw, name)
+	http.ServeContent(rw, r, name, modified, content)
+	return nil
+}
+
+// setContentDisposition marks the response as a download named name, unless
+// the handler has already set Content-Disposition.
+func setContentDisposition(rw http.ResponseWriter, name string) {
+	if rw.Header().Get("Content-Disposition") != "" {
+		return
+	}
+
+	rw.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filepath.Base(name)}))
+}
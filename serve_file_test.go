@@ -0,0 +1,121 @@
+package cservice
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServeFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.csv")
+	if err := ioutil.WriteFile(path, []byte("0123456789"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	modified := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(path, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/report.csv", nil)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+
+		rec := httptest.NewRecorder()
+		if err := ServeFile(rec, req, path); err != nil {
+			t.Fatal(err)
+		}
+		return rec
+	}
+
+	full := serve(nil)
+	etag := full.Header().Get("ETag")
+	if full.Code != http.StatusOK || full.Body.String() != "0123456789" {
+		t.Fatalf("got %d %q", full.Code, full.Body)
+	}
+	if !strings.HasPrefix(etag, `"`) {
+		t.Errorf("got ETag %q, want a strong validator", etag)
+	}
+	if got := full.Header().Get("Content-Disposition"); got != `attachment; filename=report.csv` {
+		t.Errorf("got Content-Disposition %q", got)
+	}
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		code    int
+		body    string
+	}{
+		{"matching If-None-Match", map[string]string{"If-None-Match": etag}, http.StatusNotModified, ""},
+		{"other If-None-Match", map[string]string{"If-None-Match": `"other"`}, http.StatusOK, "0123456789"},
+		{"If-Modified-Since", map[string]string{"If-Modified-Since": modified.Format(http.TimeFormat)}, http.StatusNotModified, ""},
+		{"Range", map[string]string{"Range": "bytes=2-4"}, http.StatusPartialContent, "234"},
+		{"If-Range with current ETag", map[string]string{"Range": "bytes=5-", "If-Range": etag}, http.StatusPartialContent, "56789"},
+		{"If-Range with stale ETag", map[string]string{"Range": "bytes=5-", "If-Range": `"stale"`}, http.StatusOK, "0123456789"},
+		{"If-Range with weak ETag", map[string]string{"Range": "bytes=5-", "If-Range": "W/" + etag}, http.StatusOK, "0123456789"},
+		{"unsatisfiable Range", map[string]string{"Range": "bytes=20-"}, http.StatusRequestedRangeNotSatisfiable, ""},
+	}
+
+	for _, tt := range tests {
+		rec := serve(tt.headers)
+		if rec.Code != tt.code || (tt.body != "" && rec.Body.String() != tt.body) {
+			t.Errorf("%s: got %d %q, want %d %q", tt.name, rec.Code, rec.Body, tt.code, tt.body)
+		}
+	}
+
+	if err := os.Chtimes(path, modified.Add(time.Second), modified.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if rec := serve(map[string]string{"If-None-Match": etag}); rec.Code != http.StatusOK || rec.Header().Get("ETag") == etag {
+		t.Errorf("after modification: got %d with ETag %q", rec.Code, rec.Header().Get("ETag"))
+	}
+}
+
+func TestServeFileMissing(t *testing.T) {
+	for _, path := range []string{filepath.Join(t.TempDir(), "missing"), t.TempDir()} {
+		rec := httptest.NewRecorder()
+		if err := ServeFile(rec, httptest.NewRequest(http.MethodGet, "/", nil), path); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: got %d", path, rec.Code)
+		}
+	}
+}
+
+func TestServeReader(t *testing.T) {
+	serve := func(headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+
+		rec := httptest.NewRecorder()
+		if err := ServeReader(rec, req, "dir/notes.txt", time.Time{}, strings.NewReader("hello")); err != nil {
+			t.Fatal(err)
+		}
+		return rec
+	}
+
+	rec := serve(nil)
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || rec.Body.String() != "hello" || etag == "" {
+		t.Fatalf("got %d %q with ETag %q", rec.Code, rec.Body, etag)
+	}
+	if got := rec.Header().Get("Content-Disposition"); got != `attachment; filename=notes.txt` {
+		t.Errorf("got Content-Disposition %q", got)
+	}
+
+	if rec := serve(map[string]string{"If-None-Match": etag}); rec.Code != http.StatusNotModified {
+		t.Errorf("If-None-Match: got %d", rec.Code)
+	}
+	if rec := serve(map[string]string{"Range": "bytes=1-2", "If-Range": etag}); rec.Code != http.StatusPartialContent || rec.Body.String() != "el" {
+		t.Errorf("If-Range: got %d %q", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,196 @@
+package cservice
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SingleFlightConfig defines which GET requests SingleFlight coalesces.
+type SingleFlightConfig struct {
+	// Key identifies requests which receive identical responses. Requests
+	// with an empty key are not coalesced. Defaults to the path and query,
+	// skipping requests with an Authorization or Cookie header, whose
+	// responses are likely to differ per caller.
+	Key func(r *http.Request) string
+
+	// Timeout limits the shared execution, which runs detached from the
+	// context of the request that started it, so one client disconnecting
+	// does not fail every waiting client. Defaults to 30 seconds.
+	Timeout time.Duration
+}
+
+// singleFlight is one execution of a handler shared by identical requests.
+type singleFlight struct {
+	done    chan struct{}
+	request http.Header
+
+	// shared is set once the response may be sent to waiting clients.
+	shared bool
+	status int
+	header http.Header
+	body   []byte
+}
+
+// SingleFlight returns middleware which coalesces concurrent identical GET
+// requests into one execution of the handler, sending its response to every
+// waiting client. This protects the database when many clients miss an
+// expired cache entry at once. Coalesced responses are buffered in memory.
+//
+// Waiting clients run the handler themselves instead if the response sets
+// cookies, or varies, by its Vary header or by credentials, on a request
+// header their request does not share.
+func SingleFlight(config SingleFlightConfig) func(http.Handler) http.Handler {
+	key := config.Key
+	if key == nil {
+		key = defaultSingleFlightKey
+	}
+
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+
+	var mu sync.Mutex
+	flights := map[string]*singleFlight{}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			k := ""
+			if r.Method == http.MethodGet {
+				k = key(r)
+			}
+			if k == "" {
+				next.ServeHTTP(rw, r)
+				return
+			}
+
+			mu.Lock()
+			flight, waiting := flights[k]
+			if !waiting {
+				flight = &singleFlight{done: make(chan struct{}), request: r.Header.Clone()}
+				flights[k] = flight
+			}
+			mu.Unlock()
+
+			if waiting {
+				select {
+				case <-flight.done:
+				case <-r.Context().Done():
+					return
+				}
+
+				if !flight.shareableWith(r) {
+					next.ServeHTTP(rw, r)
+					return
+				}
+
+				flight.write(rw)
+				return
+			}
+
+			defer func() {
+				mu.Lock()
+				delete(flights, k)
+				mu.Unlock()
+				close(flight.done)
+			}()
+
+			ctx, cancel := context.WithTimeout(detachedContext{r.Context()}, timeout)
+			defer cancel()
+
+			recorder := &recordingResponseWriter{header: http.Header{}, status: http.StatusOK}
+			next.ServeHTTP(recorder, r.WithContext(ctx))
+
+			flight.status = recorder.status
+			flight.header = recorder.header
+			flight.body = recorder.body.Bytes()
+			flight.shared = len(recorder.header.Values("Set-Cookie")) == 0
+			flight.write(rw)
+		})
+	}
+}
+
+func defaultSingleFlightKey(r *http.Request) string {
+	if r.Header.Get("Authorization") != "" || r.Header.Get("Cookie") != "" {
+		return ""
+	}
+	return r.URL.RequestURI()
+}
+
+// shareableWith reports whether the response can be sent to r. Responses
+// are not shared if they set cookies, if the execution panicked, or if r
+// differs from the request which produced the response in its credentials
+// or a header named by Vary.
+func (f *singleFlight) shareableWith(r *http.Request) bool {
+	if !f.shared {
+		return false
+	}
+
+	varies := []string{"Authorization", "Cookie"}
+	for _, value := range f.header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			varies = append(varies, strings.TrimSpace(name))
+		}
+	}
+
+	for _, name := range varies {
+		if name == "*" {
+			return false
+		}
+		if strings.Join(r.Header.Values(name), ",") != strings.Join(f.request.Values(name), ",") {
+			return false
+		}
+	}
+
+	return true
+}
+
+// write sends the shared response to rw.
+func (f *singleFlight) write(rw http.ResponseWriter) {
+	header := rw.Header()
+	for name, values := range f.header {
+		header[name] = append([]string(nil), values...)
+	}
+
+	rw.WriteHeader(f.status)
+	rw.Write(f.body)
+}
+
+// detachedContext keeps the values of a context but not its cancellation or
+// deadline.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}               { return nil }
+func (detachedContext) Err() error                          { return nil }
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
+
+// recordingResponseWriter buffers a response.
+type recordingResponseWriter struct {
+	header      http.Header
+	body        bytes.Buffer
+	status      int
+	wroteHeader bool
+}
+
+func (w *recordingResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *recordingResponseWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+}
+
+func (w *recordingResponseWriter) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	return w.body.Write(p)
+}
@@ -0,0 +1,111 @@
+package cservice
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// coalesce runs a leader request and waiters through SingleFlight, releasing
+// the leader's handler once the waiters are queued behind it.
+func coalesce(t *testing.T, handler func(rw http.ResponseWriter, r *http.Request), leader *http.Request, waiters ...*http.Request) (executions int32, responses []*httptest.ResponseRecorder) {
+	t.Helper()
+
+	entered := make(chan struct{}, 1)
+	release := make(chan struct{})
+	var calls int32
+
+	h := SingleFlight(SingleFlightConfig{})(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			entered <- struct{}{}
+			<-release
+		}
+		handler(rw, r)
+	}))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		h.ServeHTTP(httptest.NewRecorder(), leader)
+	}()
+	<-entered
+
+	responses = make([]*httptest.ResponseRecorder, len(waiters))
+	for i, req := range waiters {
+		responses[i] = httptest.NewRecorder()
+		wg.Add(1)
+		go func(rec *httptest.ResponseRecorder, req *http.Request) {
+			defer wg.Done()
+			h.ServeHTTP(rec, req)
+		}(responses[i], req)
+	}
+
+	// Give the waiters time to queue behind the leader.
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	return atomic.LoadInt32(&calls), responses
+}
+
+func TestSingleFlightSurvivesLeaderDisconnect(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	leader := httptest.NewRequest(http.MethodGet, "/report", nil).WithContext(ctx)
+	cancel()
+
+	calls, responses := coalesce(t, func(rw http.ResponseWriter, r *http.Request) {
+		if err := r.Context().Err(); err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(rw, "report")
+	}, leader, httptest.NewRequest(http.MethodGet, "/report", nil), httptest.NewRequest(http.MethodGet, "/report", nil))
+
+	if calls != 1 {
+		t.Errorf("handler ran %d times, want 1", calls)
+	}
+	for _, rec := range responses {
+		if rec.Code != http.StatusOK || rec.Body.String() != "report" {
+			t.Errorf("waiter got %d %q", rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestSingleFlightDoesNotShareCookies(t *testing.T) {
+	calls, responses := coalesce(t, func(rw http.ResponseWriter, r *http.Request) {
+		http.SetCookie(rw, &http.Cookie{Name: "session", Value: "leader"})
+	}, httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if calls != 2 {
+		t.Errorf("handler ran %d times, want 2", calls)
+	}
+	if cookie := responses[0].Header().Get("Set-Cookie"); cookie != "session=leader" {
+		t.Errorf("waiter got cookie %q from its own execution", cookie)
+	}
+}
+
+func TestSingleFlightRespectsVary(t *testing.T) {
+	request := func(language string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Language", language)
+		return req
+	}
+
+	calls, responses := coalesce(t, func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Vary", "Accept-Language")
+		fmt.Fprint(rw, r.Header.Get("Accept-Language"))
+	}, request("en"), request("en"), request("fr"))
+
+	if calls != 2 {
+		t.Errorf("handler ran %d times, want 2", calls)
+	}
+	if responses[0].Body.String() != "en" || responses[1].Body.String() != "fr" {
+		t.Errorf("got %q and %q", responses[0].Body, responses[1].Body)
+	}
+}
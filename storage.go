@@ -0,0 +1,148 @@
+package cservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"time"
+)
+
+// ErrObjectNotFound is returned when a stored object does not exist.
+var ErrObjectNotFound = errors.New("cservice: object not found")
+
+// ErrStorageNotInitialised is returned when storage is used before
+// InitStorage has succeeded.
+var ErrStorageNotInitialised = errors.New("cservice: storage not initialised")
+
+// ObjectStore stores objects by key.
+type ObjectStore interface {
+	// Put stores the contents of r under key. size is the length of r, or -1
+	// if unknown.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+
+	// Get opens the object stored under key, returning ErrObjectNotFound if
+	// there is none.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+
+	// Delete removes the object stored under key.
+	Delete(ctx context.Context, key string) error
+
+	// PresignedURL returns a URL which allows method (GET or PUT) on key
+	// without further credentials until it expires.
+	PresignedURL(ctx context.Context, method, key string, expires time.Duration) (string, error)
+}
+
+// StorageConfig defines the settings required to initialise object storage.
+type StorageConfig struct {
+	// Driver selects the backend: "local" or "s3".
+	Driver string
+
+	// Root is the directory objects are stored in by the local driver.
+	Root string
+
+	// BaseURL is the URL the local driver's Handler is served at, used to
+	// build presigned URLs.
+	BaseURL string
+
+	// SigningKey signs the local driver's presigned URLs.
+	SigningKey []byte
+
+	// Bucket to store objects in with the s3 driver.
+	Bucket string
+
+	// Region of the bucket.
+	Region string
+
+	// Endpoint of an S3-compatible service. Defaults to AWS S3 in Region.
+	Endpoint string
+
+	// AccessKeyID to authenticate with.
+	AccessKeyID string
+
+	// SecretAccessKey to authenticate with.
+	SecretAccessKey string
+
+	// PathStyle addresses the bucket in the path rather than the host name,
+	// as required by most self-hosted S3-compatible services.
+	PathStyle bool
+
+	// Client makes requests to the s3 driver's endpoint. Defaults to
+	// http.DefaultClient.
+	Client *http.Client
+}
+
+var storage ObjectStore
+
+// InitStorage initialises the object store used by Storage.
+func InitStorage(config StorageConfig) error {
+	var err error
+
+	switch config.Driver {
+	case "local":
+		storage, err = NewLocalStorage(config)
+	case "s3":
+		storage, err = NewS3Storage(config)
+	default:
+		err = fmt.Errorf("cservice: unknown storage driver %q", config.Driver)
+	}
+
+	return err
+}
+
+// Storage returns the object store initialised by InitStorage.
+func Storage() (ObjectStore, error) {
+	if storage == nil {
+		return nil, ErrStorageNotInitialised
+	}
+	return storage, nil
+}
+
+// StreamUpload stores the body of r under key without buffering it in memory.
+// Bodies larger than maxSize bytes are rejected; zero means no limit.
+func StreamUpload(store ObjectStore, r *http.Request, key string, maxSize int64) error {
+	body := io.Reader(r.Body)
+	size := r.ContentLength
+
+	if maxSize > 0 {
+		if size > maxSize {
+			return fmt.Errorf("cservice: upload of %d bytes exceeds limit of %d", size, maxSize)
+		}
+		body = http.MaxBytesReader(nil, r.Body, maxSize)
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	return store.Put(r.Context(), key, body, size, contentType)
+}
+
+// StreamDownload writes the object stored under key to rw as an attachment,
+// responding 404 Not Found if it does not exist.
+func StreamDownload(store ObjectStore, rw http.ResponseWriter, r *http.Request, key string) error {
+	object, err := store.Get(r.Context(), key)
+	if errors.Is(err, ErrObjectNotFound) {
+		http.Error(rw, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer object.Close()
+
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	rw.Header().Set("Content-Type", contentType)
+	rw.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(key)}))
+
+	_, err = io.Copy(rw, object)
+	return err
+}
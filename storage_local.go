@@ -0,0 +1,192 @@
+package cservice
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LocalStorage stores objects as files under a root directory.
+type LocalStorage struct {
+	root       string
+	baseURL    string
+	signingKey []byte
+	clock      Clock
+}
+
+// NewLocalStorage creates a LocalStorage from config.
+func NewLocalStorage(config StorageConfig) (*LocalStorage, error) {
+	if config.Root == "" {
+		return nil, errors.New("cservice: local storage requires a root directory")
+	}
+
+	if err := os.MkdirAll(config.Root, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &LocalStorage{
+		root:       config.Root,
+		baseURL:    strings.TrimRight(config.BaseURL, "/"),
+		signingKey: config.SigningKey,
+		clock:      SystemClock,
+	}, nil
+}
+
+// Put stores the contents of r under key.
+func (s *LocalStorage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so readers never see a partial object.
+	tmp, err := ioutil.TempFile(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), name)
+}
+
+// Get opens the object stored under key.
+func (s *LocalStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	name, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrObjectNotFound
+	}
+
+	return file, err
+}
+
+// Delete removes the object stored under key.
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+// PresignedURL returns a URL to Handler allowing method on key until it
+// expires.
+func (s *LocalStorage) PresignedURL(ctx context.Context, method, key string, expires time.Duration) (string, error) {
+	if len(s.signingKey) == 0 || s.baseURL == "" {
+		return "", errors.New("cservice: local storage requires a base URL and signing key to presign URLs")
+	}
+
+	if _, err := s.path(key); err != nil {
+		return "", err
+	}
+
+	expiry := strconv.FormatInt(s.clock.Now().Add(expires).Unix(), 10)
+
+	query := url.Values{}
+	query.Set("expires", expiry)
+	query.Set("method", method)
+	query.Set("signature", s.sign(method, key, expiry))
+
+	return s.baseURL + "/" + escapeKey(key) + "?" + query.Encode(), nil
+}
+
+// Handler serves GET and PUT requests made with presigned URLs. Mount it at
+// the configured base URL with the prefix stripped. Without a signing key
+// every request is rejected, as anyone could compute the signatures.
+func (s *LocalStorage) Handler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if len(s.signingKey) == 0 {
+			http.Error(rw, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		key := strings.TrimPrefix(r.URL.Path, "/")
+		query := r.URL.Query()
+		expiry := query.Get("expires")
+
+		seconds, err := strconv.ParseInt(expiry, 10, 64)
+		if err != nil || s.clock.Now().Unix() > seconds || query.Get("method") != r.Method ||
+			!hmac.Equal([]byte(query.Get("signature")), []byte(s.sign(r.Method, key, expiry))) {
+			http.Error(rw, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			if err := StreamDownload(s, rw, r, key); err != nil {
+				http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}
+		case http.MethodPut:
+			if err := StreamUpload(s, r, key, 0); err != nil {
+				http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			rw.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(rw, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func (s *LocalStorage) sign(method, key, expiry string) string {
+	mac := hmac.New(sha256.New, s.signingKey)
+	mac.Write([]byte(method + "\n" + key + "\n" + expiry))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// path maps key to a file under the root, rejecting keys which would escape
+// it.
+func (s *LocalStorage) path(key string) (string, error) {
+	cleaned := path.Clean("/" + key)
+	if key == "" || cleaned == "/" || cleaned != "/"+key {
+		return "", fmt.Errorf("cservice: invalid object key %q", key)
+	}
+
+	return filepath.Join(s.root, filepath.FromSlash(cleaned)), nil
+}
+
+// escapeKey URL-encodes each segment of key, escaping everything but RFC 3986
+// unreserved characters.
+func escapeKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = awsEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
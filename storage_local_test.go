@@ -0,0 +1,58 @@
+package cservice
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalStoragePresignedURL(t *testing.T) {
+	storage, err := NewLocalStorage(StorageConfig{Root: t.TempDir(), BaseURL: "http://files.test", SigningKey: []byte("key")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if err := storage.Put(ctx, "docs/a.txt", strings.NewReader("hello"), 5, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := storage.PresignedURL(ctx, http.MethodGet, "docs/a.txt", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(storage *LocalStorage, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		storage.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, strings.TrimPrefix(target, "http://files.test"), nil))
+		return rec
+	}
+
+	if rec := serve(storage, signed); rec.Code != http.StatusOK || rec.Body.String() != "hello" {
+		t.Errorf("signed URL: got %d %q", rec.Code, rec.Body)
+	}
+
+	if rec := serve(storage, strings.Replace(signed, "a.txt", "b.txt", 1)); rec.Code != http.StatusForbidden {
+		t.Errorf("other key: got %d", rec.Code)
+	}
+
+	// Without a signing key, a URL signed with an empty key is forgeable.
+	unsigned, err := NewLocalStorage(StorageConfig{Root: storage.root})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expiry := "9999999999"
+	forged := "/docs/a.txt?" + url.Values{
+		"expires":   {expiry},
+		"method":    {http.MethodGet},
+		"signature": {unsigned.sign(http.MethodGet, "docs/a.txt", expiry)},
+	}.Encode()
+	if rec := serve(unsigned, forged); rec.Code != http.StatusForbidden {
+		t.Errorf("forged URL without signing key: got %d", rec.Code)
+	}
+}
@@ -0,0 +1,312 @@
+package cservice
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// maxPresignedExpiry is the longest expiry S3 accepts on a presigned URL.
+const maxPresignedExpiry = 7 * 24 * time.Hour
+
+// S3Storage stores objects in an S3-compatible bucket. Requests are signed
+// with AWS Signature Version 4.
+type S3Storage struct {
+	endpoint  *url.URL
+	bucket    string
+	region    string
+	accessKey string
+	secretKey string
+	pathStyle bool
+	client    *http.Client
+	clock     Clock
+}
+
+// NewS3Storage creates an S3Storage from config.
+func NewS3Storage(config StorageConfig) (*S3Storage, error) {
+	if config.Bucket == "" || config.Region == "" {
+		return nil, errors.New("cservice: s3 storage requires a bucket and region")
+	}
+
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + config.Region + ".amazonaws.com"
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	client := config.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &S3Storage{
+		endpoint:  u,
+		bucket:    config.Bucket,
+		region:    config.Region,
+		accessKey: config.AccessKeyID,
+		secretKey: config.SecretAccessKey,
+		pathStyle: config.PathStyle,
+		client:    client,
+		clock:     SystemClock,
+	}, nil
+}
+
+// Put uploads the contents of r under key. S3 requires the length up front,
+// so bodies of unknown size are spooled to a temporary file first.
+func (s *S3Storage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	if size < 0 {
+		spool, err := ioutil.TempFile("", "cservice-upload-*")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(spool.Name())
+		defer spool.Close()
+
+		if size, err = io.Copy(spool, r); err != nil {
+			return err
+		}
+
+		if _, err := spool.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+
+		r = spool
+	}
+
+	body := ioutil.NopCloser(r)
+	if size == 0 {
+		body = http.NoBody
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(key).String(), body)
+	if err != nil {
+		return err
+	}
+
+	req.ContentLength = size
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+// Get downloads the object stored under key.
+func (s *S3Storage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.objectURL(key).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+// Delete removes the object stored under key.
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.objectURL(key).String(), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.do(req)
+	if errors.Is(err, ErrObjectNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+// PresignedURL returns a query-signed URL allowing method on key until it
+// expires, which must be between one second and 7 days.
+func (s *S3Storage) PresignedURL(ctx context.Context, method, key string, expires time.Duration) (string, error) {
+	if expires < time.Second || expires > maxPresignedExpiry {
+		return "", fmt.Errorf("cservice: presigned URL expiry %s is not between 1s and %s", expires, maxPresignedExpiry)
+	}
+
+	now := s.clock.Now().UTC()
+	u := s.objectURL(key)
+
+	query := u.Query()
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", s.accessKey+"/"+s.scope(now))
+	query.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	query.Set("X-Amz-Expires", strconv.FormatInt(int64(expires/time.Second), 10))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	headers := http.Header{}
+	headers.Set("Host", u.Host)
+
+	query.Set("X-Amz-Signature", s.signature(method, u.EscapedPath(), query, headers, []string{"host"}, unsignedPayload, now))
+	u.RawQuery = canonicalQuery(query)
+
+	return u.String(), nil
+}
+
+// do signs and sends req, converting error responses into errors.
+func (s *S3Storage) do(req *http.Request) (*http.Response, error) {
+	now := s.clock.Now().UTC()
+
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+	req.Header.Set("Host", req.URL.Host)
+
+	signed := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if req.Header.Get("Content-Type") != "" {
+		signed = append([]string{"content-type"}, signed...)
+	}
+
+	signature := s.signature(req.Method, req.URL.EscapedPath(), req.URL.Query(), req.Header, signed, unsignedPayload, now)
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, s.scope(now), strings.Join(signed, ";"), signature))
+	req.Header.Del("Host")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrObjectNotFound
+	}
+
+	if resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("cservice: s3 %s %s: %s: %s", req.Method, req.URL.Path, resp.Status, body)
+	}
+
+	return resp, nil
+}
+
+// objectURL returns the URL of key in the bucket.
+func (s *S3Storage) objectURL(key string) *url.URL {
+	u := *s.endpoint
+
+	prefix := "/"
+	if s.pathStyle {
+		prefix = strings.TrimRight(u.Path, "/") + "/" + s.bucket + "/"
+	} else {
+		u.Host = s.bucket + "." + u.Host
+	}
+
+	u.Path = prefix + key
+	u.RawPath = prefix + escapeKey(key)
+
+	return &u
+}
+
+func (s *S3Storage) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + s.region + "/s3/aws4_request"
+}
+
+// signature computes the Signature Version 4 signature of a request.
+func (s *S3Storage) signature(method, escapedPath string, query url.Values, headers http.Header, signed []string, payloadHash string, now time.Time) string {
+	var canonicalHeaders strings.Builder
+	for _, name := range signed {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers.Get(name)) + "\n")
+	}
+
+	signedQuery := url.Values{}
+	for k, v := range query {
+		if k != "X-Amz-Signature" {
+			signedQuery[k] = v
+		}
+	}
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		escapedPath,
+		canonicalQuery(signedQuery),
+		canonicalHeaders.String(),
+		strings.Join(signed, ";"),
+		payloadHash,
+	}, "\n")
+
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + now.Format("20060102T150405Z") + "\n" + s.scope(now) + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), now.Format("20060102"))
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery encodes query sorted by key with RFC 3986 escaping, as
+// Signature Version 4 requires.
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, awsEscape(k)+"="+awsEscape(v))
+		}
+	}
+
+	return strings.Join(parts, "&")
+}
+
+// awsEscape percent-encodes every byte of s except the RFC 3986 unreserved
+// characters. url.QueryEscape differs by encoding '~' and spaces as '+'.
+func awsEscape(s string) string {
+	const upperhex = "0123456789ABCDEF"
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(upperhex[c>>4])
+		b.WriteByte(upperhex[c&15])
+	}
+	return b.String()
+}
@@ -0,0 +1,163 @@
+package cservice
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+)
+
+// ErrTemplatesNotInitialised is returned by Render before InitTemplates has
+// succeeded.
+var ErrTemplatesNotInitialised = errors.New("cservice: templates not initialised")
+
+// TemplateConfig defines where HTML templates are loaded from.
+type TemplateConfig struct {
+	// FS holds the templates, e.g. an embed.FS, or os.DirFS in development
+	// so edits are picked up with Reload.
+	FS fs.FS
+
+	// Shared are patterns of layouts and partials available to every page,
+	// e.g. "layouts/*.html" and "partials/*.html".
+	Shared []string
+
+	// Pages is the pattern of page templates, e.g. "pages/*.html". Pages are
+	// rendered by their file name without the extension, and may invoke
+	// shared templates with {{template}}.
+	Pages string
+
+	// Funcs are made available to every template.
+	Funcs template.FuncMap
+
+	// Reload parses the templates again on every render. Enable it in
+	// development, e.g. Reload: IsDevelopment().
+	Reload bool
+}
+
+// Templates renders HTML pages.
+type Templates struct {
+	config TemplateConfig
+
+	mu    sync.RWMutex
+	pages map[string]*template.Template
+}
+
+// LoadTemplates parses the templates described by config.
+func LoadTemplates(config TemplateConfig) (*Templates, error) {
+	t := &Templates{config: config}
+	if err := t.load(); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// Render executes the named page with data and writes it as HTML. Nothing is
+// written if the page fails to execute.
+func (t *Templates) Render(rw http.ResponseWriter, name string, data interface{}) error {
+	if t.config.Reload {
+		if err := t.load(); err != nil {
+			return err
+		}
+	}
+
+	t.mu.RLock()
+	page, ok := t.pages[name]
+	t.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("cservice: no page template named %q", name)
+	}
+
+	var buf bytes.Buffer
+	if err := page.Execute(&buf, data); err != nil {
+		return err
+	}
+
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, err := buf.WriteTo(rw)
+	return err
+}
+
+// load parses every page, each with its own copy of the shared templates so
+// pages can define blocks with the same names.
+func (t *Templates) load() error {
+	shared := template.New("").Funcs(t.config.Funcs)
+	for _, pattern := range t.config.Shared {
+		matches, err := fs.Glob(t.config.FS, pattern)
+		if err != nil {
+			return err
+		}
+
+		for _, match := range matches {
+			if err := parseTemplateFile(shared, t.config.FS, match); err != nil {
+				return err
+			}
+		}
+	}
+
+	matches, err := fs.Glob(t.config.FS, t.config.Pages)
+	if err != nil {
+		return err
+	}
+
+	pages := map[string]*template.Template{}
+	for _, match := range matches {
+		page, err := shared.Clone()
+		if err != nil {
+			return err
+		}
+
+		if err := parseTemplateFile(page, t.config.FS, match); err != nil {
+			return err
+		}
+
+		base := path.Base(match)
+		name := strings.TrimSuffix(base, path.Ext(base))
+		pages[name] = page.Lookup(base)
+	}
+
+	t.mu.Lock()
+	t.pages = pages
+	t.mu.Unlock()
+
+	return nil
+}
+
+// parseTemplateFile parses the file at name in fsys as a template named by
+// its base name.
+func parseTemplateFile(t *template.Template, fsys fs.FS, name string) error {
+	source, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return err
+	}
+
+	_, err = t.New(path.Base(name)).Parse(string(source))
+	return err
+}
+
+var templates *Templates
+
+// InitTemplates loads the templates used by Render.
+func InitTemplates(config TemplateConfig) error {
+	t, err := LoadTemplates(config)
+	if err != nil {
+		return err
+	}
+
+	templates = t
+	return nil
+}
+
+// Render executes the named page loaded by InitTemplates with data and writes
+// it as HTML.
+func Render(rw http.ResponseWriter, name string, data interface{}) error {
+	if templates == nil {
+		return ErrTemplatesNotInitialised
+	}
+	return templates.Render(rw, name, data)
+}
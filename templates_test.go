@@ -0,0 +1,124 @@
+package cservice
+
+import (
+	"errors"
+	"html/template"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func testTemplateFS() fstest.MapFS {
+	return fstest.MapFS{
+		"layouts/base.html":  {Data: []byte(`<title>{{block "title" .}}Site{{end}}</title><main>{{template "content" .}}</main>`)},
+		"partials/user.html": {Data: []byte(`{{define "user"}}<b>{{shout .}}</b>{{end}}`)},
+		"pages/home.html":    {Data: []byte(`{{template "base.html" .}}{{define "content"}}Hello {{template "user" .Name}}{{end}}`)},
+		"pages/about.html":   {Data: []byte(`{{template "base.html" .}}{{define "title"}}About{{end}}{{define "content"}}About us{{end}}`)},
+		"pages/broken.html":  {Data: []byte(`{{template "base.html" .}}{{define "content"}}{{.Missing.Field}}{{end}}`)},
+	}
+}
+
+func testTemplateConfig(fsys fstest.MapFS) TemplateConfig {
+	return TemplateConfig{
+		FS:     fsys,
+		Shared: []string{"layouts/*.html", "partials/*.html"},
+		Pages:  "pages/*.html",
+		Funcs:  template.FuncMap{"shout": strings.ToUpper},
+	}
+}
+
+func TestTemplatesRender(t *testing.T) {
+	templates, err := LoadTemplates(testTemplateConfig(testTemplateFS()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		page string
+		data interface{}
+		want string
+	}{
+		{"home", map[string]string{"Name": "<alice>"}, `<title>Site</title><main>Hello <b>&lt;ALICE&gt;</b></main>`},
+		{"about", nil, `<title>About</title><main>About us</main>`},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		if err := templates.Render(rec, tt.page, tt.data); err != nil {
+			t.Fatalf("%s: %v", tt.page, err)
+		}
+		if rec.Body.String() != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.page, rec.Body, tt.want)
+		}
+		if got := rec.Header().Get("Content-Type"); got != "text/html; charset=utf-8" {
+			t.Errorf("%s: got Content-Type %q", tt.page, got)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	if err := templates.Render(rec, "missing", nil); err == nil {
+		t.Error("missing page: no error")
+	}
+
+	rec = httptest.NewRecorder()
+	if err := templates.Render(rec, "broken", struct{}{}); err == nil {
+		t.Error("broken page: no error")
+	}
+	if rec.Body.Len() != 0 || rec.Header().Get("Content-Type") != "" {
+		t.Errorf("broken page wrote %q", rec.Body)
+	}
+}
+
+func TestTemplatesReload(t *testing.T) {
+	fsys := testTemplateFS()
+	config := testTemplateConfig(fsys)
+
+	cached, err := LoadTemplates(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Reload = true
+	reloading, err := LoadTemplates(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fsys["pages/about.html"] = &fstest.MapFile{Data: []byte(`{{template "base.html" .}}{{define "content"}}Edited{{end}}`)}
+
+	rec := httptest.NewRecorder()
+	if err := cached.Render(rec, "about", nil); err != nil || !strings.Contains(rec.Body.String(), "About us") {
+		t.Errorf("without Reload: got %q, %v", rec.Body, err)
+	}
+
+	rec = httptest.NewRecorder()
+	if err := reloading.Render(rec, "about", nil); err != nil || !strings.Contains(rec.Body.String(), "Edited") {
+		t.Errorf("with Reload: got %q, %v", rec.Body, err)
+	}
+
+	fsys["pages/about.html"] = &fstest.MapFile{Data: []byte(`{{if}}`)}
+	if err := reloading.Render(httptest.NewRecorder(), "about", nil); err == nil {
+		t.Error("reloading a broken template: no error")
+	}
+	if _, err := LoadTemplates(config); err == nil {
+		t.Error("loading a broken template: no error")
+	}
+}
+
+func TestRenderBeforeInit(t *testing.T) {
+	saved := templates
+	t.Cleanup(func() { templates = saved })
+	templates = nil
+
+	if err := Render(httptest.NewRecorder(), "home", nil); !errors.Is(err, ErrTemplatesNotInitialised) {
+		t.Errorf("got %v", err)
+	}
+
+	if err := InitTemplates(testTemplateConfig(testTemplateFS())); err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	if err := Render(rec, "about", nil); err != nil || !strings.Contains(rec.Body.String(), "About us") {
+		t.Errorf("after InitTemplates: got %q, %v", rec.Body, err)
+	}
+}
@@ -0,0 +1,49 @@
+package cservice
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+type locationKey struct{}
+
+// WithLocation returns a copy of ctx carrying the time zone responses should
+// be rendered in.
+func WithLocation(ctx context.Context, loc *time.Location) context.Context {
+	return context.WithValue(ctx, locationKey{}, loc)
+}
+
+// RequestLocation returns the time zone stored in ctx, or time.UTC.
+func RequestLocation(ctx context.Context) *time.Location {
+	if loc, ok := ctx.Value(locationKey{}).(*time.Location); ok && loc != nil {
+		return loc
+	}
+	return time.UTC
+}
+
+// InRequestLocation converts t to the time zone stored in ctx.
+func InRequestLocation(ctx context.Context, t time.Time) time.Time {
+	return t.In(RequestLocation(ctx))
+}
+
+// TimezoneMiddleware returns middleware which stores the client's time zone in
+// the request context. The zone is read from the named header as an IANA name
+// such as "Europe/London"; when the header is missing or invalid, fallback
+// (e.g. a lookup of the user's profile) is consulted if given.
+func TimezoneMiddleware(header string, fallback func(r *http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			loc, err := time.LoadLocation(r.Header.Get(header))
+			if (err != nil || r.Header.Get(header) == "") && fallback != nil {
+				loc, err = time.LoadLocation(fallback(r))
+			}
+
+			if err == nil {
+				r = r.WithContext(WithLocation(r.Context(), loc))
+			}
+
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
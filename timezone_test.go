@@ -0,0 +1,72 @@
+package cservice
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTimezoneMiddleware(t *testing.T) {
+	fallback := func(r *http.Request) string {
+		return r.URL.Query().Get("tz")
+	}
+
+	tests := []struct {
+		name     string
+		header   string
+		target   string
+		fallback func(r *http.Request) string
+		want     string
+	}{
+		{"header", "America/New_York", "/", fallback, "America/New_York"},
+		{"header wins over fallback", "America/New_York", "/?tz=Asia/Tokyo", fallback, "America/New_York"},
+		{"missing header uses fallback", "", "/?tz=Asia/Tokyo", fallback, "Asia/Tokyo"},
+		{"invalid header uses fallback", "Mars/Olympus", "/?tz=Asia/Tokyo", fallback, "Asia/Tokyo"},
+		{"invalid header and fallback", "Mars/Olympus", "/?tz=Nowhere", fallback, "UTC"},
+		{"invalid header without fallback", "Mars/Olympus", "/", nil, "UTC"},
+		{"nothing given", "", "/", nil, "UTC"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := TimezoneMiddleware("X-Timezone", tt.fallback)(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				got = RequestLocation(r.Context()).String()
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.header != "" {
+				req.Header.Set("X-Timezone", tt.header)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInRequestLocation(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	instant := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	if got := InRequestLocation(context.Background(), instant); got.Location() != time.UTC {
+		t.Errorf("without a location: got %s", got.Location())
+	}
+
+	got := InRequestLocation(WithLocation(context.Background(), tokyo), instant)
+	if got.Hour() != 21 || !got.Equal(instant) {
+		t.Errorf("got %s", got)
+	}
+
+	if loc := RequestLocation(WithLocation(context.Background(), nil)); loc != time.UTC {
+		t.Errorf("nil location: got %s", loc)
+	}
+}
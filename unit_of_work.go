@@ -0,0 +1,52 @@
+package cservice
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// UnitOfWork groups work across several repositories into one transaction.
+type UnitOfWork struct {
+	tx *gorm.DB
+}
+
+// NewUnitOfWork begins a transaction on db. The caller must Commit or
+// Rollback the returned UnitOfWork.
+func NewUnitOfWork(ctx context.Context, db *gorm.DB) (*UnitOfWork, error) {
+	tx := db.WithContext(ctx).Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	return &UnitOfWork{tx: tx}, nil
+}
+
+// RunUnitOfWork calls fn with a new UnitOfWork, committing it if fn returns
+// nil and rolling it back if fn returns an error or panics.
+func RunUnitOfWork(ctx context.Context, db *gorm.DB, fn func(uow *UnitOfWork) error) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(&UnitOfWork{tx: tx})
+	})
+}
+
+// RepositoryFor returns a Repository for T bound to the unit of work's
+// transaction.
+func RepositoryFor[T any](uow *UnitOfWork) *Repository[T] {
+	return NewRepository[T](uow.tx)
+}
+
+// DB returns the unit of work's transaction.
+func (u *UnitOfWork) DB() *gorm.DB {
+	return u.tx
+}
+
+// Commit commits the unit of work.
+func (u *UnitOfWork) Commit() error {
+	return u.tx.Commit().Error
+}
+
+// Rollback discards the unit of work.
+func (u *UnitOfWork) Rollback() error {
+	return u.tx.Rollback().Error
+}
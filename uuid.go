@@ -0,0 +1,117 @@
+package cservice
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"reflect"
+
+	"gorm.io/gorm"
+)
+
+// NewUUIDv7 returns a new time-ordered UUID (version 7) in its canonical
+// string form.
+func NewUUIDv7() (string, error) {
+	var u [16]byte
+	if _, err := rand.Read(u[6:]); err != nil {
+		return "", err
+	}
+
+	ms := uint64(SystemClock.Now().UnixMilli())
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], ms)
+	copy(u[0:6], ts[2:8])
+
+	u[6] = (u[6] & 0x0f) | 0x70 // version 7
+	u[8] = (u[8] & 0x3f) | 0x80 // RFC 4122 variant
+
+	var out [36]byte
+	hex.Encode(out[0:8], u[0:4])
+	out[8] = '-'
+	hex.Encode(out[9:13], u[4:6])
+	out[13] = '-'
+	hex.Encode(out[14:18], u[6:8])
+	out[18] = '-'
+	hex.Encode(out[19:23], u[8:10])
+	out[23] = '-'
+	hex.Encode(out[24:36], u[10:16])
+
+	return string(out[:]), nil
+}
+
+// UUIDPlugin is a GORM plugin which fills in empty string primary keys of
+// registered models when they are created.
+type UUIDPlugin struct {
+	// Generator creates IDs. Defaults to NewUUIDv7.
+	Generator func() (string, error)
+
+	models map[reflect.Type]bool
+}
+
+// NewUUIDPlugin creates a UUIDPlugin for the given models.
+func NewUUIDPlugin(models ...interface{}) *UUIDPlugin {
+	p := &UUIDPlugin{models: map[reflect.Type]bool{}}
+
+	for _, model := range models {
+		p.models[indirectType(reflect.TypeOf(model))] = true
+	}
+
+	return p
+}
+
+// Name returns the name of the plugin.
+func (p *UUIDPlugin) Name() string {
+	return "cservice:uuid"
+}
+
+// Initialize registers the plugin's create callback.
+func (p *UUIDPlugin) Initialize(db *gorm.DB) error {
+	return db.Callback().Create().Before("gorm:create").Register(p.Name(), p.assignIDs)
+}
+
+func (p *UUIDPlugin) assignIDs(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil || !p.models[db.Statement.Schema.ModelType] {
+		return
+	}
+
+	field := db.Statement.Schema.PrioritizedPrimaryField
+	if field == nil || field.FieldType.Kind() != reflect.String {
+		return
+	}
+
+	generate := p.Generator
+	if generate == nil {
+		generate = NewUUIDv7
+	}
+
+	assign := func(rv reflect.Value) {
+		if _, zero := field.ValueOf(rv); !zero {
+			return
+		}
+
+		id, err := generate()
+		if err != nil {
+			db.AddError(err)
+			return
+		}
+
+		db.AddError(field.Set(rv, id))
+	}
+
+	rv := db.Statement.ReflectValue
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			assign(reflect.Indirect(rv.Index(i)))
+		}
+	case reflect.Struct:
+		assign(rv)
+	}
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	return t
+}
@@ -0,0 +1,92 @@
+package cservice
+
+import (
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/crockerio/cservice/cservicetest"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestNewUUIDv7(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	defer func(previous Clock) { SystemClock = previous }(SystemClock)
+	SystemClock = clock
+
+	seen := map[string]bool{}
+	previous := ""
+	for i := 0; i < 100; i++ {
+		id, err := NewUUIDv7()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !uuidPattern.MatchString(id) {
+			t.Fatalf("%q is not a version 7, RFC 4122 variant UUID", id)
+		}
+		if seen[id] {
+			t.Fatalf("duplicate id %q", id)
+		}
+		seen[id] = true
+
+		ms, err := strconv.ParseInt(id[0:8]+id[9:13], 16, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ms != clock.Now().UnixMilli() {
+			t.Errorf("%q has timestamp %d, want %d", id, ms, clock.Now().UnixMilli())
+		}
+
+		if id <= previous {
+			t.Errorf("%q does not sort after %q", id, previous)
+		}
+		previous = id
+		clock.Advance(time.Millisecond)
+	}
+}
+
+type uuidWidget struct {
+	ID   string `gorm:"primaryKey"`
+	Name string
+}
+
+type uuidGadget struct {
+	ID   string `gorm:"primaryKey"`
+	Name string
+}
+
+func TestUUIDPlugin(t *testing.T) {
+	conn := cservicetest.OpenDB(t, &uuidWidget{}, &uuidGadget{})
+	if err := conn.Use(NewUUIDPlugin(&uuidWidget{})); err != nil {
+		t.Fatal(err)
+	}
+
+	widget := &uuidWidget{Name: "sprocket"}
+	if err := conn.Create(widget).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !uuidPattern.MatchString(widget.ID) {
+		t.Errorf("got id %q", widget.ID)
+	}
+
+	widgets := []uuidWidget{{Name: "a"}, {ID: "fixed", Name: "b"}}
+	if err := conn.Create(&widgets).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !uuidPattern.MatchString(widgets[0].ID) {
+		t.Errorf("batch create: got id %q", widgets[0].ID)
+	}
+	if widgets[1].ID != "fixed" {
+		t.Errorf("existing id was replaced with %q", widgets[1].ID)
+	}
+
+	gadget := &uuidGadget{ID: "", Name: "unregistered"}
+	if err := conn.Create(gadget).Error; err != nil {
+		t.Fatal(err)
+	}
+	if gadget.ID != "" {
+		t.Errorf("unregistered model was given id %q", gadget.ID)
+	}
+}
@@ -0,0 +1,112 @@
+package cservice
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// FieldError describes a field which fails validation.
+type FieldError struct {
+	// Field is the field or column name.
+	Field string
+
+	// Message describes the problem, e.g. "must be at most 40 characters".
+	Message string
+}
+
+// ValidationError lists the fields which fail validation. Validate methods
+// return it so ValidateBody can report each field.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+// Error describes the failed fields.
+func (e *ValidationError) Error() string {
+	parts := make([]string, 0, len(e.Fields))
+	for _, field := range e.Fields {
+		parts = append(parts, field.Field+" "+field.Message)
+	}
+
+	return "cservice: invalid " + strings.Join(parts, ", ")
+}
+
+type validatedBodyKey struct{}
+
+// ValidateBody returns middleware which decodes the JSON request body into a
+// new value of prototype's type, e.g. ValidateBody(&CreateUserDTO{}), before
+// the handler runs. Bodies which do not decode are rejected with 400 Bad
+// Request. If the value has a Validate() error method, a *ValidationError is
+// rejected with 422 Unprocessable Entity listing its fields, and any other
+// error is logged and rejected with a generic 400 Bad Request.
+// The handler reads the value with ValidatedBody.
+func ValidateBody(prototype interface{}) func(http.Handler) http.Handler {
+	t := reflect.TypeOf(prototype)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			body := reflect.New(t).Interface()
+
+			if err := json.NewDecoder(http.MaxBytesReader(rw, r.Body, 1<<20)).Decode(body); err != nil {
+				http.Error(rw, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+				return
+			}
+
+			if validator, ok := body.(interface{ Validate() error }); ok {
+				if err := validator.Validate(); err != nil {
+					writeValidationError(rw, r, err)
+					return
+				}
+			}
+
+			next.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), validatedBodyKey{}, body)))
+		})
+	}
+}
+
+// ValidatedBody returns the body decoded by ValidateBody for the request ctx
+// belongs to, and false if there is none of type T.
+func ValidatedBody[T any](ctx context.Context) (*T, bool) {
+	body, ok := ctx.Value(validatedBodyKey{}).(*T)
+	return body, ok
+}
+
+// validationLogger logs Validate errors which are not a *ValidationError.
+var validationLogger = log.New(os.Stdout, "", log.LstdFlags)
+
+func writeValidationError(rw http.ResponseWriter, r *http.Request, err error) {
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		// Other errors may describe internals, so the client gets a generic
+		// message and the detail is logged.
+		validationLogger.Printf("[validate] %s %s: %v", r.Method, r.URL.Path, err)
+		writeJSON(rw, http.StatusBadRequest, struct {
+			Error string `json:"error"`
+		}{"invalid request body"})
+		return
+	}
+
+	type fieldError struct {
+		Field   string `json:"field"`
+		Message string `json:"message"`
+	}
+
+	response := struct {
+		Error  string       `json:"error"`
+		Fields []fieldError `json:"fields,omitempty"`
+	}{Error: "invalid request body"}
+
+	for _, field := range validationErr.Fields {
+		response.Fields = append(response.Fields, fieldError{Field: field.Field, Message: field.Message})
+	}
+
+	writeJSON(rw, http.StatusUnprocessableEntity, response)
+}
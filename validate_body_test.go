@@ -0,0 +1,86 @@
+package cservice
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type createUserBody struct {
+	Email string `json:"email"`
+}
+
+func (b *createUserBody) Validate() error {
+	if !strings.Contains(b.Email, "@") {
+		return &ValidationError{Fields: []FieldError{{Field: "email", Message: "must be an email address"}}}
+	}
+	return nil
+}
+
+func TestValidateBody(t *testing.T) {
+	var got *createUserBody
+	handler := ValidateBody(&createUserBody{})(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		got, _ = ValidatedBody[createUserBody](r.Context())
+	}))
+
+	tests := []struct {
+		body string
+		code int
+	}{
+		{`{"email":"a@example.com"}`, http.StatusOK},
+		{`{"email":"nope"}`, http.StatusUnprocessableEntity},
+		{`{"email":`, http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		got = nil
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(test.body)))
+
+		if rec.Code != test.code {
+			t.Errorf("%s: got %d, want %d", test.body, rec.Code, test.code)
+		}
+		if (test.code == http.StatusOK) != (got != nil) {
+			t.Errorf("%s: handler saw body %v", test.body, got)
+		}
+		if test.code == http.StatusUnprocessableEntity && !strings.Contains(rec.Body.String(), `"field":"email"`) {
+			t.Errorf("%s: response %s does not list the field", test.body, rec.Body)
+		}
+	}
+}
+
+type lookupBody struct {
+	ID int `json:"id"`
+}
+
+func (b *lookupBody) Validate() error {
+	return errors.New("dial tcp 10.0.0.7:3306: connection refused")
+}
+
+func TestValidateBodyHidesOtherErrors(t *testing.T) {
+	var logged bytes.Buffer
+	saved := validationLogger
+	validationLogger = log.New(&logged, "", 0)
+	t.Cleanup(func() { validationLogger = saved })
+
+	handler := ValidateBody(&lookupBody{})(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		t.Error("handler ran for an invalid body")
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/lookup", strings.NewReader(`{"id":1}`)))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("got %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if strings.Contains(rec.Body.String(), "10.0.0.7") {
+		t.Errorf("response %s leaks the error", rec.Body)
+	}
+	if !strings.Contains(logged.String(), "10.0.0.7") {
+		t.Errorf("log %q is missing the error", logged.String())
+	}
+}
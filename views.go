@@ -0,0 +1,109 @@
+package cservice
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ErrMaterializedViewUnsupported is returned when a materialized view is
+// requested from MySQL, which does not support them.
+var ErrMaterializedViewUnsupported = errors.New("cservice: materialized views are not supported by MySQL")
+
+// ViewOptions defines how a view is created.
+type ViewOptions struct {
+	// OrReplace replaces an existing view of the same name.
+	OrReplace bool
+
+	// Algorithm is the view algorithm: UNDEFINED, MERGE or TEMPTABLE.
+	Algorithm string
+
+	// Security is the SQL SECURITY characteristic: DEFINER or INVOKER.
+	Security string
+
+	// CheckOption adds WITH CASCADED or WITH LOCAL CHECK OPTION.
+	CheckOption string
+
+	// Materialized requests a materialized view.
+	Materialized bool
+}
+
+// BuildView returns the CREATE VIEW statement for a view named name over
+// selectSQL.
+func BuildView(name, selectSQL string, options ViewOptions) (string, error) {
+	if err := validateIdentifier("view", name); err != nil {
+		return "", err
+	}
+
+	if options.Materialized {
+		return "", ErrMaterializedViewUnsupported
+	}
+
+	if strings.TrimSpace(selectSQL) == "" {
+		return "", fmt.Errorf("cservice: view %s has no SELECT statement", name)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("CREATE ")
+
+	if options.OrReplace {
+		sb.WriteString("OR REPLACE ")
+	}
+
+	if options.Algorithm != "" {
+		algorithm := strings.ToUpper(options.Algorithm)
+		switch algorithm {
+		case "UNDEFINED", "MERGE", "TEMPTABLE":
+		default:
+			return "", fmt.Errorf("cservice: invalid view algorithm %q", options.Algorithm)
+		}
+		sb.WriteString("ALGORITHM = " + algorithm + " ")
+	}
+
+	if options.Security != "" {
+		security := strings.ToUpper(options.Security)
+		switch security {
+		case "DEFINER", "INVOKER":
+		default:
+			return "", fmt.Errorf("cservice: invalid view security %q", options.Security)
+		}
+		sb.WriteString("SQL SECURITY " + security + " ")
+	}
+
+	sb.WriteString("VIEW " + quoteIdentifier(name) + " AS " + strings.TrimRight(strings.TrimSpace(selectSQL), ";"))
+
+	if options.CheckOption != "" {
+		check := strings.ToUpper(options.CheckOption)
+		switch check {
+		case "CASCADED", "LOCAL":
+		default:
+			return "", fmt.Errorf("cservice: invalid view check option %q", options.CheckOption)
+		}
+		sb.WriteString(" WITH " + check + " CHECK OPTION")
+	}
+
+	return sb.String(), nil
+}
+
+// ViewMigration returns a Migration creating the view on Up and dropping it on
+// Down. The view definition is validated when the migration runs.
+func ViewMigration(version, name, selectSQL string, options ViewOptions) Migration {
+	return Migration{
+		Version: version,
+		Up: func(tx *gorm.DB) error {
+			statement, err := BuildView(name, selectSQL, options)
+			if err != nil {
+				return err
+			}
+			return tx.Exec(statement).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := validateIdentifier("view", name); err != nil {
+				return err
+			}
+			return tx.Exec("DROP VIEW IF EXISTS " + quoteIdentifier(name)).Error
+		},
+	}
+}
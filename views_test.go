@@ -0,0 +1,98 @@
+package cservice
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/crockerio/cservice/cservicetest"
+)
+
+func TestBuildView(t *testing.T) {
+	tests := []struct {
+		name    string
+		view    string
+		sql     string
+		options ViewOptions
+		want    string
+	}{
+		{"plain", "active_users", "SELECT id FROM users WHERE active", ViewOptions{}, "CREATE VIEW `active_users` AS SELECT id FROM users WHERE active"},
+		{"trailing semicolon", "v", " SELECT 1; ", ViewOptions{}, "CREATE VIEW `v` AS SELECT 1"},
+		{
+			"every option", "v", "SELECT 1",
+			ViewOptions{OrReplace: true, Algorithm: "merge", Security: "invoker", CheckOption: "local"},
+			"CREATE OR REPLACE ALGORITHM = MERGE SQL SECURITY INVOKER VIEW `v` AS SELECT 1 WITH LOCAL CHECK OPTION",
+		},
+	}
+
+	for _, test := range tests {
+		got, err := BuildView(test.view, test.sql, test.options)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestBuildViewRejectsInvalidInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		view    string
+		sql     string
+		options ViewOptions
+	}{
+		{"injected name", "v`; DROP TABLE users; --", "SELECT 1", ViewOptions{}},
+		{"empty select", "v", "  ", ViewOptions{}},
+		{"algorithm", "v", "SELECT 1", ViewOptions{Algorithm: "FAST"}},
+		{"security", "v", "SELECT 1", ViewOptions{Security: "NOBODY"}},
+		{"check option", "v", "SELECT 1", ViewOptions{CheckOption: "STRICT"}},
+	}
+
+	for _, test := range tests {
+		if got, err := BuildView(test.view, test.sql, test.options); err == nil {
+			t.Errorf("%s: got %q, want an error", test.name, got)
+		}
+	}
+
+	if _, err := BuildView("v", "SELECT 1", ViewOptions{Materialized: true}); !errors.Is(err, ErrMaterializedViewUnsupported) {
+		t.Errorf("materialized: got %v", err)
+	}
+}
+
+func TestViewMigration(t *testing.T) {
+	conn := cservicetest.OpenDB(t)
+	if err := conn.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY, active BOOLEAN)").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Exec("INSERT INTO users (id, active) VALUES (1, 1), (2, 0)").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewMigrator(conn, ViewMigration("001_active_users", "active_users", "SELECT id FROM users WHERE active", ViewOptions{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if err := m.Up(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []int
+	if err := conn.Raw("SELECT id FROM active_users").Scan(&ids).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != 1 {
+		t.Errorf("view returned %v, want [1]", ids)
+	}
+
+	if err := m.Down(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Raw("SELECT id FROM active_users").Scan(&ids).Error; err == nil {
+		t.Error("view still exists after Down")
+	}
+}